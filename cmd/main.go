@@ -1,15 +1,30 @@
 package main
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 	"log"
 	"net/http"
 	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/dinein"
+	"new_restaurant/dispatch"
+	"new_restaurant/events"
+	"new_restaurant/geocoder"
+	"new_restaurant/money"
+	"new_restaurant/payments"
+	"new_restaurant/routing"
+	"new_restaurant/scheduling"
 	"new_restaurant/servers"
+	"new_restaurant/utils"
 	"os"
 )
 
 func main() {
+	if err := utils.LoadKeyRing(); err != nil {
+		logrus.Panicf("Failed to load JWT signing keys with error: %+v", err)
+	}
+
 	if err := database.ConnectAndMigrate(
 		os.Getenv("DB_HOST"),
 		os.Getenv("DB_PORT"),
@@ -21,6 +36,49 @@ func main() {
 	}
 	logrus.Print("migration successful!!")
 
+	if err := dbHelper.BackfillRestaurantGeohashes(database.Rest); err != nil {
+		logrus.Panicf("Failed to backfill restaurant geohashes with error: %+v", err)
+	}
+
+	if err := events.Default.Listen(database.NewListener()); err != nil {
+		logrus.Panicf("Failed to listen for order events with error: %+v", err)
+	}
+
+	geo, err := geocoder.FromEnv()
+	if err != nil {
+		logrus.Panicf("Failed to initialize geocoder with error: %+v", err)
+	}
+	geocoder.Default = geo
+
+	router, err := routing.FromEnv()
+	if err != nil {
+		logrus.Panicf("Failed to initialize router with error: %+v", err)
+	}
+	routing.Default = router
+
+	money.DefaultCurrency, err = money.CurrencyFromEnv()
+	if err != nil {
+		logrus.Panicf("Failed to read default currency with error: %+v", err)
+	}
+
+	provider, err := payments.FromEnv()
+	if err != nil {
+		logrus.Panicf("Failed to initialize payment provider with error: %+v", err)
+	}
+	payments.Default = provider
+
+	dispatch.Default, err = dispatch.FromEnv()
+	if err != nil {
+		logrus.Panicf("Failed to read courier dispatch settings with error: %+v", err)
+	}
+	go dispatch.Run(context.Background())
+
+	dinein.URL, err = dinein.URLFromEnv()
+	if err != nil {
+		logrus.Panicf("Failed to read dine-in URL with error: %+v", err)
+	}
+	go scheduling.Run(context.Background())
+
 	r := server.SetupRoutes()
 
 	log.Println("Server running on http://localhost:8005")
@@ -6,24 +6,27 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/sirupsen/logrus"
+	"time"
 
 	// source/file import is required for migration files to read
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
 
-	// load pq as database driver
-	_ "github.com/lib/pq"
+	// pq is the database driver and provides LISTEN/NOTIFY
+	"github.com/lib/pq"
 )
 
 var (
 	Rest *sqlx.DB
+	// connStr is kept for connections outside the pool, such as listeners
+	connStr string
 )
 
 type SSLMode string
 
 // ConnectAndMigrate function connects with a given database and returns error if there is any error
 func ConnectAndMigrate(host, port, databaseName, user, password string, sslMode SSLMode) error {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", host, port, user, password, databaseName, sslMode)
+	connStr = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", host, port, user, password, databaseName, sslMode)
 	DB, err := sqlx.Open("postgres", connStr)
 
 	if err != nil {
@@ -80,3 +83,13 @@ func Tx(fn func(tx *sqlx.Tx) error) error {
 	err = fn(tx)
 	return err
 }
+
+// NewListener opens a dedicated connection for LISTEN/NOTIFY. It reconnects
+// on its own; notifications sent while it is disconnected are lost.
+func NewListener() *pq.Listener {
+	return pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logrus.Errorf("database listener: %s", err)
+		}
+	})
+}
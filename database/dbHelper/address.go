@@ -0,0 +1,87 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+func CreateUserAddress(tx *sqlx.Tx, address models.UserAddress) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO user_address (id, user_id, address, latitude, longitude, label, is_default) 
+		VALUES (:id, :user_id, :address, :latitude, :longitude, :label, :is_default)`, &address)
+	return err
+}
+
+func ListUserAddresses(db *sqlx.DB, userID uuid.UUID) ([]models.UserAddress, error) {
+	addresses := make([]models.UserAddress, 0)
+	err := db.Select(&addresses, `SELECT id, user_id, address, latitude, longitude, label, is_default, created_at
+		FROM user_address
+		WHERE user_id = $1 AND archived_at IS NULL
+		ORDER BY is_default DESC, created_at`, userID)
+	return addresses, err
+}
+
+// GetUserAddress returns an address only if it belongs to userID and has not been deleted
+func GetUserAddress(db *sqlx.DB, addressID string, userID uuid.UUID) (*models.UserAddress, error) {
+	var address models.UserAddress
+	query := `SELECT id, user_id, address, latitude, longitude, label, is_default, created_at
+	          FROM user_address 
+	          WHERE id = $1 AND user_id = $2 AND archived_at IS NULL`
+	err := db.Get(&address, query, addressID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// HasDefaultAddress reports whether the user already has a default address
+func HasDefaultAddress(tx *sqlx.Tx, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := tx.Get(&exists, `SELECT EXISTS (
+		SELECT 1 FROM user_address WHERE user_id = $1 AND is_default AND archived_at IS NULL)`, userID)
+	return exists, err
+}
+
+func UpdateUserAddress(tx *sqlx.Tx, address models.UserAddress) error {
+	_, err := tx.NamedExec(`UPDATE user_address
+		SET address = :address, latitude = :latitude, longitude = :longitude, label = :label
+		WHERE id = :id AND user_id = :user_id AND archived_at IS NULL`, &address)
+	return err
+}
+
+// SetDefaultAddress makes addressID the only default address of the user
+func SetDefaultAddress(tx *sqlx.Tx, userID, addressID uuid.UUID) error {
+	if _, err := tx.Exec(`UPDATE user_address SET is_default = FALSE
+		WHERE user_id = $1 AND is_default AND archived_at IS NULL`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE user_address SET is_default = TRUE
+		WHERE id = $1 AND user_id = $2 AND archived_at IS NULL`, addressID, userID)
+	return err
+}
+
+// ArchiveUserAddress soft deletes an address, clearing its default flag
+func ArchiveUserAddress(tx *sqlx.Tx, userID, addressID uuid.UUID) (bool, error) {
+	res, err := tx.Exec(`UPDATE user_address SET archived_at = NOW(), is_default = FALSE
+		WHERE id = $1 AND user_id = $2 AND archived_at IS NULL`, addressID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+// PromoteLatestAddress makes the user's most recently saved address their
+// default if they are left without one
+func PromoteLatestAddress(tx *sqlx.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE user_address SET is_default = TRUE
+		WHERE id = (
+			SELECT id FROM user_address
+			WHERE user_id = $1 AND archived_at IS NULL
+			ORDER BY created_at DESC
+			LIMIT 1)
+		  AND NOT EXISTS (
+			SELECT 1 FROM user_address WHERE user_id = $1 AND is_default AND archived_at IS NULL)`, userID)
+	return err
+}
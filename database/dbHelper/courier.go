@@ -0,0 +1,152 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+	"time"
+)
+
+const assignmentColumns = `id, order_id, courier_id, status, distance_km, offered_at, expires_at, responded_at`
+
+func GetCourier(db sqlx.Queryer, userID uuid.UUID) (*models.Courier, error) {
+	var courier models.Courier
+	err := sqlx.Get(db, &courier, `SELECT user_id, available, latitude, longitude, location_updated_at, updated_at
+		FROM couriers WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &courier, nil
+}
+
+// SetCourierAvailability starts or ends a courier's shift
+func SetCourierAvailability(db *sqlx.DB, userID uuid.UUID, available bool) error {
+	_, err := db.Exec(`
+		INSERT INTO couriers (user_id, available) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET available = EXCLUDED.available, updated_at = NOW()`, userID, available)
+	return err
+}
+
+// UpdateCourierLocation records where a courier is now
+func UpdateCourierLocation(db *sqlx.DB, userID uuid.UUID, latitude, longitude float64) error {
+	_, err := db.Exec(`
+		INSERT INTO couriers (user_id, latitude, longitude, location_updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude,
+		    location_updated_at = EXCLUDED.location_updated_at, updated_at = NOW()`, userID, latitude, longitude)
+	return err
+}
+
+// ListFreeCouriers returns the couriers who can be offered the order: on
+// shift, with a location reported since locatedSince, not busy with another
+// order and never offered this one before. They stay locked until the
+// transaction ends so concurrent dispatches cannot offer them twice.
+func ListFreeCouriers(tx *sqlx.Tx, orderID uuid.UUID, locatedSince time.Time) ([]models.Courier, error) {
+	couriers := make([]models.Courier, 0)
+	err := tx.Select(&couriers, `
+		SELECT c.user_id, c.available, c.latitude, c.longitude, c.location_updated_at, c.updated_at
+		FROM couriers c
+		JOIN users u ON u.id = c.user_id AND u.archived_at IS NULL
+		WHERE c.available AND c.latitude IS NOT NULL AND c.location_updated_at >= $2
+		  AND NOT EXISTS (SELECT 1 FROM delivery_assignments a
+		                  WHERE a.courier_id = c.user_id AND (a.status IN ('offered', 'accepted') OR a.order_id = $1))
+		FOR UPDATE OF c SKIP LOCKED`, orderID, locatedSince)
+	return couriers, err
+}
+
+func CreateAssignment(tx *sqlx.Tx, assignment models.DeliveryAssignment) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO delivery_assignments (id, order_id, courier_id, status, distance_km, expires_at)
+		VALUES (:id, :order_id, :courier_id, :status, :distance_km, :expires_at)`, &assignment)
+	return err
+}
+
+func GetAssignmentForUpdate(tx *sqlx.Tx, assignmentID uuid.UUID) (*models.DeliveryAssignment, error) {
+	var assignment models.DeliveryAssignment
+	err := tx.Get(&assignment, `SELECT `+assignmentColumns+` FROM delivery_assignments WHERE id = $1 FOR UPDATE`, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+// GetActiveAssignment returns the order's live offer or accepted assignment
+func GetActiveAssignment(db sqlx.Queryer, orderID uuid.UUID) (*models.DeliveryAssignment, error) {
+	var assignment models.DeliveryAssignment
+	err := sqlx.Get(db, &assignment, `SELECT `+assignmentColumns+` FROM delivery_assignments
+		WHERE order_id = $1 AND status IN ('offered', 'accepted')`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+func UpdateAssignmentStatus(tx *sqlx.Tx, assignmentID uuid.UUID, status models.AssignmentStatus) error {
+	_, err := tx.Exec(`UPDATE delivery_assignments SET status = $2, responded_at = COALESCE(responded_at, NOW())
+		WHERE id = $1`, assignmentID, status)
+	return err
+}
+
+// ListCourierAssignments returns a courier's open offers and accepted
+// deliveries with the addresses involved
+func ListCourierAssignments(db *sqlx.DB, courierID uuid.UUID) ([]models.CourierAssignment, error) {
+	assignments := make([]models.CourierAssignment, 0)
+	err := db.Select(&assignments, `
+		SELECT a.id, a.order_id, a.courier_id, a.status, a.distance_km, a.offered_at, a.expires_at, a.responded_at,
+		       r.name AS restaurant_name, r.address AS restaurant_address,
+		       ua.address AS delivery_address, ua.latitude AS delivery_latitude, ua.longitude AS delivery_longitude
+		FROM delivery_assignments a
+		JOIN orders o ON o.id = a.order_id
+		JOIN restaurant r ON r.id = o.restaurant_id
+		LEFT JOIN user_address ua ON ua.id = o.user_address_id
+		WHERE a.courier_id = $1 AND a.status IN ('offered', 'accepted')
+		ORDER BY a.offered_at`, courierID)
+	return assignments, err
+}
+
+// ListDeliveringOrders returns the orders a courier has accepted
+func ListDeliveringOrders(db *sqlx.DB, courierID uuid.UUID) ([]models.Order, error) {
+	orders := make([]models.Order, 0)
+	err := db.Select(&orders, `SELECT `+orderColumns+` FROM orders
+		WHERE id IN (SELECT order_id FROM delivery_assignments WHERE courier_id = $1 AND status = 'accepted')`, courierID)
+	return orders, err
+}
+
+func SetOrderCourier(tx *sqlx.Tx, orderID uuid.UUID, courierID *uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE orders SET courier_id = $2, updated_at = NOW() WHERE id = $1`, orderID, courierID)
+	return err
+}
+
+// ExpireOffers closes every offer that was not answered in time and returns
+// the orders that need another courier
+func ExpireOffers(db *sqlx.DB) ([]uuid.UUID, error) {
+	orderIDs := make([]uuid.UUID, 0)
+	err := db.Select(&orderIDs, `
+		UPDATE delivery_assignments SET status = 'expired', responded_at = NOW()
+		WHERE status = 'offered' AND expires_at <= NOW()
+		RETURNING order_id`)
+	return orderIDs, err
+}
+
+// CancelStaleAssignments closes the assignments of orders that were cancelled
+// or rejected, freeing their couriers
+func CancelStaleAssignments(db *sqlx.DB) error {
+	_, err := db.Exec(`
+		UPDATE delivery_assignments SET status = 'cancelled', responded_at = NOW()
+		WHERE status IN ('offered', 'accepted')
+		  AND order_id IN (SELECT id FROM orders WHERE status IN ('cancelled', 'rejected'))`)
+	return err
+}
+
+// ListOrdersAwaitingCourier returns the orders the kitchen has accepted that
+// have neither a courier nor an open offer
+func ListOrdersAwaitingCourier(db *sqlx.DB) ([]uuid.UUID, error) {
+	orderIDs := make([]uuid.UUID, 0)
+	err := db.Select(&orderIDs, `
+		SELECT o.id FROM orders o
+		WHERE o.status IN ('accepted', 'preparing', 'ready') AND o.courier_id IS NULL AND o.tab_id IS NULL AND o.archived_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM delivery_assignments a
+		                  WHERE a.order_id = o.id AND a.status IN ('offered', 'accepted'))
+		ORDER BY o.created_at`)
+	return orderIDs, err
+}
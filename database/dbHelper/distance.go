@@ -0,0 +1,59 @@
+package dbHelper
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"new_restaurant/models"
+	"strings"
+)
+
+// haversineSQL computes the straight-line (great-circle) distance in km
+// between the user address a and restaurant r, matching utils.CalculateDistance.
+// Rounding can push the SQRT argument just past 1 for antipodal points, which
+// ASIN rejects, so it is capped.
+const haversineSQL = `ROUND((6371 * 2 * ASIN(LEAST(1, SQRT(
+		POWER(SIN(RADIANS(r.latitude - a.latitude) / 2), 2) +
+		COS(RADIANS(a.latitude)) * COS(RADIANS(r.latitude)) *
+		POWER(SIN(RADIANS(r.longitude - a.longitude) / 2), 2)))))::numeric, 2)`
+
+// ListDistancesToRestaurants computes the straight-line distance from one of the user's
+// addresses to each of the given restaurants in a single query, nearest first
+func ListDistancesToRestaurants(db *sqlx.DB, userID uuid.UUID, addressID string, restaurantIDs []string) ([]models.RestaurantDistance, error) {
+	query := `SELECT r.id AS restaurant_id, r.name, ` + haversineSQL + ` AS straight_line_km
+		FROM user_address a
+		JOIN restaurant r ON r.archived_at IS NULL AND r.latitude IS NOT NULL AND r.longitude IS NOT NULL
+		WHERE a.id = $1 AND a.user_id = $2 AND a.archived_at IS NULL
+		  AND a.latitude IS NOT NULL AND a.longitude IS NOT NULL
+		  AND r.id = ANY($3)
+		ORDER BY straight_line_km, r.name`
+
+	distances := make([]models.RestaurantDistance, 0)
+	err := db.Select(&distances, query, addressID, userID, pq.Array(restaurantIDs))
+	return distances, err
+}
+
+// ListDistancesInGeohashCells computes straight-line distances from the address to every
+// restaurant in the given geohash cells that lies within radiusKm, nearest first
+func ListDistancesInGeohashCells(db *sqlx.DB, userID uuid.UUID, addressID string, cells []string, radiusKm float64) ([]models.RestaurantDistance, error) {
+	conditions := make([]string, 0, len(cells))
+	args := []interface{}{addressID, userID, radiusKm}
+	for _, cell := range cells {
+		args = append(args, cell+"%")
+		conditions = append(conditions, fmt.Sprintf("r.geohash LIKE $%d", len(args)))
+	}
+
+	query := `SELECT * FROM (
+			SELECT r.id AS restaurant_id, r.name, ` + haversineSQL + ` AS straight_line_km
+			FROM user_address a
+			JOIN restaurant r ON r.archived_at IS NULL AND (` + strings.Join(conditions, " OR ") + `)
+			WHERE a.id = $1 AND a.user_id = $2 AND a.archived_at IS NULL
+		) d
+		WHERE d.straight_line_km <= $3
+		ORDER BY d.straight_line_km, d.name`
+
+	distances := make([]models.RestaurantDistance, 0)
+	err := db.Select(&distances, query, args...)
+	return distances, err
+}
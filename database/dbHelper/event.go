@@ -0,0 +1,68 @@
+package dbHelper
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/events"
+)
+
+// CreateOrderEvent stores the event and publishes it. Subscribers only see it
+// once the transaction commits, and never if it rolls back.
+//
+// The event's id is taken under a lock on its restaurant held until commit,
+// so a restaurant's events, and so each order's, commit in id order. Feeds
+// can then skip and resume by id without losing an event whose transaction
+// committed after a later one's.
+func CreateOrderEvent(tx *sqlx.Tx, event *events.Event) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('events:' || $1::TEXT))`, event.RestaurantID); err != nil {
+		return err
+	}
+	err := tx.Get(event, `
+		INSERT INTO order_events (order_id, restaurant_id, type, data)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, order_id, restaurant_id, type, data, created_at`,
+		event.OrderID, event.RestaurantID, event.Type, string(event.Data))
+	if err != nil {
+		return err
+	}
+	return NotifyEvent(tx, *event)
+}
+
+// NotifyEvent publishes an event to every server instance without storing it
+func NotifyEvent(db sqlx.Execer, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`SELECT pg_notify($1, $2)`, events.Channel, string(payload))
+	return err
+}
+
+// ListOrderEvents returns the stored events of an order after the given event id
+func ListOrderEvents(db sqlx.Queryer, orderID uuid.UUID, afterID int64) ([]events.Event, error) {
+	list := make([]events.Event, 0)
+	err := sqlx.Select(db, &list, `SELECT id, order_id, restaurant_id, type, data, created_at
+		FROM order_events
+		WHERE order_id = $1 AND id > $2
+		ORDER BY id`, orderID, afterID)
+	return list, err
+}
+
+// ListRestaurantEvents returns the stored events of a restaurant's orders
+// after the given event id
+func ListRestaurantEvents(db sqlx.Queryer, restaurantID uuid.UUID, afterID int64) ([]events.Event, error) {
+	list := make([]events.Event, 0)
+	err := sqlx.Select(db, &list, `SELECT id, order_id, restaurant_id, type, data, created_at
+		FROM order_events
+		WHERE restaurant_id = $1 AND id > $2
+		ORDER BY id`, restaurantID, afterID)
+	return list, err
+}
+
+// LastRestaurantEventID is the id of the restaurant's latest event, or 0
+func LastRestaurantEventID(db sqlx.Queryer, restaurantID uuid.UUID) (int64, error) {
+	var id int64
+	err := sqlx.Get(db, &id, `SELECT COALESCE(MAX(id), 0) FROM order_events WHERE restaurant_id = $1`, restaurantID)
+	return id, err
+}
@@ -0,0 +1,58 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+// AddFavoriteRestaurant saves a restaurant for the customer; saving it again
+// is a no-op
+func AddFavoriteRestaurant(db *sqlx.DB, userID, restaurantID uuid.UUID) error {
+	_, err := db.Exec(`INSERT INTO favorite_restaurants (user_id, restaurant_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, userID, restaurantID)
+	return err
+}
+
+func RemoveFavoriteRestaurant(db *sqlx.DB, userID, restaurantID uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM favorite_restaurants WHERE user_id = $1 AND restaurant_id = $2`, userID, restaurantID)
+	return err
+}
+
+// AddFavoriteDish saves a dish for the customer; saving it again is a no-op
+func AddFavoriteDish(db *sqlx.DB, userID, dishID uuid.UUID) error {
+	_, err := db.Exec(`INSERT INTO favorite_dishes (user_id, dish_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, userID, dishID)
+	return err
+}
+
+func RemoveFavoriteDish(db *sqlx.DB, userID, dishID uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM favorite_dishes WHERE user_id = $1 AND dish_id = $2`, userID, dishID)
+	return err
+}
+
+// ListFavoriteRestaurants returns the customer's saved restaurants, most
+// recently saved first, leaving out archived ones
+func ListFavoriteRestaurants(db *sqlx.DB, userID uuid.UUID) ([]models.Restaurant, error) {
+	restaurants := make([]models.Restaurant, 0)
+	err := db.Select(&restaurants, `SELECT r.id, r.name, r.address, r.latitude, r.longitude, r.created_by, r.rating,
+		       r.currency, r.delivery_fee
+		FROM favorite_restaurants f
+		JOIN restaurant r ON r.id = f.restaurant_id
+		WHERE f.user_id = $1 AND r.archived_at IS NULL
+		ORDER BY f.created_at DESC`, userID)
+	return restaurants, err
+}
+
+// ListFavoriteDishes returns the customer's saved dishes, most recently saved
+// first, leaving out archived dishes and dishes of archived restaurants
+func ListFavoriteDishes(db *sqlx.DB, userID uuid.UUID) ([]models.Dish, error) {
+	dishes := make([]models.Dish, 0)
+	err := db.Select(&dishes, `SELECT d.id, d.restaurant_id, d.name, d.description, d.price, d.category, d.created_by
+		FROM favorite_dishes f
+		JOIN dishes d ON d.id = f.dish_id
+		JOIN restaurant r ON r.id = d.restaurant_id
+		WHERE f.user_id = $1 AND d.archived_at IS NULL AND r.archived_at IS NULL
+		ORDER BY f.created_at DESC`, userID)
+	return dishes, err
+}
@@ -0,0 +1,50 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+const invoiceColumns = `id, order_id, restaurant_id, number, restaurant_name, restaurant_address, customer_name, subtotal,
+	delivery_fee, packaging_fee, service_charge, discount_total, points_discount, tax_total, prices_include_tax, total, issued_at`
+
+func GetInvoiceByOrder(db sqlx.Queryer, orderID uuid.UUID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := sqlx.Get(db, &invoice, `SELECT `+invoiceColumns+` FROM invoices WHERE order_id = $1`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// IssueInvoice takes the restaurant's next invoice number and freezes the
+// order's totals into a new invoice. The counter row stays locked until the
+// transaction ends, so numbers are handed out in order and a rolled back
+// transaction leaves no gap.
+func IssueInvoice(tx *sqlx.Tx, orderID uuid.UUID) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := tx.Get(&invoice, `
+		WITH counter AS (
+			INSERT INTO invoice_counters (restaurant_id, last_number)
+			SELECT restaurant_id, 1 FROM orders WHERE id = $1
+			ON CONFLICT (restaurant_id) DO UPDATE SET last_number = invoice_counters.last_number + 1
+			RETURNING restaurant_id, last_number
+		)
+		INSERT INTO invoices (order_id, restaurant_id, number, restaurant_name, restaurant_address, customer_name, subtotal,
+		                      delivery_fee, packaging_fee, service_charge, discount_total, points_discount, tax_total, prices_include_tax,
+		                      total)
+		SELECT o.id, o.restaurant_id, c.last_number, r.name, r.address, COALESCE(u.name, 'Dine-in guest'), o.subtotal,
+		       o.delivery_fee, o.packaging_fee, o.service_charge, o.discount_total, o.points_discount, o.tax_total,
+		       o.prices_include_tax, o.total
+		FROM orders o
+		JOIN counter c ON c.restaurant_id = o.restaurant_id
+		JOIN restaurant r ON r.id = o.restaurant_id
+		LEFT JOIN users u ON u.id = o.user_id
+		WHERE o.id = $1
+		RETURNING `+invoiceColumns, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
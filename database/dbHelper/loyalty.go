@@ -0,0 +1,242 @@
+package dbHelper
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"time"
+)
+
+// ErrNotEnoughPoints is returned when a redemption exceeds the points left
+var ErrNotEnoughPoints = errors.New("not enough loyalty points")
+
+// GetLoyaltySettings returns a restaurant's loyalty settings. A restaurant
+// that was never configured awards no points and takes none.
+func GetLoyaltySettings(db sqlx.Queryer, restaurantID uuid.UUID) (*models.LoyaltySettings, error) {
+	var settings models.LoyaltySettings
+	err := sqlx.Get(db, &settings, `SELECT r.id AS restaurant_id,
+			COALESCE(s.earn_rate, 0) AS earn_rate,
+			s.point_value,
+			s.expiry_days,
+			s.updated_at
+		FROM restaurant r
+		LEFT JOIN restaurant_loyalty_settings s ON s.restaurant_id = r.id
+		WHERE r.id = $1`, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// ReplaceLoyaltySettings stores new settings. Points already earned keep
+// their expiry.
+func ReplaceLoyaltySettings(tx *sqlx.Tx, settings models.LoyaltySettings) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO restaurant_loyalty_settings (restaurant_id, earn_rate, point_value, expiry_days)
+		VALUES (:restaurant_id, :earn_rate, :point_value, :expiry_days)
+		ON CONFLICT (restaurant_id) DO UPDATE
+		SET earn_rate = EXCLUDED.earn_rate,
+		    point_value = EXCLUDED.point_value,
+		    expiry_days = EXCLUDED.expiry_days,
+		    updated_at = NOW()`, &settings)
+	return err
+}
+
+// LockLoyaltyAccount serialises changes to a customer's points until the
+// transaction ends, so concurrent orders cannot spend the same points
+func LockLoyaltyAccount(tx *sqlx.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('loyalty:' || $1::TEXT))`, userID)
+	return err
+}
+
+// ExpireLoyaltyPoints writes off the customer's points that expired by now,
+// dating each expiry entry when the points expired, or when they were given
+// back if that was later. The caller must hold the account lock.
+func ExpireLoyaltyPoints(tx *sqlx.Tx, userID uuid.UUID, now time.Time) error {
+	_, err := tx.Exec(`
+		WITH expired AS (
+			SELECT id, restaurant_id, remaining, expires_at, created_at FROM loyalty_ledger
+			WHERE user_id = $1 AND remaining > 0 AND expires_at <= $2
+		), cleared AS (
+			UPDATE loyalty_ledger l SET remaining = 0 FROM expired e WHERE l.id = e.id
+		)
+		INSERT INTO loyalty_ledger (user_id, restaurant_id, kind, points, created_at)
+		SELECT $1, restaurant_id, 'expire', -remaining, GREATEST(expires_at, created_at) FROM expired`, userID, now)
+	return err
+}
+
+// LoyaltyBalance returns the customer's points at a restaurant, leaving out
+// points that expired by now even if their expiry is not written yet
+func LoyaltyBalance(db sqlx.Queryer, userID, restaurantID uuid.UUID, now time.Time) (int, error) {
+	var balance int
+	err := sqlx.Get(db, &balance, `SELECT COALESCE(SUM(points), 0)
+			- COALESCE(SUM(remaining) FILTER (WHERE expires_at <= $3), 0)
+		FROM loyalty_ledger
+		WHERE user_id = $1 AND restaurant_id = $2`, userID, restaurantID, now)
+	return balance, err
+}
+
+// RedeemLoyaltyPoints spends points on an order, using up the points that
+// expire first and remembering which, so restoreLoyaltyPoints can give them
+// back as they were. The caller must hold the account lock and have expired
+// the account's points.
+func RedeemLoyaltyPoints(tx *sqlx.Tx, userID, restaurantID, orderID uuid.UUID, points int) error {
+	var redeemID uuid.UUID
+	err := tx.Get(&redeemID, `INSERT INTO loyalty_ledger (user_id, restaurant_id, order_id, kind, points)
+		VALUES ($1, $2, $3, 'redeem', $4)
+		RETURNING id`, userID, restaurantID, orderID, -points)
+	if err != nil {
+		return err
+	}
+
+	var lots []struct {
+		ID        uuid.UUID `db:"id"`
+		Remaining int       `db:"remaining"`
+	}
+	err = tx.Select(&lots, `SELECT id, remaining FROM loyalty_ledger
+		WHERE user_id = $1 AND restaurant_id = $2 AND remaining > 0
+		ORDER BY expires_at NULLS LAST, created_at`, userID, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	left := points
+	for _, lot := range lots {
+		if left == 0 {
+			break
+		}
+		used := min(lot.Remaining, left)
+		if _, err := tx.Exec(`UPDATE loyalty_ledger SET remaining = remaining - $2 WHERE id = $1`, lot.ID, used); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO loyalty_redemption_lots (redeem_id, lot_id, points) VALUES ($1, $2, $3)`,
+			redeemID, lot.ID, used); err != nil {
+			return err
+		}
+		left -= used
+	}
+	if left > 0 {
+		return ErrNotEnoughPoints
+	}
+	return nil
+}
+
+// awardLoyaltyPoints credits the customer of a delivered order with the
+// points its restaurant awards for what they paid. Orders earn once.
+func awardLoyaltyPoints(tx *sqlx.Tx, order models.Order) error {
+	if order.UserID == nil {
+		return nil
+	}
+	settings, err := GetLoyaltySettings(tx, order.RestaurantID)
+	if err != nil {
+		return err
+	}
+	points := settings.PointsFor(order.Total.Sub(order.RefundedTotal))
+	if points == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO loyalty_ledger (user_id, restaurant_id, order_id, kind, points, remaining, expires_at)
+		VALUES ($1, $2, $3, 'earn', $4, $4, $5)
+		ON CONFLICT (order_id) WHERE kind = 'earn' DO NOTHING`,
+		*order.UserID, order.RestaurantID, order.ID, points, settings.ExpiresAt(time.Now()))
+	return err
+}
+
+// ClawBackLoyaltyPoints takes back the points a delivered order earned for
+// the refunded amount, out of what is left of its earn entry. Points already
+// spent are still taken, so the balance can go negative. Orders that have not
+// earned yet are skipped; they earn on what is left of their total.
+func ClawBackLoyaltyPoints(tx *sqlx.Tx, order models.Order, refunded money.Money) error {
+	if order.UserID == nil {
+		return nil
+	}
+	if err := LockLoyaltyAccount(tx, *order.UserID); err != nil {
+		return err
+	}
+
+	var earned struct {
+		ID         uuid.UUID `db:"id"`
+		Points     int       `db:"points"`
+		ClawedBack int       `db:"clawed_back"`
+	}
+	err := tx.Get(&earned, `SELECT e.id, e.points,
+			COALESCE((SELECT -SUM(c.points) FROM loyalty_ledger c
+			          WHERE c.order_id = e.order_id AND c.kind = 'clawback'), 0) AS clawed_back
+		FROM loyalty_ledger e
+		WHERE e.order_id = $1 AND e.kind = 'earn'`, order.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	settings, err := GetLoyaltySettings(tx, order.RestaurantID)
+	if err != nil {
+		return err
+	}
+	points := settings.ClawbackFor(refunded, earned.Points, earned.ClawedBack)
+	if points == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(`UPDATE loyalty_ledger SET remaining = GREATEST(remaining - $2, 0) WHERE id = $1`,
+		earned.ID, points); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO loyalty_ledger (user_id, restaurant_id, order_id, kind, points)
+		VALUES ($1, $2, $3, 'clawback', $4)`, *order.UserID, order.RestaurantID, order.ID, -points)
+	return err
+}
+
+// restoreLoyaltyPoints gives back the points redeemed on an order that was
+// cancelled, rejected or expired unpaid. Each part keeps the expiry of the
+// points it was spent from, so abandoning orders cannot extend points; parts
+// that expired meanwhile are written off by the next ExpireLoyaltyPoints.
+func restoreLoyaltyPoints(tx *sqlx.Tx, order models.Order) error {
+	if order.UserID == nil || order.PointsRedeemed == 0 {
+		return nil
+	}
+	if err := LockLoyaltyAccount(tx, *order.UserID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`INSERT INTO loyalty_ledger (user_id, restaurant_id, order_id, kind, points, remaining, expires_at)
+		SELECT r.user_id, r.restaurant_id, r.order_id, 'restore', d.points, d.points, lot.expires_at
+		FROM loyalty_ledger r
+		JOIN loyalty_redemption_lots d ON d.redeem_id = r.id
+		JOIN loyalty_ledger lot ON lot.id = d.lot_id
+		WHERE r.order_id = $1 AND r.kind = 'redeem'`, order.ID)
+	return err
+}
+
+// ListLoyaltyBalances returns the customer's points at every restaurant they
+// have any at, leaving out points that expired by now
+func ListLoyaltyBalances(db *sqlx.DB, userID uuid.UUID, now time.Time) ([]models.LoyaltyBalance, error) {
+	balances := make([]models.LoyaltyBalance, 0)
+	err := db.Select(&balances, `SELECT l.restaurant_id, r.name AS restaurant_name,
+			SUM(l.points) - COALESCE(SUM(l.remaining) FILTER (WHERE l.expires_at <= $2), 0) AS points,
+			MIN(l.expires_at) FILTER (WHERE l.remaining > 0 AND l.expires_at > $2) AS next_expiry
+		FROM loyalty_ledger l
+		JOIN restaurant r ON r.id = l.restaurant_id
+		WHERE l.user_id = $1
+		GROUP BY l.restaurant_id, r.name
+		ORDER BY r.name`, userID, now)
+	return balances, err
+}
+
+// ListLoyaltyEntries returns the customer's ledger, newest first, optionally
+// at one restaurant
+func ListLoyaltyEntries(db *sqlx.DB, userID uuid.UUID, restaurantID *uuid.UUID, limit int) ([]models.LoyaltyEntry, error) {
+	entries := make([]models.LoyaltyEntry, 0)
+	err := db.Select(&entries, `SELECT id, restaurant_id, order_id, kind, points, expires_at, created_at
+		FROM loyalty_ledger
+		WHERE user_id = $1 AND ($2::UUID IS NULL OR restaurant_id = $2)
+		ORDER BY created_at DESC, id
+		LIMIT $3`, userID, restaurantID, limit)
+	return entries, err
+}
@@ -0,0 +1,97 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+func GetActiveMFA(db *sqlx.DB, userID uuid.UUID) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	err := db.Get(&mfa, `SELECT id, user_id, secret, last_used_step, enabled_at, created_at
+		FROM user_mfa
+		WHERE user_id = $1 AND archived_at IS NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+func CreateMFA(tx *sqlx.Tx, mfa models.UserMFA) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO user_mfa (id, user_id, secret)
+		VALUES (:id, :user_id, :secret)`, &mfa)
+	return err
+}
+
+func ArchiveMFA(tx *sqlx.Tx, userID uuid.UUID) error {
+	if _, err := tx.Exec(`UPDATE user_mfa SET archived_at = NOW()
+		WHERE user_id = $1 AND archived_at IS NULL`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE user_mfa_recovery_code SET archived_at = NOW()
+		WHERE user_id = $1 AND archived_at IS NULL`, userID)
+	return err
+}
+
+func EnableMFA(tx *sqlx.Tx, mfaID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE user_mfa SET enabled_at = NOW()
+		WHERE id = $1 AND archived_at IS NULL`, mfaID)
+	return err
+}
+
+// ConsumeMFAStep records the TOTP time step as used and reports false if that
+// step (or a later one) was already consumed, preventing code replay
+func ConsumeMFAStep(db *sqlx.DB, mfaID uuid.UUID, step int64) (bool, error) {
+	res, err := db.Exec(`UPDATE user_mfa SET last_used_step = $2
+		WHERE id = $1 AND last_used_step < $2 AND archived_at IS NULL`, mfaID, step)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+func ReplaceRecoveryCodes(tx *sqlx.Tx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(`UPDATE user_mfa_recovery_code SET archived_at = NOW()
+		WHERE user_id = $1 AND archived_at IS NULL`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO user_mfa_recovery_code (id, user_id, code_hash)
+			VALUES ($1, $2, $3)`, uuid.New(), userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used and reports whether one was found
+func UseRecoveryCode(db *sqlx.DB, userID uuid.UUID, codeHash string) (bool, error) {
+	res, err := db.Exec(`UPDATE user_mfa_recovery_code SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL AND archived_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+// RecordMFAAttempt counts a code tried against a login challenge token and
+// returns how many have been tried with it, this one included
+func RecordMFAAttempt(db *sqlx.DB, tokenID, userID uuid.UUID) (int, error) {
+	var attempts int
+	err := db.Get(&attempts, `INSERT INTO mfa_challenge_attempts (token_id, user_id, attempts)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (token_id) DO UPDATE SET attempts = mfa_challenge_attempts.attempts + 1
+		RETURNING attempts`, tokenID, userID)
+	return attempts, err
+}
+
+// RevokeMFAChallenge uses up a login challenge token so no more codes are
+// accepted with it
+func RevokeMFAChallenge(db *sqlx.DB, tokenID uuid.UUID, maxAttempts int) error {
+	_, err := db.Exec(`UPDATE mfa_challenge_attempts SET attempts = GREATEST(attempts, $2)
+		WHERE token_id = $1`, tokenID, maxAttempts)
+	return err
+}
@@ -0,0 +1,233 @@
+package dbHelper
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"new_restaurant/events"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"time"
+)
+
+func GetDishesByIDs(db *sqlx.DB, restaurantID uuid.UUID, dishIDs []uuid.UUID) ([]models.Dish, error) {
+	dishes := make([]models.Dish, 0)
+	err := db.Select(&dishes, `SELECT id, restaurant_id, name, description, price, category, created_by
+		FROM dishes
+		WHERE restaurant_id = $1 AND id = ANY($2) AND archived_at IS NULL`, restaurantID, pq.Array(dishIDs))
+	return dishes, err
+}
+
+func CreateOrder(tx *sqlx.Tx, order models.Order) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO orders (id, user_id, restaurant_id, user_address_id, status, tab_id, scheduled_for, subtotal, delivery_fee,
+		                    packaging_fee, service_charge, discount_total, points_redeemed, points_discount, tax_total,
+		                    prices_include_tax, total)
+		VALUES (:id, :user_id, :restaurant_id, :user_address_id, :status, :tab_id, :scheduled_for, :subtotal, :delivery_fee,
+		        :packaging_fee, :service_charge, :discount_total, :points_redeemed, :points_discount, :tax_total,
+		        :prices_include_tax, :total)`, &order)
+	return err
+}
+
+func CreateOrderItem(tx *sqlx.Tx, item models.OrderItem) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO order_items (id, order_id, dish_id, name, category, unit_price, quantity, discount_amount, tax_amount, line_total)
+		VALUES (:id, :order_id, :dish_id, :name, :category, :unit_price, :quantity, :discount_amount, :tax_amount, :line_total)`, &item)
+	if err != nil {
+		return err
+	}
+
+	for _, tax := range item.Taxes {
+		if _, err := tx.Exec(`INSERT INTO order_item_taxes (order_item_id, name, rate, amount, refunded)
+			VALUES ($1, $2, $3, $4, $5)`, item.ID, tax.Name, tax.Rate, tax.Amount, money.Zero(tax.Amount.Currency)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderColumns selects an order from an unaliased orders table
+const orderColumns = `id, user_id, restaurant_id, user_address_id, status, courier_id, tab_id,
+	(SELECT t.name FROM table_tabs tt JOIN restaurant_tables t ON t.id = tt.table_id WHERE tt.id = orders.tab_id) AS table_name,
+	scheduled_for, subtotal, delivery_fee, packaging_fee, service_charge, discount_total, points_redeemed, points_discount,
+	tax_total, prices_include_tax, total, refunded_total, created_at, updated_at`
+
+func GetOrderByID(db *sqlx.DB, orderID uuid.UUID) (*models.Order, error) {
+	var order models.Order
+	err := db.Get(&order, `SELECT `+orderColumns+` FROM orders WHERE id = $1 AND archived_at IS NULL`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrderForUpdate locks the order row for the rest of the transaction
+func GetOrderForUpdate(tx *sqlx.Tx, orderID uuid.UUID) (*models.Order, error) {
+	var order models.Order
+	err := tx.Get(&order, `SELECT `+orderColumns+` FROM orders WHERE id = $1 AND archived_at IS NULL FOR UPDATE`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func ListOrderItems(db sqlx.Queryer, orderID uuid.UUID) ([]models.OrderItem, error) {
+	items := make([]models.OrderItem, 0)
+	err := sqlx.Select(db, &items, `SELECT id, order_id, dish_id, name, category, unit_price, quantity, discount_amount, tax_amount,
+		       line_total, refunded_quantity, created_at
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY created_at, name`, orderID)
+	return items, err
+}
+
+// LoadOrderItemTaxes fills the line level tax breakdown of each item in place
+func LoadOrderItemTaxes(db sqlx.Queryer, items []models.OrderItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	var taxes []models.OrderItemTax
+	err := sqlx.Select(db, &taxes, `SELECT id, order_item_id, name, rate, amount, refunded
+		FROM order_item_taxes
+		WHERE order_item_id = ANY($1)
+		ORDER BY name, rate`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	byItem := make(map[uuid.UUID][]models.OrderItemTax, len(items))
+	for _, tax := range taxes {
+		byItem[tax.OrderItemID] = append(byItem[tax.OrderItemID], tax)
+	}
+	for i := range items {
+		items[i].Taxes = byItem[items[i].ID]
+		if items[i].Taxes == nil {
+			items[i].Taxes = make([]models.OrderItemTax, 0)
+		}
+	}
+	return nil
+}
+
+// ListOrderTaxes returns the order level tax breakdown, summing the line taxes
+// of each rate less what refunds gave back, so it adds up to the order's tax_total
+func ListOrderTaxes(db sqlx.Queryer, orderID uuid.UUID) ([]models.TaxAmount, error) {
+	taxes := make([]models.TaxAmount, 0)
+	err := sqlx.Select(db, &taxes, `SELECT t.name, t.rate,
+		       ROW(SUM((t.amount).amount - (t.refunded).amount), MIN((t.amount).currency))::money_amount AS amount
+		FROM order_item_taxes t
+		JOIN order_items oi ON oi.id = t.order_item_id
+		WHERE oi.order_id = $1
+		GROUP BY t.name, t.rate
+		ORDER BY t.name, t.rate`, orderID)
+	return taxes, err
+}
+
+// ListInvoicedTaxes returns the tax breakdown as the order was invoiced,
+// before any refund
+func ListInvoicedTaxes(db sqlx.Queryer, orderID uuid.UUID) ([]models.TaxAmount, error) {
+	taxes := make([]models.TaxAmount, 0)
+	err := sqlx.Select(db, &taxes, `SELECT t.name, t.rate,
+		       ROW(SUM((t.amount).amount), MIN((t.amount).currency))::money_amount AS amount
+		FROM order_item_taxes t
+		JOIN order_items oi ON oi.id = t.order_item_id
+		WHERE oi.order_id = $1
+		GROUP BY t.name, t.rate
+		ORDER BY t.name, t.rate`, orderID)
+	return taxes, err
+}
+
+func ListOrdersByUser(db *sqlx.DB, userID uuid.UUID) ([]models.Order, error) {
+	orders := make([]models.Order, 0)
+	err := db.Select(&orders, `SELECT `+orderColumns+` FROM orders
+		WHERE user_id = $1 AND archived_at IS NULL
+		ORDER BY created_at DESC`, userID)
+	return orders, err
+}
+
+// ListRestaurantOrdersByStatus returns a restaurant's orders in any of the
+// statuses, oldest first
+func ListRestaurantOrdersByStatus(db *sqlx.DB, restaurantID uuid.UUID, statuses []models.OrderStatus) ([]models.Order, error) {
+	names := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		names = append(names, string(status))
+	}
+	orders := make([]models.Order, 0)
+	err := db.Select(&orders, `SELECT `+orderColumns+` FROM orders
+		WHERE restaurant_id = $1 AND status::TEXT = ANY($2) AND archived_at IS NULL
+		ORDER BY created_at`, restaurantID, pq.Array(names))
+	return orders, err
+}
+
+// ListUnpaidOrdersBefore returns the orders still awaiting payment that were
+// created before cutoff and have no payment in flight
+func ListUnpaidOrdersBefore(db *sqlx.DB, cutoff time.Time) ([]uuid.UUID, error) {
+	orderIDs := make([]uuid.UUID, 0)
+	err := db.Select(&orderIDs, `
+		SELECT o.id FROM orders o
+		WHERE o.status = 'pending_payment' AND o.created_at < $1 AND o.archived_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM payments p
+		                  WHERE p.order_id = o.id AND p.status IN ('pending', 'authorized', 'captured'))
+		ORDER BY o.created_at`, cutoff)
+	return orderIDs, err
+}
+
+// HasLivePayment reports whether the order has a payment in flight or
+// captured. Callers hold the order lock, which PayOrder takes before creating
+// a payment.
+func HasLivePayment(tx *sqlx.Tx, orderID uuid.UUID) (bool, error) {
+	var live bool
+	err := tx.Get(&live, `SELECT EXISTS (SELECT 1 FROM payments
+		WHERE order_id = $1 AND status IN ('pending', 'authorized', 'captured'))`, orderID)
+	return live, err
+}
+
+// TransitionOrderStatus moves an order through the state machine and records
+// the change as an order event. Delivered orders earn their customer loyalty
+// points and called off orders give back the points redeemed on them. Moving
+// to the status it already has is a no-op, so callers can retry safely.
+func TransitionOrderStatus(tx *sqlx.Tx, orderID uuid.UUID, next models.OrderStatus) error {
+	order, err := GetOrderForUpdate(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status == next {
+		return nil
+	}
+	if !order.Status.CanTransitionTo(next) {
+		return models.ErrInvalidTransition
+	}
+
+	_, err = tx.Exec(`UPDATE orders SET status = $2, updated_at = NOW() WHERE id = $1`, orderID, next)
+	if err != nil {
+		return err
+	}
+
+	// loyalty points move with the order, in the same transaction
+	switch next {
+	case models.OrderDelivered:
+		err = awardLoyaltyPoints(tx, *order)
+	case models.OrderCancelled, models.OrderRejected:
+		err = restoreLoyaltyPoints(tx, *order)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(events.StatusChange{From: string(order.Status), To: string(next)})
+	if err != nil {
+		return err
+	}
+	return CreateOrderEvent(tx, &events.Event{
+		OrderID:      orderID,
+		RestaurantID: order.RestaurantID,
+		Type:         events.TypeOrderStatus,
+		Data:         data,
+	})
+}
@@ -0,0 +1,121 @@
+package dbHelper
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+const paymentColumns = `id, order_id, bill_share_id, provider, provider_ref, amount, currency, status, idempotency_key, failure_reason, created_at, updated_at`
+
+func CreatePayment(tx *sqlx.Tx, payment models.Payment) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO payments (id, order_id, bill_share_id, provider, amount, currency, status, idempotency_key)
+		VALUES (:id, :order_id, :bill_share_id, :provider, :amount, :currency, :status, :idempotency_key)`, &payment)
+	return err
+}
+
+func GetPaymentByIdempotencyKey(db *sqlx.DB, key string) (*models.Payment, error) {
+	var payment models.Payment
+	err := db.Get(&payment, `SELECT `+paymentColumns+` FROM payments WHERE idempotency_key = $1`, key)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetPaymentByProviderRefForUpdate locks the payment a webhook refers to
+func GetPaymentByProviderRefForUpdate(tx *sqlx.Tx, provider, providerRef string) (*models.Payment, error) {
+	var payment models.Payment
+	err := tx.Get(&payment, `SELECT `+paymentColumns+` FROM payments
+		WHERE provider = $1 AND provider_ref = $2
+		FOR UPDATE`, provider, providerRef)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func ListPaymentsByOrder(db *sqlx.DB, orderID uuid.UUID) ([]models.Payment, error) {
+	payments := make([]models.Payment, 0)
+	err := db.Select(&payments, `SELECT `+paymentColumns+` FROM payments
+		WHERE order_id = $1
+		ORDER BY created_at`, orderID)
+	return payments, err
+}
+
+// GetLivePayment returns the order's payment that is in flight or captured
+func GetLivePayment(db *sqlx.DB, orderID uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	err := db.Get(&payment, `SELECT `+paymentColumns+` FROM payments
+		WHERE order_id = $1 AND status IN ('pending', 'authorized', 'captured')`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetLiveBillSharePayment returns the share's payment that is in flight or
+// captured
+func GetLiveBillSharePayment(db *sqlx.DB, shareID uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	err := db.Get(&payment, `SELECT `+paymentColumns+` FROM payments
+		WHERE bill_share_id = $1 AND status IN ('pending', 'authorized', 'captured')`, shareID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func CountFailedPayments(db *sqlx.DB, orderID uuid.UUID) (int, error) {
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM payments WHERE order_id = $1 AND status IN ('failed', 'cancelled')`, orderID)
+	return count, err
+}
+
+func CountFailedBillSharePayments(db *sqlx.DB, shareID uuid.UUID) (int, error) {
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM payments WHERE bill_share_id = $1 AND status IN ('failed', 'cancelled')`, shareID)
+	return count, err
+}
+
+func UpdatePayment(tx *sqlx.Tx, payment models.Payment) error {
+	_, err := tx.NamedExec(`UPDATE payments
+		SET provider_ref = :provider_ref, status = :status, failure_reason = :failure_reason, updated_at = NOW()
+		WHERE id = :id`, &payment)
+	return err
+}
+
+// RecordWebhookEvent stores a webhook delivery and reports false if the event
+// was already recorded, i.e. this is a redelivery that must not be re-applied
+func RecordWebhookEvent(tx *sqlx.Tx, provider, eventID, eventType string, payload []byte) (bool, error) {
+	var id uuid.UUID
+	err := tx.Get(&id, `INSERT INTO payment_webhook_event (provider, event_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, event_id) DO NOTHING
+		RETURNING id`, provider, eventID, eventType, payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func GetPaymentForUpdate(tx *sqlx.Tx, paymentID uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	err := tx.Get(&payment, `SELECT `+paymentColumns+` FROM payments WHERE id = $1 FOR UPDATE`, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func GetPaymentByID(db *sqlx.DB, paymentID uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	err := db.Get(&payment, `SELECT `+paymentColumns+` FROM payments WHERE id = $1`, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
@@ -0,0 +1,159 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"new_restaurant/models"
+)
+
+// promotionSelect reads promotions with their usage counts. $1 is the user
+// whose own redemptions are counted; redemptions on cancelled or rejected
+// orders are not, and unpaid orders are cancelled when they expire.
+const promotionSelect = `SELECT p.id, p.code, p.name, p.type, p.percent_off, p.amount_off, p.max_discount,
+		p.restaurant_id, p.min_order_value, p.starts_at, p.ends_at, p.usage_limit, p.per_user_limit,
+		p.created_by, p.created_at,
+		(SELECT COUNT(*) FROM promotion_redemptions pr JOIN orders o ON o.id = pr.order_id
+			WHERE pr.promotion_id = p.id AND o.status NOT IN ('cancelled', 'rejected')) AS times_used,
+		(SELECT COUNT(*) FROM promotion_redemptions pr JOIN orders o ON o.id = pr.order_id
+			WHERE pr.promotion_id = p.id AND pr.user_id = $1 AND o.status NOT IN ('cancelled', 'rejected')) AS user_times_used
+	FROM promotions p`
+
+func CreatePromotion(tx *sqlx.Tx, promotion models.Promotion) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO promotions (id, code, name, type, percent_off, amount_off, max_discount, restaurant_id,
+		                        min_order_value, starts_at, ends_at, usage_limit, per_user_limit, created_by)
+		VALUES (:id, :code, :name, :type, :percent_off, :amount_off, :max_discount, :restaurant_id,
+		        :min_order_value, :starts_at, :ends_at, :usage_limit, :per_user_limit, :created_by)`, &promotion)
+	return err
+}
+
+func AddPromotionDish(tx *sqlx.Tx, promotionID, dishID uuid.UUID) error {
+	_, err := tx.Exec(`INSERT INTO promotion_dishes (promotion_id, dish_id) VALUES ($1, $2)`, promotionID, dishID)
+	return err
+}
+
+// loadPromotionDishes fills DishIDs for every promotion in place
+func loadPromotionDishes(db sqlx.Queryer, promotions []models.Promotion) error {
+	if len(promotions) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(promotions))
+	for _, promotion := range promotions {
+		ids = append(ids, promotion.ID)
+	}
+
+	var rows []struct {
+		PromotionID uuid.UUID `db:"promotion_id"`
+		DishID      uuid.UUID `db:"dish_id"`
+	}
+	err := sqlx.Select(db, &rows, `SELECT promotion_id, dish_id FROM promotion_dishes
+		WHERE promotion_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	dishes := make(map[uuid.UUID][]uuid.UUID, len(promotions))
+	for _, row := range rows {
+		dishes[row.PromotionID] = append(dishes[row.PromotionID], row.DishID)
+	}
+	for i := range promotions {
+		promotions[i].DishIDs = dishes[promotions[i].ID]
+	}
+	return nil
+}
+
+// ListAutomaticPromotions returns the code-less promotions that could apply to
+// an order at the restaurant, with usage counts for the user
+func ListAutomaticPromotions(db *sqlx.DB, restaurantID, userID uuid.UUID) ([]models.Promotion, error) {
+	promotions := make([]models.Promotion, 0)
+	err := db.Select(&promotions, promotionSelect+`
+		WHERE p.code IS NULL AND p.archived_at IS NULL
+		  AND (p.restaurant_id IS NULL OR p.restaurant_id = $2)
+		  AND (p.ends_at IS NULL OR p.ends_at > NOW())
+		ORDER BY p.created_at`, userID, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return promotions, loadPromotionDishes(db, promotions)
+}
+
+// GetPromotionByCode looks a promo code up case-insensitively, with usage counts for the user
+func GetPromotionByCode(db *sqlx.DB, code string, userID uuid.UUID) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := db.Get(&promotion, promotionSelect+`
+		WHERE UPPER(p.code) = UPPER($2) AND p.archived_at IS NULL`, userID, code)
+	if err != nil {
+		return nil, err
+	}
+	promotions := []models.Promotion{promotion}
+	if err := loadPromotionDishes(db, promotions); err != nil {
+		return nil, err
+	}
+	return &promotions[0], nil
+}
+
+// GetPromotionForUpdate locks the promotion so concurrent orders cannot both
+// take its last redemption, and returns its current usage counts for the user
+func GetPromotionForUpdate(tx *sqlx.Tx, promotionID, userID uuid.UUID) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := tx.Get(&promotion, promotionSelect+`
+		WHERE p.id = $2 AND p.archived_at IS NULL
+		FOR UPDATE OF p`, userID, promotionID)
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+func GetPromotionByID(db *sqlx.DB, promotionID uuid.UUID) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := db.Get(&promotion, promotionSelect+`
+		WHERE p.id = $2 AND p.archived_at IS NULL`, uuid.Nil, promotionID)
+	if err != nil {
+		return nil, err
+	}
+	promotions := []models.Promotion{promotion}
+	if err := loadPromotionDishes(db, promotions); err != nil {
+		return nil, err
+	}
+	return &promotions[0], nil
+}
+
+// ListPromotions returns every active promotion, or when createdBy is set
+// only those created by that user or scoped to a restaurant they created
+func ListPromotions(db *sqlx.DB, createdBy *uuid.UUID) ([]models.Promotion, error) {
+	promotions := make([]models.Promotion, 0)
+	err := db.Select(&promotions, promotionSelect+`
+		WHERE p.archived_at IS NULL
+		  AND ($2::uuid IS NULL OR p.created_by = $2
+		       OR p.restaurant_id IN (SELECT id FROM restaurant WHERE created_by = $2))
+		ORDER BY p.created_at DESC`, uuid.Nil, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	return promotions, loadPromotionDishes(db, promotions)
+}
+
+func ArchivePromotion(db *sqlx.DB, promotionID uuid.UUID) error {
+	_, err := db.Exec(`UPDATE promotions SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL`, promotionID)
+	return err
+}
+
+func CreatePromotionRedemption(tx *sqlx.Tx, redemption models.PromotionRedemption) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO promotion_redemptions (id, promotion_id, user_id, order_id, name, amount)
+		VALUES (:id, :promotion_id, :user_id, :order_id, :name, :amount)`, &redemption)
+	return err
+}
+
+// ListOrderRedemptions returns the discount breakdown of an order
+func ListOrderRedemptions(db sqlx.Queryer, orderID uuid.UUID) ([]models.PromotionRedemption, error) {
+	redemptions := make([]models.PromotionRedemption, 0)
+	err := sqlx.Select(db, &redemptions, `SELECT id, promotion_id, user_id, order_id, name, amount, created_at
+		FROM promotion_redemptions
+		WHERE order_id = $1
+		ORDER BY created_at, name`, orderID)
+	return redemptions, err
+}
@@ -0,0 +1,152 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+	"new_restaurant/money"
+)
+
+const refundColumns = `id, order_id, payment_id, amount, currency, reason, status, provider_ref, idempotency_key, created_by, created_at, updated_at`
+
+// GetCapturedPaymentForUpdate locks the payment that refunds of an order are issued against
+func GetCapturedPaymentForUpdate(tx *sqlx.Tx, orderID uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	err := tx.Get(&payment, `SELECT `+paymentColumns+` FROM payments
+		WHERE order_id = $1 AND status = 'captured'
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// SumRefunded returns the amount already refunded or being refunded from a payment
+func SumRefunded(tx *sqlx.Tx, paymentID uuid.UUID) (int64, error) {
+	var total int64
+	err := tx.Get(&total, `SELECT COALESCE(SUM(amount), 0) FROM refunds
+		WHERE payment_id = $1 AND status IN ('pending', 'succeeded')`, paymentID)
+	return total, err
+}
+
+// PendingRefundQuantities returns, per order item, the units reserved by
+// refunds that have not completed yet
+func PendingRefundQuantities(tx *sqlx.Tx, orderID uuid.UUID) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		OrderItemID uuid.UUID `db:"order_item_id"`
+		Quantity    int       `db:"quantity"`
+	}
+	err := tx.Select(&rows, `SELECT ri.order_item_id, SUM(ri.quantity) AS quantity
+		FROM refund_items ri
+		JOIN refunds rf ON rf.id = ri.refund_id
+		WHERE rf.order_id = $1 AND rf.status = 'pending'
+		GROUP BY ri.order_item_id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		pending[row.OrderItemID] = row.Quantity
+	}
+	return pending, nil
+}
+
+func CreateRefund(tx *sqlx.Tx, refund models.Refund) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO refunds (id, order_id, payment_id, amount, currency, reason, status, idempotency_key, created_by)
+		VALUES (:id, :order_id, :payment_id, :amount, :currency, :reason, :status, :idempotency_key, :created_by)`, &refund)
+	return err
+}
+
+func CreateRefundItem(tx *sqlx.Tx, item models.RefundItem) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO refund_items (id, refund_id, order_item_id, quantity, first_unit, amount)
+		VALUES (:id, :refund_id, :order_item_id, :quantity, :first_unit, :amount)`, &item)
+	return err
+}
+
+func GetRefundByIdempotencyKey(db *sqlx.DB, key string) (*models.Refund, error) {
+	var refund models.Refund
+	err := db.Get(&refund, `SELECT `+refundColumns+` FROM refunds WHERE idempotency_key = $1`, key)
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func GetRefundForUpdate(tx *sqlx.Tx, refundID uuid.UUID) (*models.Refund, error) {
+	var refund models.Refund
+	err := tx.Get(&refund, `SELECT `+refundColumns+` FROM refunds WHERE id = $1 FOR UPDATE`, refundID)
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func GetRefundByProviderRefForUpdate(tx *sqlx.Tx, providerRef string) (*models.Refund, error) {
+	var refund models.Refund
+	err := tx.Get(&refund, `SELECT `+refundColumns+` FROM refunds WHERE provider_ref = $1 FOR UPDATE`, providerRef)
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func ListRefundsByOrder(db *sqlx.DB, orderID uuid.UUID) ([]models.Refund, error) {
+	refunds := make([]models.Refund, 0)
+	err := db.Select(&refunds, `SELECT `+refundColumns+` FROM refunds
+		WHERE order_id = $1
+		ORDER BY created_at`, orderID)
+	return refunds, err
+}
+
+func ListRefundItems(db sqlx.Queryer, refundID uuid.UUID) ([]models.RefundItem, error) {
+	items := make([]models.RefundItem, 0)
+	err := sqlx.Select(db, &items, `SELECT id, refund_id, order_item_id, quantity, first_unit, amount
+		FROM refund_items
+		WHERE refund_id = $1`, refundID)
+	return items, err
+}
+
+func UpdateRefund(tx *sqlx.Tx, refund models.Refund) error {
+	_, err := tx.NamedExec(`UPDATE refunds
+		SET status = :status, provider_ref = :provider_ref, updated_at = NOW()
+		WHERE id = :id`, &refund)
+	return err
+}
+
+// ApplyRefundToOrder removes the refunded units from the order and lowers its
+// totals by the refunded amount. discount is the refunded units' share of the
+// line discounts and taxes carries, in Refunded, their share of each line tax.
+func ApplyRefundToOrder(tx *sqlx.Tx, orderID uuid.UUID, items []models.RefundItem, amount, discount money.Money, taxes []models.OrderItemTax) error {
+	for _, item := range items {
+		if _, err := tx.Exec(`UPDATE order_items SET refunded_quantity = refunded_quantity + $2
+			WHERE id = $1`, item.OrderItemID, item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	var tax int64
+	for _, share := range taxes {
+		if _, err := tx.Exec(`UPDATE order_item_taxes
+			SET refunded = ROW((refunded).amount + $2, (refunded).currency)::money_amount
+			WHERE id = $1`, share.ID, share.Refunded.Amount); err != nil {
+			return err
+		}
+		tax += share.Refunded.Amount
+	}
+
+	_, err := tx.Exec(`UPDATE orders SET
+			subtotal = ROW((SELECT COALESCE(SUM((unit_price).amount * (quantity - refunded_quantity)), 0)
+			                FROM order_items WHERE order_id = $1), (subtotal).currency)::money_amount,
+			discount_total = ROW(GREATEST((discount_total).amount - $3, 0), (discount_total).currency)::money_amount,
+			tax_total = ROW(GREATEST((tax_total).amount - $4, 0), (tax_total).currency)::money_amount,
+			total = ROW(GREATEST((total).amount - $2, 0), (total).currency)::money_amount,
+			refunded_total = ROW((refunded_total).amount + $2, (refunded_total).currency)::money_amount,
+			updated_at = NOW()
+		WHERE id = $1`, orderID, amount.Amount, discount.Amount, tax)
+	return err
+}
@@ -0,0 +1,242 @@
+package dbHelper
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"new_restaurant/models"
+	"time"
+)
+
+// IsExclusionViolation reports whether err is an exclusion constraint
+// violation, e.g. a reservation overlapping another on the same table
+func IsExclusionViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23P01"
+}
+
+const tableColumns = `id, restaurant_id, name, capacity, qr_version, qr_token, created_at, updated_at, archived_at`
+
+func ListDiningTables(db *sqlx.DB, restaurantID uuid.UUID) ([]models.DiningTable, error) {
+	tables := make([]models.DiningTable, 0)
+	err := db.Select(&tables, `SELECT `+tableColumns+` FROM restaurant_tables
+		WHERE restaurant_id = $1 AND archived_at IS NULL
+		ORDER BY capacity, name`, restaurantID)
+	return tables, err
+}
+
+func GetDiningTable(db *sqlx.DB, restaurantID, tableID uuid.UUID) (*models.DiningTable, error) {
+	var table models.DiningTable
+	err := db.Get(&table, `SELECT `+tableColumns+` FROM restaurant_tables
+		WHERE id = $1 AND restaurant_id = $2 AND archived_at IS NULL`, tableID, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// GetDiningTableForUpdate locks one of the restaurant's tables for the rest of the transaction
+func GetDiningTableForUpdate(tx *sqlx.Tx, restaurantID, tableID uuid.UUID) (*models.DiningTable, error) {
+	var table models.DiningTable
+	err := tx.Get(&table, `SELECT `+tableColumns+` FROM restaurant_tables
+		WHERE id = $1 AND restaurant_id = $2 AND archived_at IS NULL
+		FOR UPDATE`, tableID, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+func CreateDiningTable(db *sqlx.DB, table models.DiningTable) error {
+	_, err := db.NamedExec(`
+		INSERT INTO restaurant_tables (id, restaurant_id, name, capacity)
+		VALUES (:id, :restaurant_id, :name, :capacity)`, &table)
+	return err
+}
+
+func UpdateDiningTable(tx *sqlx.Tx, table models.DiningTable) error {
+	_, err := tx.NamedExec(`UPDATE restaurant_tables SET name = :name, capacity = :capacity, updated_at = NOW()
+		WHERE id = :id`, &table)
+	return err
+}
+
+// GetDiningTableByQRTokenForUpdate locks the table whose QR code encodes token
+func GetDiningTableByQRTokenForUpdate(tx *sqlx.Tx, token string) (*models.DiningTable, error) {
+	var table models.DiningTable
+	err := tx.Get(&table, `SELECT `+tableColumns+` FROM restaurant_tables
+		WHERE qr_token = $1 AND archived_at IS NULL
+		FOR UPDATE`, token)
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// RotateTableQRCode revokes every QR code printed for the table by giving it
+// a new code
+func RotateTableQRCode(tx *sqlx.Tx, tableID uuid.UUID) (int, error) {
+	var version int
+	err := tx.Get(&version, `UPDATE restaurant_tables
+		SET qr_version = qr_version + 1,
+		    qr_token = replace(gen_random_uuid()::TEXT || gen_random_uuid()::TEXT, '-', ''),
+		    updated_at = NOW()
+		WHERE id = $1
+		RETURNING qr_version`, tableID)
+	return version, err
+}
+
+func ArchiveDiningTable(tx *sqlx.Tx, tableID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE restaurant_tables SET archived_at = NOW() WHERE id = $1`, tableID)
+	return err
+}
+
+// LargestUpcomingParty returns the biggest party holding the table from now
+// on, or 0 if it has no live reservations left
+func LargestUpcomingParty(tx *sqlx.Tx, tableID uuid.UUID) (int, error) {
+	var size int
+	err := tx.Get(&size, `SELECT COALESCE(MAX(party_size), 0) FROM reservations
+		WHERE table_id = $1 AND status IN ('booked', 'seated') AND ends_at > NOW()`, tableID)
+	return size, err
+}
+
+// HasBookedReservation reports whether a booked reservation holds the table
+// at any time in [from, to)
+func HasBookedReservation(tx *sqlx.Tx, tableID uuid.UUID, from, to time.Time) (bool, error) {
+	var booked bool
+	err := tx.Get(&booked, `SELECT EXISTS (SELECT 1 FROM reservations
+		WHERE table_id = $1 AND status = 'booked' AND tstzrange(starts_at, ends_at) && tstzrange($2, $3))`, tableID, from, to)
+	return booked, err
+}
+
+// FindFreeTable returns the smallest table that seats the party and has no
+// live reservation overlapping [from, to). The table is share locked so it
+// cannot be resized or removed before the booking commits; overlapping
+// bookings racing for it are stopped by the exclusion constraint.
+func FindFreeTable(tx *sqlx.Tx, restaurantID uuid.UUID, partySize int, from, to time.Time) (*models.DiningTable, error) {
+	var table models.DiningTable
+	err := tx.Get(&table, `SELECT t.id, t.restaurant_id, t.name, t.capacity, t.qr_version, t.qr_token, t.created_at, t.updated_at, t.archived_at
+		FROM restaurant_tables t
+		WHERE t.restaurant_id = $1 AND t.capacity >= $2 AND t.archived_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM reservations r
+		                  WHERE r.table_id = t.id AND r.status IN ('booked', 'seated')
+		                    AND tstzrange(r.starts_at, r.ends_at) && tstzrange($3, $4))
+		ORDER BY t.capacity, t.name
+		LIMIT 1
+		FOR SHARE OF t`, restaurantID, partySize, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+const reservationSelect = `SELECT r.id, r.restaurant_id, r.table_id, t.name AS table_name, r.user_id, r.party_size,
+		r.starts_at, r.ends_at, r.status, r.notes, r.created_at, r.updated_at
+	FROM reservations r
+	JOIN restaurant_tables t ON t.id = r.table_id`
+
+func CreateReservation(tx *sqlx.Tx, reservation models.Reservation) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO reservations (id, restaurant_id, table_id, user_id, party_size, starts_at, ends_at, status, notes)
+		VALUES (:id, :restaurant_id, :table_id, :user_id, :party_size, :starts_at, :ends_at, :status, :notes)`, &reservation)
+	return err
+}
+
+func GetReservation(db sqlx.Queryer, reservationID uuid.UUID) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := sqlx.Get(db, &reservation, reservationSelect+` WHERE r.id = $1`, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// GetReservationForUpdate locks the reservation row for the rest of the transaction
+func GetReservationForUpdate(tx *sqlx.Tx, reservationID uuid.UUID) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := tx.Get(&reservation, reservationSelect+` WHERE r.id = $1 FOR UPDATE OF r`, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+func UpdateReservationStatus(tx *sqlx.Tx, reservationID uuid.UUID, status models.ReservationStatus) error {
+	_, err := tx.Exec(`UPDATE reservations SET status = $2, updated_at = NOW() WHERE id = $1`, reservationID, status)
+	return err
+}
+
+// ListUserReservations returns a customer's reservations, latest first
+func ListUserReservations(db *sqlx.DB, userID uuid.UUID) ([]models.Reservation, error) {
+	reservations := make([]models.Reservation, 0)
+	err := db.Select(&reservations, reservationSelect+`
+		WHERE r.user_id = $1
+		ORDER BY r.starts_at DESC`, userID)
+	return reservations, err
+}
+
+// ListRestaurantReservations returns every reservation at the restaurant
+// overlapping [from, to), in the order they start
+func ListRestaurantReservations(db *sqlx.DB, restaurantID uuid.UUID, from, to time.Time) ([]models.Reservation, error) {
+	reservations := make([]models.Reservation, 0)
+	err := db.Select(&reservations, reservationSelect+`
+		WHERE r.restaurant_id = $1 AND r.starts_at < $3 AND r.ends_at > $2
+		ORDER BY r.starts_at, t.name`, restaurantID, from, to)
+	return reservations, err
+}
+
+const sessionColumns = `id, restaurant_id, table_id, party_size, reservation_id, seated_at, cleared_at`
+
+// CreateTableSession seats a party. It fails with a unique violation if the
+// table is still occupied.
+func CreateTableSession(tx *sqlx.Tx, session models.TableSession) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO table_sessions (id, restaurant_id, table_id, party_size, reservation_id)
+		VALUES (:id, :restaurant_id, :table_id, :party_size, :reservation_id)`, &session)
+	return err
+}
+
+// GetOpenTableSessionForUpdate locks the session of the party sitting at the table
+func GetOpenTableSessionForUpdate(tx *sqlx.Tx, tableID uuid.UUID) (*models.TableSession, error) {
+	var session models.TableSession
+	err := tx.Get(&session, `SELECT `+sessionColumns+` FROM table_sessions
+		WHERE table_id = $1 AND cleared_at IS NULL
+		FOR UPDATE`, tableID)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func ListOpenTableSessions(db *sqlx.DB, restaurantID uuid.UUID) ([]models.TableSession, error) {
+	sessions := make([]models.TableSession, 0)
+	err := db.Select(&sessions, `SELECT `+sessionColumns+` FROM table_sessions
+		WHERE restaurant_id = $1 AND cleared_at IS NULL`, restaurantID)
+	return sessions, err
+}
+
+// ClearTableSession frees the table
+func ClearTableSession(tx *sqlx.Tx, sessionID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE table_sessions SET cleared_at = NOW() WHERE id = $1 AND cleared_at IS NULL`, sessionID)
+	return err
+}
+
+// ClearReservationSession frees the table a reservation's party sat at, if
+// it has not been cleared already
+func ClearReservationSession(tx *sqlx.Tx, reservationID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE table_sessions SET cleared_at = NOW() WHERE reservation_id = $1 AND cleared_at IS NULL`, reservationID)
+	return err
+}
+
+// AverageTableTurnover returns how long parties sat at the restaurant's
+// tables on average since the time, or false without any history
+func AverageTableTurnover(db *sqlx.DB, restaurantID uuid.UUID, since time.Time) (time.Duration, bool, error) {
+	var seconds *float64
+	err := db.Get(&seconds, `SELECT EXTRACT(EPOCH FROM AVG(cleared_at - seated_at))::DOUBLE PRECISION
+		FROM table_sessions
+		WHERE restaurant_id = $1 AND cleared_at >= $2`, restaurantID, since)
+	if err != nil || seconds == nil {
+		return 0, false, err
+	}
+	return time.Duration(*seconds * float64(time.Second)), true, nil
+}
@@ -1,28 +1,44 @@
 package dbHelper
 
 import (
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"new_restaurant/models"
+	"new_restaurant/utils"
+	"strings"
 )
 
 func CreateRestaurant(db *sqlx.DB, restaurant models.Restaurant) error {
-	query := `INSERT INTO restaurant (id, name, address, latitude, longitude, created_by, rating) 
-				VALUES ( :id, :name, :address, :latitude, :longitude, :created_by, :rating)`
+	query := `INSERT INTO restaurant (id, name, address, latitude, longitude, geohash, created_by, rating, currency, delivery_fee) 
+				VALUES ( :id, :name, :address, :latitude, :longitude, :geohash, :created_by, :rating, :currency, :delivery_fee)`
 	_, err := db.NamedExec(query, restaurant)
 	return err
 }
 
 func CreateDish(db *sqlx.DB, dish models.Dish) error {
-	query := `INSERT INTO dishes (id, restaurant_id, name, description, price, created_by) 
-				VALUES(:id, :restaurant_id, :name, :description, :price, :created_by)`
+	query := `INSERT INTO dishes (id, restaurant_id, name, description, price, category, created_by) 
+				VALUES(:id, :restaurant_id, :name, :description, :price, :category, :created_by)`
 	_, err := db.NamedExec(query, dish)
 	return err
 }
 
+// GetDishByID returns a dish that is still on its restaurant's menu
+func GetDishByID(db *sqlx.DB, dishID uuid.UUID) (*models.Dish, error) {
+	var dish models.Dish
+	err := db.Get(&dish, `SELECT d.id, d.restaurant_id, d.name, d.description, d.price, d.category, d.created_by
+		FROM dishes d
+		JOIN restaurant r ON r.id = d.restaurant_id
+		WHERE d.id = $1 AND d.archived_at IS NULL AND r.archived_at IS NULL`, dishID)
+	if err != nil {
+		return nil, err
+	}
+	return &dish, nil
+}
+
 func ListAllDishByRestaurant(db *sqlx.DB, restaurantID uuid.UUID) ([]models.Dish, error) {
 	const query = `
-		SELECT id, restaurant_id, name, description, price, created_by
+		SELECT id, restaurant_id, name, description, price, category, created_by
 		FROM dishes
 		WHERE restaurant_id = $1 AND archived_at IS NULL;`
 
@@ -33,7 +49,7 @@ func ListAllDishByRestaurant(db *sqlx.DB, restaurantID uuid.UUID) ([]models.Dish
 
 func ListAllRestaurant(db *sqlx.DB) ([]models.Restaurant, error) {
 	const query = `
-		SELECT ID,name, address, latitude, longitude, created_by, rating
+		SELECT ID,name, address, latitude, longitude, created_by, rating, currency, delivery_fee
 		FROM restaurant
 		WHERE archived_at IS NULL;`
 
@@ -44,10 +60,10 @@ func ListAllRestaurant(db *sqlx.DB) ([]models.Restaurant, error) {
 
 func ListAllRestaurantBySubAdmin(db *sqlx.DB) ([]models.Restaurant, error) {
 	const query = `
-		SELECT r.id, r.name, r.address, r.latitude, r.longitude, r.created_by, r.rating
+		SELECT r.id, r.name, r.address, r.latitude, r.longitude, r.created_by, r.rating, r.currency, r.delivery_fee
 		FROM restaurant r
 		JOIN user_role ur ON r.created_by = ur.user_id
-		WHERE ur.role_type = 'sub_admin' AND r.archived_at IS NULL;`
+		WHERE ur.role_type = 'sub_admin' AND ur.archived_at IS NULL AND r.archived_at IS NULL;`
 
 	var restaurants []models.Restaurant
 	err := db.Select(&restaurants, query)
@@ -56,7 +72,7 @@ func ListAllRestaurantBySubAdmin(db *sqlx.DB) ([]models.Restaurant, error) {
 
 func GetRestaurantByID(db *sqlx.DB, restaurantID string) (*models.Restaurant, error) {
 	var restaurant models.Restaurant
-	query := `SELECT id, name, address, latitude, longitude, rating, created_by
+	query := `SELECT id, name, address, latitude, longitude, rating, currency, delivery_fee, created_by
 	          FROM restaurant 
 	          WHERE id = $1 AND archived_at IS NULL`
 	err := db.Get(&restaurant, query, restaurantID)
@@ -66,14 +82,49 @@ func GetRestaurantByID(db *sqlx.DB, restaurantID string) (*models.Restaurant, er
 	return &restaurant, nil
 }
 
-func GetUserAddress(db *sqlx.DB, addressID string) (*models.UserAddress, error) {
-	var address models.UserAddress
-	query := `SELECT id, user_id, address, latitude, longitude
-	          FROM user_address 
-	          WHERE id = $1 `
-	err := db.Get(&address, query, addressID)
+func UpdateRestaurant(db *sqlx.DB, restaurant models.Restaurant) error {
+	_, err := db.NamedExec(`UPDATE restaurant
+		SET name = :name, address = :address, latitude = :latitude, longitude = :longitude,
+		    geohash = :geohash, rating = :rating, delivery_fee = :delivery_fee
+		WHERE id = :id AND archived_at IS NULL`, restaurant)
+	return err
+}
+
+// ListRestaurantsInGeohashCells returns restaurants whose geohash starts with
+// any of the given cells; callers still filter by exact distance
+func ListRestaurantsInGeohashCells(db *sqlx.DB, cells []string) ([]models.Restaurant, error) {
+	conditions := make([]string, 0, len(cells))
+	args := make([]interface{}, 0, len(cells))
+	for i, cell := range cells {
+		conditions = append(conditions, fmt.Sprintf("geohash LIKE $%d", i+1))
+		args = append(args, cell+"%")
+	}
+
+	query := `SELECT id, name, address, latitude, longitude, geohash, created_by, rating, currency, delivery_fee
+		FROM restaurant
+		WHERE archived_at IS NULL AND (` + strings.Join(conditions, " OR ") + `)`
+
+	restaurants := make([]models.Restaurant, 0)
+	err := db.Select(&restaurants, query, args...)
+	return restaurants, err
+}
+
+// BackfillRestaurantGeohashes fills the geohash of restaurants created before
+// the column existed
+func BackfillRestaurantGeohashes(db *sqlx.DB) error {
+	var restaurants []models.Restaurant
+	err := db.Select(&restaurants, `SELECT id, latitude, longitude
+		FROM restaurant
+		WHERE geohash IS NULL AND latitude IS NOT NULL AND longitude IS NOT NULL`)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	for _, restaurant := range restaurants {
+		hash := utils.EncodeGeohash(*restaurant.Latitude, *restaurant.Longitude, utils.GeohashPrecision)
+		if _, err := db.Exec(`UPDATE restaurant SET geohash = $2 WHERE id = $1`, restaurant.ID, hash); err != nil {
+			return err
+		}
 	}
-	return &address, nil
+	return nil
 }
@@ -0,0 +1,116 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+	"time"
+)
+
+// GetRestaurantSchedule returns a restaurant's pre-order settings and opening
+// hours. A restaurant that was never configured gets the default settings and
+// no hours.
+func GetRestaurantSchedule(db sqlx.Queryer, restaurantID uuid.UUID) (*models.RestaurantSchedule, error) {
+	var schedule models.RestaurantSchedule
+	err := sqlx.Get(db, &schedule.ScheduleSettings, `SELECT r.id AS restaurant_id,
+			COALESCE(s.timezone, 'Asia/Kolkata') AS timezone,
+			COALESCE(s.slot_minutes, 30) AS slot_minutes,
+			s.slot_capacity,
+			COALESCE(s.prep_lead_minutes, 30) AS prep_lead_minutes,
+			COALESCE(s.max_days_ahead, 7) AS max_days_ahead,
+			COALESCE(s.reservation_minutes, 90) AS reservation_minutes,
+			s.updated_at
+		FROM restaurant r
+		LEFT JOIN restaurant_schedule_settings s ON s.restaurant_id = r.id
+		WHERE r.id = $1`, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Hours = make([]models.OpeningHours, 0)
+	err = sqlx.Select(db, &schedule.Hours, `SELECT id, restaurant_id, weekday,
+			to_char(opens_at, 'HH24:MI') AS opens_at, to_char(closes_at, 'HH24:MI') AS closes_at
+		FROM restaurant_opening_hours
+		WHERE restaurant_id = $1
+		ORDER BY weekday, opens_at`, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ReplaceRestaurantSchedule stores new settings and opening hours. Orders
+// already scheduled keep their slots.
+func ReplaceRestaurantSchedule(tx *sqlx.Tx, schedule models.RestaurantSchedule) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO restaurant_schedule_settings (restaurant_id, timezone, slot_minutes, slot_capacity, prep_lead_minutes, max_days_ahead,
+		                                          reservation_minutes)
+		VALUES (:restaurant_id, :timezone, :slot_minutes, :slot_capacity, :prep_lead_minutes, :max_days_ahead,
+		        :reservation_minutes)
+		ON CONFLICT (restaurant_id) DO UPDATE
+		SET timezone = EXCLUDED.timezone,
+		    slot_minutes = EXCLUDED.slot_minutes,
+		    slot_capacity = EXCLUDED.slot_capacity,
+		    prep_lead_minutes = EXCLUDED.prep_lead_minutes,
+		    max_days_ahead = EXCLUDED.max_days_ahead,
+		    reservation_minutes = EXCLUDED.reservation_minutes,
+		    updated_at = NOW()`, &schedule.ScheduleSettings)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM restaurant_opening_hours WHERE restaurant_id = $1`, schedule.RestaurantID); err != nil {
+		return err
+	}
+	for _, hours := range schedule.Hours {
+		_, err := tx.NamedExec(`
+			INSERT INTO restaurant_opening_hours (id, restaurant_id, weekday, opens_at, closes_at)
+			VALUES (:id, :restaurant_id, :weekday, :opens_at, :closes_at)`, &hours)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockRestaurantSlots serialises slot bookings at a restaurant until the
+// transaction ends, so two orders cannot both take a slot's last place
+func LockRestaurantSlots(tx *sqlx.Tx, restaurantID uuid.UUID) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('slots:' || $1::TEXT))`, restaurantID)
+	return err
+}
+
+// CountSlotOrders returns how many live orders are scheduled for each slot
+// start in [from, to)
+func CountSlotOrders(db sqlx.Queryer, restaurantID uuid.UUID, from, to time.Time) (map[time.Time]int, error) {
+	var rows []struct {
+		ScheduledFor time.Time `db:"scheduled_for"`
+		Count        int       `db:"count"`
+	}
+	err := sqlx.Select(db, &rows, `SELECT scheduled_for, COUNT(*) AS count
+		FROM orders
+		WHERE restaurant_id = $1 AND scheduled_for >= $2 AND scheduled_for < $3
+		  AND status NOT IN ('cancelled', 'rejected') AND archived_at IS NULL
+		GROUP BY scheduled_for`, restaurantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[time.Time]int, len(rows))
+	for _, row := range rows {
+		counts[row.ScheduledFor.UTC()] = row.Count
+	}
+	return counts, nil
+}
+
+// ListOrdersDueForRelease returns the scheduled orders whose kitchen prep
+// should start by now
+func ListOrdersDueForRelease(db *sqlx.DB, now time.Time) ([]uuid.UUID, error) {
+	orderIDs := make([]uuid.UUID, 0)
+	err := db.Select(&orderIDs, `
+		SELECT o.id FROM orders o
+		LEFT JOIN restaurant_schedule_settings s ON s.restaurant_id = o.restaurant_id
+		WHERE o.status = 'scheduled'
+		  AND o.scheduled_for - make_interval(mins => COALESCE(s.prep_lead_minutes, 30)) <= $1
+		ORDER BY o.scheduled_for`, now)
+	return orderIDs, err
+}
@@ -0,0 +1,152 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+const tabSelect = `SELECT tt.id, tt.restaurant_id, tt.table_id, t.name AS table_name, tt.status, tt.opened_at,
+		tt.closed_at, tt.closed_by
+	FROM table_tabs tt
+	JOIN restaurant_tables t ON t.id = tt.table_id`
+
+// OpenTab returns the table's open tab, opening one if there is none. The
+// caller must hold the table's lock.
+func OpenTab(tx *sqlx.Tx, restaurantID, tableID uuid.UUID) (*models.TableTab, error) {
+	_, err := tx.Exec(`INSERT INTO table_tabs (restaurant_id, table_id) VALUES ($1, $2)
+		ON CONFLICT (table_id) WHERE status = 'open' DO NOTHING`, restaurantID, tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tab models.TableTab
+	err = tx.Get(&tab, tabSelect+` WHERE tt.table_id = $1 AND tt.status = 'open'`, tableID)
+	if err != nil {
+		return nil, err
+	}
+	return &tab, nil
+}
+
+func GetTab(db sqlx.Queryer, tabID uuid.UUID) (*models.TableTab, error) {
+	var tab models.TableTab
+	err := sqlx.Get(db, &tab, tabSelect+` WHERE tt.id = $1`, tabID)
+	if err != nil {
+		return nil, err
+	}
+	return &tab, nil
+}
+
+// GetTabForUpdate locks the tab row for the rest of the transaction
+func GetTabForUpdate(tx *sqlx.Tx, tabID uuid.UUID) (*models.TableTab, error) {
+	var tab models.TableTab
+	err := tx.Get(&tab, tabSelect+` WHERE tt.id = $1 FOR UPDATE OF tt`, tabID)
+	if err != nil {
+		return nil, err
+	}
+	return &tab, nil
+}
+
+func ListOpenTabs(db *sqlx.DB, restaurantID uuid.UUID) ([]models.TableTab, error) {
+	tabs := make([]models.TableTab, 0)
+	err := db.Select(&tabs, tabSelect+`
+		WHERE tt.restaurant_id = $1 AND tt.status = 'open'
+		ORDER BY tt.opened_at`, restaurantID)
+	return tabs, err
+}
+
+func CloseTab(tx *sqlx.Tx, tabID, closedBy uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE table_tabs SET status = 'closed', closed_at = NOW(), closed_by = $2 WHERE id = $1`, tabID, closedBy)
+	return err
+}
+
+// ListTabOrders returns the orders placed on a tab, oldest first
+func ListTabOrders(db sqlx.Queryer, tabID uuid.UUID) ([]models.Order, error) {
+	orders := make([]models.Order, 0)
+	err := sqlx.Select(db, &orders, `SELECT `+orderColumns+` FROM orders
+		WHERE tab_id = $1 AND archived_at IS NULL
+		ORDER BY created_at`, tabID)
+	return orders, err
+}
+
+const billShareColumns = `id, tab_id, method, amount, paid_at, voided_at, created_at`
+
+// VoidUnpaidBillShares voids the tab's shares that are unpaid and have no
+// payment in flight, so what they covered can be split again
+func VoidUnpaidBillShares(tx *sqlx.Tx, tabID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE tab_bill_shares s SET voided_at = NOW()
+		WHERE s.tab_id = $1 AND s.paid_at IS NULL AND s.voided_at IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM payments p WHERE p.bill_share_id = s.id AND p.status IN ('pending', 'authorized')
+		  )`, tabID)
+	return err
+}
+
+// ListBillShares returns the tab's shares that are not voided, with their items
+func ListBillShares(db sqlx.Queryer, tabID uuid.UUID) ([]models.BillShare, error) {
+	shares := make([]models.BillShare, 0)
+	err := sqlx.Select(db, &shares, `SELECT `+billShareColumns+` FROM tab_bill_shares
+		WHERE tab_id = $1 AND voided_at IS NULL
+		ORDER BY created_at, id`, tabID)
+	if err != nil || len(shares) == 0 {
+		return shares, err
+	}
+
+	var items []models.BillShareItem
+	err = sqlx.Select(db, &items, `SELECT i.share_id, i.order_item_id, i.quantity, i.amount
+		FROM tab_bill_share_items i
+		JOIN tab_bill_shares s ON s.id = i.share_id
+		WHERE s.tab_id = $1 AND s.voided_at IS NULL`, tabID)
+	if err != nil {
+		return nil, err
+	}
+	byShare := make(map[uuid.UUID][]models.BillShareItem, len(shares))
+	for _, item := range items {
+		byShare[item.ShareID] = append(byShare[item.ShareID], item)
+	}
+	for i := range shares {
+		shares[i].Items = byShare[shares[i].ID]
+	}
+	return shares, nil
+}
+
+// CreateBillShare inserts the share and the items it pays for
+func CreateBillShare(tx *sqlx.Tx, share models.BillShare) error {
+	_, err := tx.NamedExec(`INSERT INTO tab_bill_shares (id, tab_id, method, amount)
+		VALUES (:id, :tab_id, :method, :amount)`, &share)
+	if err != nil {
+		return err
+	}
+	for _, item := range share.Items {
+		_, err := tx.NamedExec(`INSERT INTO tab_bill_share_items (share_id, order_item_id, quantity, amount)
+			VALUES (:share_id, :order_item_id, :quantity, :amount)`, &item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetBillShare(db sqlx.Queryer, shareID uuid.UUID) (*models.BillShare, error) {
+	var share models.BillShare
+	err := sqlx.Get(db, &share, `SELECT `+billShareColumns+` FROM tab_bill_shares WHERE id = $1`, shareID)
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// GetBillShareForUpdate locks the share for the rest of the transaction
+func GetBillShareForUpdate(tx *sqlx.Tx, shareID uuid.UUID) (*models.BillShare, error) {
+	var share models.BillShare
+	err := tx.Get(&share, `SELECT `+billShareColumns+` FROM tab_bill_shares WHERE id = $1 FOR UPDATE`, shareID)
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+func MarkBillSharePaid(tx *sqlx.Tx, shareID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE tab_bill_shares SET paid_at = NOW() WHERE id = $1 AND paid_at IS NULL`, shareID)
+	return err
+}
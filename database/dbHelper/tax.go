@@ -0,0 +1,64 @@
+package dbHelper
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+// GetTaxRules returns a restaurant's tax rules. A restaurant that was never
+// configured charges no tax and no extra fees.
+func GetTaxRules(db sqlx.Queryer, restaurantID uuid.UUID) (*models.TaxRules, error) {
+	rules := models.TaxRules{TaxSettings: models.TaxSettings{RestaurantID: restaurantID}}
+	err := sqlx.Get(db, &rules.TaxSettings, `SELECT r.id AS restaurant_id,
+			COALESCE(s.prices_include_tax, FALSE) AS prices_include_tax,
+			COALESCE(s.service_charge_rate, 0) AS service_charge_rate,
+			COALESCE(s.packaging_fee, ROW(0, r.currency)::money_amount) AS packaging_fee,
+			s.updated_at
+		FROM restaurant r
+		LEFT JOIN restaurant_tax_settings s ON s.restaurant_id = r.id
+		WHERE r.id = $1`, restaurantID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	rules.Rates = make([]models.TaxRate, 0)
+	err = sqlx.Select(db, &rules.Rates, `SELECT id, restaurant_id, category, name, rate, created_at
+		FROM tax_rates
+		WHERE restaurant_id = $1 AND archived_at IS NULL
+		ORDER BY category NULLS FIRST, name`, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// ReplaceTaxRules stores new settings and retires every previous rate. Old
+// orders keep the taxes they were charged.
+func ReplaceTaxRules(tx *sqlx.Tx, rules models.TaxRules) error {
+	_, err := tx.NamedExec(`
+		INSERT INTO restaurant_tax_settings (restaurant_id, prices_include_tax, service_charge_rate, packaging_fee)
+		VALUES (:restaurant_id, :prices_include_tax, :service_charge_rate, :packaging_fee)
+		ON CONFLICT (restaurant_id) DO UPDATE
+		SET prices_include_tax = EXCLUDED.prices_include_tax,
+		    service_charge_rate = EXCLUDED.service_charge_rate,
+		    packaging_fee = EXCLUDED.packaging_fee,
+		    updated_at = NOW()`, &rules.TaxSettings)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE tax_rates SET archived_at = NOW()
+		WHERE restaurant_id = $1 AND archived_at IS NULL`, rules.RestaurantID); err != nil {
+		return err
+	}
+	for _, rate := range rules.Rates {
+		if _, err := tx.NamedExec(`INSERT INTO tax_rates (id, restaurant_id, category, name, rate)
+			VALUES (:id, :restaurant_id, :category, :name, :rate)`, &rate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
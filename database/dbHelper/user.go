@@ -1,8 +1,10 @@
 package dbHelper
 
 import (
+	"errors"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"new_restaurant/models"
 )
 
@@ -20,25 +22,43 @@ func CreateUserRole(tx *sqlx.Tx, role models.UserRole) error {
 	return err
 }
 
-func CreateUserAddress(db *sqlx.DB, address models.UserAddress) error {
-	_, err := db.NamedExec(`
-		INSERT INTO user_address (id, user_id, address, latitude, longitude) 
-		VALUES (:id, :user_id, :address, :latitude, :longitude)`, &address)
-	return err
-}
-
 func GetUserByEmail(db *sqlx.DB, email string) (models.User, error) {
 	var user models.User
 	err := db.Get(&user, "SELECT * FROM users WHERE email = $1 AND archived_at IS NULL", email)
 	return user, err
 }
 
+func GetUserByID(db *sqlx.DB, userID uuid.UUID) (models.User, error) {
+	var user models.User
+	err := db.Get(&user, "SELECT * FROM users WHERE id = $1 AND archived_at IS NULL", userID)
+	return user, err
+}
+
+// GetUserRoleByUserID returns the user's most privileged active role, the one
+// their tokens are issued for
 func GetUserRoleByUserID(db *sqlx.DB, userID uuid.UUID) (models.UserRole, error) {
 	var role models.UserRole
-	err := db.Get(&role, "SELECT * FROM user_role WHERE user_id = $1 AND archived_at IS NULL", userID)
+	err := db.Get(&role, `SELECT * FROM user_role
+		WHERE user_id = $1 AND archived_at IS NULL
+		ORDER BY CASE role_type WHEN 'admin' THEN 0 WHEN 'sub_admin' THEN 1 WHEN 'courier' THEN 2 ELSE 3 END, created_at
+		LIMIT 1`, userID)
 	return role, err
 }
 
+// ListActiveRoles returns the roles an active user holds right now. Users
+// that were deactivated, and sessions that were revoked or logged out, are
+// not found.
+func ListActiveRoles(db *sqlx.DB, userID, sessionID uuid.UUID) ([]string, error) {
+	var roles pq.StringArray
+	err := db.Get(&roles, `SELECT COALESCE(array_agg(ur.role_type::TEXT) FILTER (WHERE ur.id IS NOT NULL), '{}')
+		FROM users u
+		JOIN user_session s ON s.user_id = u.id AND s.id = $2 AND s.archived_at IS NULL
+		LEFT JOIN user_role ur ON ur.user_id = u.id AND ur.archived_at IS NULL
+		WHERE u.id = $1 AND u.archived_at IS NULL
+		GROUP BY u.id`, userID, sessionID)
+	return roles, err
+}
+
 func CreateSession(db *sqlx.DB, session models.Session) error {
 	_, err := db.NamedExec(`INSERT INTO user_session (id, user_id, refresh_token)
         VALUES (:id, :user_id, :refresh_token)`, &session)
@@ -52,7 +72,7 @@ func DeleteSessionByToken(db *sqlx.DB, refreshToken string) error {
 
 func GetSessionByToken(db *sqlx.DB, refreshToken string) (models.Session, error) {
 	var session models.Session
-	err := db.Get(&session, `SELECT * FROM user_session WHERE refresh_token = $1`, refreshToken)
+	err := db.Get(&session, `SELECT * FROM user_session WHERE refresh_token = $1 AND archived_at IS NULL`, refreshToken)
 	return session, err
 }
 
@@ -61,7 +81,7 @@ func ListAllSubAdmins(db *sqlx.DB) ([]models.UserResponse, error) {
 		SELECT u.id, u.name, u.email, ur.role_type
 		FROM users u
 		JOIN user_role ur ON u.id = ur.user_id
-		WHERE ur.role_type = 'sub_admin' AND u.archived_at IS NULL;`
+		WHERE ur.role_type = 'sub_admin' AND ur.archived_at IS NULL AND u.archived_at IS NULL;`
 
 	var subAdmins []models.UserResponse
 	err := db.Select(&subAdmins, query)
@@ -73,9 +93,92 @@ func ListAllUsers(db *sqlx.DB) ([]models.UserResponse, error) {
 		SELECT u.id, u.name, u.email, ur.role_type
 		FROM users u
 		JOIN user_role ur ON u.id = ur.user_id
-		WHERE u.archived_at IS NULL;`
+		WHERE ur.archived_at IS NULL AND u.archived_at IS NULL;`
 
 	var user []models.UserResponse
 	err := db.Select(&user, query)
 	return user, err
 }
+
+// IsUniqueViolation reports whether err is a postgres unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// GetUserRoles returns every role row of a user, including revoked ones, oldest first
+func GetUserRoles(db *sqlx.DB, userID uuid.UUID) ([]models.UserRole, error) {
+	roles := make([]models.UserRole, 0)
+	err := db.Select(&roles, `SELECT id, user_id, role_type, created_at, archived_at
+		FROM user_role
+		WHERE user_id = $1
+		ORDER BY created_at`, userID)
+	return roles, err
+}
+
+// UpdateUser changes the name and/or email of an active user; nil fields are left untouched
+func UpdateUser(db *sqlx.DB, userID uuid.UUID, name, email *string) (bool, error) {
+	res, err := db.Exec(`UPDATE users SET name = COALESCE($2, name), email = COALESCE($3, email)
+		WHERE id = $1 AND archived_at IS NULL`, userID, name, email)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+func ArchiveUser(tx *sqlx.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE users SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL`, userID)
+	return err
+}
+
+func ArchiveUserSessions(tx *sqlx.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE user_session SET archived_at = NOW() WHERE user_id = $1 AND archived_at IS NULL`, userID)
+	return err
+}
+
+// LockActiveAdmins locks the active admin role rows and returns their user ids,
+// so concurrent demotions cannot both pass the last-admin check
+func LockActiveAdmins(tx *sqlx.Tx) ([]uuid.UUID, error) {
+	var userIDs []uuid.UUID
+	err := tx.Select(&userIDs, `SELECT ur.user_id
+		FROM user_role ur
+		JOIN users u ON u.id = ur.user_id
+		WHERE ur.role_type = 'admin' AND ur.archived_at IS NULL AND u.archived_at IS NULL
+		FOR UPDATE OF ur`)
+	return userIDs, err
+}
+
+func GetActiveRoleTypes(tx *sqlx.Tx, userID uuid.UUID) ([]models.RoleType, error) {
+	var roles []models.RoleType
+	err := tx.Select(&roles, `SELECT role_type FROM user_role
+		WHERE user_id = $1 AND archived_at IS NULL
+		FOR UPDATE`, userID)
+	return roles, err
+}
+
+func ArchiveUserRole(tx *sqlx.Tx, userID uuid.UUID, role models.RoleType) error {
+	_, err := tx.Exec(`UPDATE user_role SET archived_at = NOW()
+		WHERE user_id = $1 AND role_type = $2 AND archived_at IS NULL`, userID, role)
+	return err
+}
+
+func ListActiveSessions(db *sqlx.DB, userID uuid.UUID) ([]models.Session, error) {
+	sessions := make([]models.Session, 0)
+	err := db.Select(&sessions, `SELECT id, user_id, refresh_token, created_at
+		FROM user_session
+		WHERE user_id = $1 AND archived_at IS NULL
+		ORDER BY created_at DESC`, userID)
+	return sessions, err
+}
+
+// ArchiveUserSession revokes one of the user's own sessions and reports whether it existed
+func ArchiveUserSession(db *sqlx.DB, userID, sessionID uuid.UUID) (bool, error) {
+	res, err := db.Exec(`UPDATE user_session SET archived_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND archived_at IS NULL`, sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
@@ -0,0 +1,61 @@
+package dbHelper
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"new_restaurant/models"
+)
+
+const waitlistColumns = `id, restaurant_id, party_name, party_size, phone, notes, status, token, table_session_id,
+	created_by, created_at, notified_at, updated_at`
+
+func CreateWaitlistEntry(db *sqlx.DB, entry models.WaitlistEntry) error {
+	_, err := db.NamedExec(`
+		INSERT INTO waitlist_entries (id, restaurant_id, party_name, party_size, phone, notes, status, token, created_by)
+		VALUES (:id, :restaurant_id, :party_name, :party_size, :phone, :notes, :status, :token, :created_by)`, &entry)
+	return err
+}
+
+func GetWaitlistEntry(db *sqlx.DB, entryID uuid.UUID) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := db.Get(&entry, `SELECT `+waitlistColumns+` FROM waitlist_entries WHERE id = $1`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func GetWaitlistEntryByToken(db *sqlx.DB, token string) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := db.Get(&entry, `SELECT `+waitlistColumns+` FROM waitlist_entries WHERE token = $1`, token)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetWaitlistEntryForUpdate locks the entry row for the rest of the transaction
+func GetWaitlistEntryForUpdate(tx *sqlx.Tx, entryID uuid.UUID) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := tx.Get(&entry, `SELECT `+waitlistColumns+` FROM waitlist_entries WHERE id = $1 FOR UPDATE`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ListActiveWaitlist returns the parties still waiting at the restaurant, in queue order
+func ListActiveWaitlist(db *sqlx.DB, restaurantID uuid.UUID) ([]models.WaitlistEntry, error) {
+	entries := make([]models.WaitlistEntry, 0)
+	err := db.Select(&entries, `SELECT `+waitlistColumns+` FROM waitlist_entries
+		WHERE restaurant_id = $1 AND status IN ('waiting', 'notified')
+		ORDER BY created_at, id`, restaurantID)
+	return entries, err
+}
+
+func UpdateWaitlistEntry(tx *sqlx.Tx, entry models.WaitlistEntry) error {
+	_, err := tx.NamedExec(`UPDATE waitlist_entries
+		SET status = :status, table_session_id = :table_session_id, notified_at = :notified_at, updated_at = NOW()
+		WHERE id = :id`, &entry)
+	return err
+}
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+                                        id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                        user_id UUID REFERENCES users(id) NOT NULL,
+                                        secret TEXT NOT NULL,
+                                        last_used_step BIGINT NOT NULL DEFAULT 0,
+                                        enabled_at TIMESTAMP WITH TIME ZONE,
+                                        created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                        archived_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_mfa_active_user_idx ON user_mfa (user_id) WHERE archived_at IS NULL;
+
+
+CREATE TABLE IF NOT EXISTS user_mfa_recovery_code (
+                                                      id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                      user_id UUID REFERENCES users(id) NOT NULL,
+                                                      code_hash TEXT NOT NULL,
+                                                      used_at TIMESTAMP WITH TIME ZONE,
+                                                      created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                                      archived_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS user_mfa_recovery_code_hash_idx ON user_mfa_recovery_code (code_hash);
@@ -0,0 +1,8 @@
+CREATE TYPE address_label AS ENUM ('home', 'work', 'other');
+
+ALTER TABLE user_address
+    ADD COLUMN IF NOT EXISTS label address_label NOT NULL DEFAULT 'other',
+    ADD COLUMN IF NOT EXISTS is_default BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- a user has at most one default address among the ones not deleted
+CREATE UNIQUE INDEX IF NOT EXISTS user_address_default_idx ON user_address (user_id) WHERE is_default AND archived_at IS NULL;
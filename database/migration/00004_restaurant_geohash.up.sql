@@ -0,0 +1,4 @@
+ALTER TABLE restaurant ADD COLUMN IF NOT EXISTS geohash TEXT;
+
+-- text_pattern_ops lets prefix searches (geohash LIKE 'tsq4%') use the index
+CREATE INDEX IF NOT EXISTS restaurant_geohash_idx ON restaurant (geohash text_pattern_ops) WHERE archived_at IS NULL;
@@ -0,0 +1,74 @@
+CREATE TYPE order_status AS ENUM (
+    'pending_payment',
+    'placed',
+    'accepted',
+    'rejected',
+    'preparing',
+    'ready',
+    'out_for_delivery',
+    'delivered',
+    'cancelled'
+);
+
+
+CREATE TABLE IF NOT EXISTS orders (
+                                      id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                      user_id UUID REFERENCES users(id) NOT NULL,
+                                      restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                      user_address_id UUID REFERENCES user_address(id),
+                                      status order_status NOT NULL DEFAULT 'pending_payment',
+                                      subtotal NUMERIC(10,2) NOT NULL,
+                                      total NUMERIC(10,2) NOT NULL,
+                                      created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                      updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                      archived_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_idx ON orders (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS orders_restaurant_idx ON orders (restaurant_id, created_at DESC);
+
+
+CREATE TABLE IF NOT EXISTS order_items (
+                                           id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                           order_id UUID REFERENCES orders(id) NOT NULL,
+                                           dish_id UUID REFERENCES dishes(id) NOT NULL,
+                                           name TEXT NOT NULL,
+                                           unit_price NUMERIC(10,2) NOT NULL,
+                                           quantity INTEGER NOT NULL CHECK (quantity > 0),
+                                           created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS order_items_order_idx ON order_items (order_id);
+
+
+CREATE TYPE payment_status AS ENUM ('pending', 'authorized', 'captured', 'failed', 'cancelled');
+
+
+CREATE TABLE IF NOT EXISTS payments (
+                                        id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                        order_id UUID REFERENCES orders(id) NOT NULL,
+                                        provider TEXT NOT NULL,
+                                        provider_ref TEXT,
+                                        amount BIGINT NOT NULL CHECK (amount > 0), -- minor units
+                                        currency CHAR(3) NOT NULL,
+                                        status payment_status NOT NULL DEFAULT 'pending',
+                                        idempotency_key TEXT NOT NULL UNIQUE,
+                                        failure_reason TEXT,
+                                        created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                        updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payments_order_idx ON payments (order_id);
+CREATE UNIQUE INDEX IF NOT EXISTS payments_provider_ref_idx ON payments (provider, provider_ref);
+
+
+-- every webhook delivery is recorded once so redeliveries are acknowledged without being re-applied
+CREATE TABLE IF NOT EXISTS payment_webhook_event (
+                                                     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                     provider TEXT NOT NULL,
+                                                     event_id TEXT NOT NULL,
+                                                     event_type TEXT NOT NULL,
+                                                     payload JSONB NOT NULL,
+                                                     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                                     UNIQUE (provider, event_id)
+);
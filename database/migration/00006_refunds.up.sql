@@ -0,0 +1,41 @@
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS refunded_quantity INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE order_items
+    ADD CONSTRAINT order_items_refunded_quantity_check CHECK (refunded_quantity >= 0 AND refunded_quantity <= quantity);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS refunded_total NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+
+CREATE TYPE refund_status AS ENUM ('pending', 'succeeded', 'failed');
+
+
+-- refund ledger: one row per refund issued against a payment
+CREATE TABLE IF NOT EXISTS refunds (
+                                       id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                       order_id UUID REFERENCES orders(id) NOT NULL,
+                                       payment_id UUID REFERENCES payments(id) NOT NULL,
+                                       amount BIGINT NOT NULL CHECK (amount > 0), -- minor units
+                                       currency CHAR(3) NOT NULL,
+                                       reason TEXT,
+                                       status refund_status NOT NULL DEFAULT 'pending',
+                                       provider_ref TEXT,
+                                       idempotency_key TEXT NOT NULL UNIQUE,
+                                       created_by UUID REFERENCES users(id) NOT NULL,
+                                       created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                       updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_order_idx ON refunds (order_id);
+
+
+CREATE TABLE IF NOT EXISTS refund_items (
+                                            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                            refund_id UUID REFERENCES refunds(id) NOT NULL,
+                                            order_item_id UUID REFERENCES order_items(id) NOT NULL,
+                                            quantity INTEGER NOT NULL CHECK (quantity > 0),
+                                            amount BIGINT NOT NULL -- minor units
+);
+
+CREATE INDEX IF NOT EXISTS refund_items_refund_idx ON refund_items (refund_id);
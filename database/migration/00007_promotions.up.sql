@@ -0,0 +1,53 @@
+ALTER TABLE restaurant
+    ADD COLUMN IF NOT EXISTS delivery_fee NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (delivery_fee >= 0);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS delivery_fee NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS discount_total NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+
+CREATE TYPE promotion_type AS ENUM ('percentage', 'flat', 'free_delivery', 'bogo');
+
+
+-- promotions without a code are applied automatically to every eligible cart
+CREATE TABLE IF NOT EXISTS promotions (
+                                          id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                          code TEXT UNIQUE,
+                                          name TEXT NOT NULL,
+                                          type promotion_type NOT NULL,
+                                          percent_off NUMERIC(5,2) CHECK (percent_off > 0 AND percent_off <= 100),
+                                          amount_off NUMERIC(10,2) CHECK (amount_off > 0),
+                                          max_discount NUMERIC(10,2) CHECK (max_discount > 0),
+                                          restaurant_id UUID REFERENCES restaurant(id),
+                                          min_order_value NUMERIC(10,2) NOT NULL DEFAULT 0,
+                                          starts_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                          ends_at TIMESTAMP WITH TIME ZONE,
+                                          usage_limit INTEGER CHECK (usage_limit > 0),
+                                          per_user_limit INTEGER CHECK (per_user_limit > 0),
+                                          created_by UUID REFERENCES users(id) NOT NULL,
+                                          created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                          archived_at TIMESTAMP WITH TIME ZONE
+);
+
+
+-- dishes a bogo promotion applies to
+CREATE TABLE IF NOT EXISTS promotion_dishes (
+                                                promotion_id UUID REFERENCES promotions(id) NOT NULL,
+                                                dish_id UUID REFERENCES dishes(id) NOT NULL,
+                                                PRIMARY KEY (promotion_id, dish_id)
+);
+
+
+-- one row per promotion applied to an order; also the order's discount breakdown
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+                                                     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                     promotion_id UUID REFERENCES promotions(id) NOT NULL,
+                                                     user_id UUID REFERENCES users(id) NOT NULL,
+                                                     order_id UUID REFERENCES orders(id) NOT NULL,
+                                                     name TEXT NOT NULL,
+                                                     amount NUMERIC(10,2) NOT NULL,
+                                                     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS promotion_redemptions_promotion_idx ON promotion_redemptions (promotion_id, user_id);
+CREATE INDEX IF NOT EXISTS promotion_redemptions_order_idx ON promotion_redemptions (order_id);
@@ -0,0 +1,51 @@
+ALTER TABLE dishes
+    ADD COLUMN IF NOT EXISTS category TEXT;
+
+
+CREATE TABLE IF NOT EXISTS restaurant_tax_settings (
+                                                       restaurant_id UUID PRIMARY KEY REFERENCES restaurant(id),
+                                                       prices_include_tax BOOLEAN NOT NULL DEFAULT FALSE,
+                                                       service_charge_rate NUMERIC(6,3) NOT NULL DEFAULT 0 CHECK (service_charge_rate >= 0 AND service_charge_rate <= 100),
+                                                       packaging_fee NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (packaging_fee >= 0),
+                                                       updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+
+-- rates without a category apply to dishes whose category has no rates of its own
+CREATE TABLE IF NOT EXISTS tax_rates (
+                                         id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                         restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                         category TEXT,
+                                         name TEXT NOT NULL,
+                                         rate NUMERIC(6,3) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+                                         created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                         archived_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS tax_rates_restaurant_idx ON tax_rates (restaurant_id) WHERE archived_at IS NULL;
+
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS packaging_fee NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS service_charge NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_total NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS prices_include_tax BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS category TEXT,
+    ADD COLUMN IF NOT EXISTS discount_amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS line_total NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+UPDATE order_items SET line_total = unit_price * quantity WHERE line_total = 0;
+
+
+CREATE TABLE IF NOT EXISTS order_item_taxes (
+                                                id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                order_item_id UUID REFERENCES order_items(id) NOT NULL,
+                                                name TEXT NOT NULL,
+                                                rate NUMERIC(6,3) NOT NULL,
+                                                amount NUMERIC(10,2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS order_item_taxes_item_idx ON order_item_taxes (order_item_id);
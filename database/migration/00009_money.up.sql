@@ -0,0 +1,70 @@
+-- money is stored as minor units plus the ISO 4217 currency it is counted in
+CREATE TYPE money_amount AS (amount BIGINT, currency CHAR(3));
+
+ALTER TABLE restaurant
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'INR';
+
+
+-- every existing amount was charged in INR, which has two minor unit digits
+CREATE FUNCTION inr_money_amount(value NUMERIC) RETURNS money_amount AS $$
+    SELECT CASE WHEN value IS NULL THEN NULL ELSE ROW(ROUND(value * 100)::BIGINT, 'INR')::money_amount END
+$$ LANGUAGE SQL IMMUTABLE;
+
+
+ALTER TABLE restaurant DROP CONSTRAINT IF EXISTS restaurant_delivery_fee_check;
+ALTER TABLE restaurant ALTER COLUMN delivery_fee DROP DEFAULT;
+ALTER TABLE restaurant ALTER COLUMN delivery_fee TYPE money_amount USING inr_money_amount(delivery_fee);
+ALTER TABLE restaurant ADD CONSTRAINT restaurant_delivery_fee_check CHECK ((delivery_fee).amount >= 0);
+
+ALTER TABLE dishes ALTER COLUMN price TYPE money_amount USING inr_money_amount(price);
+ALTER TABLE dishes ADD CONSTRAINT dishes_price_check CHECK ((price).amount >= 0);
+
+ALTER TABLE orders ALTER COLUMN delivery_fee DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN packaging_fee DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN service_charge DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN discount_total DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN tax_total DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN refunded_total DROP DEFAULT;
+ALTER TABLE orders
+    ALTER COLUMN subtotal TYPE money_amount USING inr_money_amount(subtotal),
+    ALTER COLUMN delivery_fee TYPE money_amount USING inr_money_amount(delivery_fee),
+    ALTER COLUMN packaging_fee TYPE money_amount USING inr_money_amount(packaging_fee),
+    ALTER COLUMN service_charge TYPE money_amount USING inr_money_amount(service_charge),
+    ALTER COLUMN discount_total TYPE money_amount USING inr_money_amount(discount_total),
+    ALTER COLUMN tax_total TYPE money_amount USING inr_money_amount(tax_total),
+    ALTER COLUMN total TYPE money_amount USING inr_money_amount(total),
+    ALTER COLUMN refunded_total TYPE money_amount USING inr_money_amount(refunded_total);
+
+ALTER TABLE order_items ALTER COLUMN discount_amount DROP DEFAULT;
+ALTER TABLE order_items ALTER COLUMN tax_amount DROP DEFAULT;
+ALTER TABLE order_items ALTER COLUMN line_total DROP DEFAULT;
+ALTER TABLE order_items
+    ALTER COLUMN unit_price TYPE money_amount USING inr_money_amount(unit_price),
+    ALTER COLUMN discount_amount TYPE money_amount USING inr_money_amount(discount_amount),
+    ALTER COLUMN tax_amount TYPE money_amount USING inr_money_amount(tax_amount),
+    ALTER COLUMN line_total TYPE money_amount USING inr_money_amount(line_total);
+
+ALTER TABLE order_item_taxes ALTER COLUMN amount TYPE money_amount USING inr_money_amount(amount);
+
+-- promotions without a minimum no longer store a zero in some currency
+ALTER TABLE promotions DROP CONSTRAINT IF EXISTS promotions_amount_off_check;
+ALTER TABLE promotions DROP CONSTRAINT IF EXISTS promotions_max_discount_check;
+ALTER TABLE promotions ALTER COLUMN min_order_value DROP DEFAULT;
+ALTER TABLE promotions ALTER COLUMN min_order_value DROP NOT NULL;
+UPDATE promotions SET min_order_value = NULL WHERE min_order_value = 0;
+ALTER TABLE promotions
+    ALTER COLUMN amount_off TYPE money_amount USING inr_money_amount(amount_off),
+    ALTER COLUMN max_discount TYPE money_amount USING inr_money_amount(max_discount),
+    ALTER COLUMN min_order_value TYPE money_amount USING inr_money_amount(min_order_value);
+ALTER TABLE promotions
+    ADD CONSTRAINT promotions_amount_off_check CHECK ((amount_off).amount > 0),
+    ADD CONSTRAINT promotions_max_discount_check CHECK ((max_discount).amount > 0);
+
+ALTER TABLE promotion_redemptions ALTER COLUMN amount TYPE money_amount USING inr_money_amount(amount);
+
+ALTER TABLE restaurant_tax_settings DROP CONSTRAINT IF EXISTS restaurant_tax_settings_packaging_fee_check;
+ALTER TABLE restaurant_tax_settings ALTER COLUMN packaging_fee DROP DEFAULT;
+ALTER TABLE restaurant_tax_settings ALTER COLUMN packaging_fee TYPE money_amount USING inr_money_amount(packaging_fee);
+ALTER TABLE restaurant_tax_settings ADD CONSTRAINT restaurant_tax_settings_packaging_fee_check CHECK ((packaging_fee).amount >= 0);
+
+DROP FUNCTION inr_money_amount(NUMERIC);
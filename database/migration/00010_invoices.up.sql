@@ -0,0 +1,28 @@
+-- the last invoice number issued by each restaurant; numbers start at 1
+CREATE TABLE IF NOT EXISTS invoice_counters (
+                                                restaurant_id UUID PRIMARY KEY REFERENCES restaurant(id),
+                                                last_number BIGINT NOT NULL
+);
+
+
+-- an invoice freezes the order totals and the names printed on it when it is
+-- issued, so later refunds or restaurant edits never change it
+CREATE TABLE IF NOT EXISTS invoices (
+                                        id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                        order_id UUID REFERENCES orders(id) NOT NULL UNIQUE,
+                                        restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                        number BIGINT NOT NULL,
+                                        restaurant_name TEXT NOT NULL,
+                                        restaurant_address TEXT NOT NULL,
+                                        customer_name TEXT NOT NULL,
+                                        subtotal money_amount NOT NULL,
+                                        delivery_fee money_amount NOT NULL,
+                                        packaging_fee money_amount NOT NULL,
+                                        service_charge money_amount NOT NULL,
+                                        discount_total money_amount NOT NULL,
+                                        tax_total money_amount NOT NULL,
+                                        prices_include_tax BOOLEAN NOT NULL,
+                                        total money_amount NOT NULL,
+                                        issued_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                        UNIQUE (restaurant_id, number)
+);
@@ -0,0 +1,12 @@
+-- order events in the order they happened, replayed to clients that resume
+-- a stream from the last event id they saw
+CREATE TABLE IF NOT EXISTS order_events (
+                                            id BIGSERIAL PRIMARY KEY,
+                                            order_id UUID REFERENCES orders(id) NOT NULL,
+                                            restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                            type TEXT NOT NULL,
+                                            data JSONB NOT NULL,
+                                            created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS order_events_order_idx ON order_events (order_id, id);
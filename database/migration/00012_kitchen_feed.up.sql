@@ -0,0 +1,2 @@
+-- kitchen screens resume a restaurant's event stream from the last id they saw
+CREATE INDEX IF NOT EXISTS order_events_restaurant_idx ON order_events (restaurant_id, id);
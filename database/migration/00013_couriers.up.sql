@@ -0,0 +1,41 @@
+ALTER TYPE role_type ADD VALUE IF NOT EXISTS 'courier';
+
+
+-- a courier's shift status and last reported position
+CREATE TABLE IF NOT EXISTS couriers (
+                                        user_id UUID PRIMARY KEY REFERENCES users(id),
+                                        available BOOLEAN NOT NULL DEFAULT FALSE,
+                                        latitude DOUBLE PRECISION,
+                                        longitude DOUBLE PRECISION,
+                                        location_updated_at TIMESTAMP WITH TIME ZONE,
+                                        updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+
+CREATE TYPE assignment_status AS ENUM ('offered', 'accepted', 'declined', 'expired', 'cancelled', 'completed');
+
+
+-- every offer of an order to a courier, kept so an order is never offered
+-- twice to the same courier
+CREATE TABLE IF NOT EXISTS delivery_assignments (
+                                                    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                    order_id UUID REFERENCES orders(id) NOT NULL,
+                                                    courier_id UUID REFERENCES users(id) NOT NULL,
+                                                    status assignment_status NOT NULL DEFAULT 'offered',
+                                                    distance_km DOUBLE PRECISION NOT NULL,
+                                                    offered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                                    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                                    responded_at TIMESTAMP WITH TIME ZONE
+);
+
+-- an order has at most one live assignment and a courier works one order at a time
+CREATE UNIQUE INDEX IF NOT EXISTS delivery_assignments_order_active_idx
+    ON delivery_assignments (order_id) WHERE status IN ('offered', 'accepted');
+CREATE UNIQUE INDEX IF NOT EXISTS delivery_assignments_courier_active_idx
+    ON delivery_assignments (courier_id) WHERE status IN ('offered', 'accepted');
+CREATE INDEX IF NOT EXISTS delivery_assignments_expiry_idx
+    ON delivery_assignments (expires_at) WHERE status = 'offered';
+
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS courier_id UUID REFERENCES users(id);
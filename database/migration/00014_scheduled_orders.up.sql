@@ -0,0 +1,33 @@
+-- paid pre-orders wait in 'scheduled' until the kitchen has to start on them
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'scheduled' AFTER 'pending_payment';
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS scheduled_for TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS orders_scheduled_idx ON orders (restaurant_id, scheduled_for) WHERE scheduled_for IS NOT NULL;
+
+
+-- how a restaurant takes pre-orders; restaurants without a row use the defaults
+CREATE TABLE IF NOT EXISTS restaurant_schedule_settings (
+                                                            restaurant_id UUID PRIMARY KEY REFERENCES restaurant(id),
+                                                            timezone TEXT NOT NULL DEFAULT 'Asia/Kolkata',
+                                                            slot_minutes INTEGER NOT NULL DEFAULT 30 CHECK (slot_minutes BETWEEN 5 AND 240),
+                                                            slot_capacity INTEGER CHECK (slot_capacity > 0), -- NULL is unlimited
+                                                            prep_lead_minutes INTEGER NOT NULL DEFAULT 30 CHECK (prep_lead_minutes >= 0),
+                                                            max_days_ahead INTEGER NOT NULL DEFAULT 7 CHECK (max_days_ahead BETWEEN 1 AND 60),
+                                                            updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+
+-- weekly opening hours in the restaurant's timezone; weekday 0 is Sunday.
+-- A span past midnight is stored as two rows.
+CREATE TABLE IF NOT EXISTS restaurant_opening_hours (
+                                                        id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                        restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                                        weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+                                                        opens_at TIME NOT NULL,
+                                                        closes_at TIME NOT NULL,
+                                                        CHECK (closes_at > opens_at)
+);
+
+CREATE INDEX IF NOT EXISTS restaurant_opening_hours_restaurant_idx ON restaurant_opening_hours (restaurant_id, weekday);
@@ -0,0 +1,46 @@
+-- lets the exclusion constraint below compare table ids alongside time ranges
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- how long a reservation holds its table
+ALTER TABLE restaurant_schedule_settings
+    ADD COLUMN IF NOT EXISTS reservation_minutes INTEGER NOT NULL DEFAULT 90 CHECK (reservation_minutes BETWEEN 15 AND 480);
+
+
+CREATE TABLE IF NOT EXISTS restaurant_tables (
+                                                 id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                 restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                                 name TEXT NOT NULL,
+                                                 capacity INTEGER NOT NULL CHECK (capacity > 0),
+                                                 created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                                 updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                                 archived_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS restaurant_tables_name_idx
+    ON restaurant_tables (restaurant_id, LOWER(name)) WHERE archived_at IS NULL;
+
+
+CREATE TYPE reservation_status AS ENUM ('booked', 'seated', 'completed', 'cancelled', 'no_show');
+
+
+-- a table held for a party; the exclusion constraint makes overlapping live
+-- reservations of one table impossible however the bookings race
+CREATE TABLE IF NOT EXISTS reservations (
+                                            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                            restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                            table_id UUID REFERENCES restaurant_tables(id) NOT NULL,
+                                            user_id UUID REFERENCES users(id) NOT NULL,
+                                            party_size INTEGER NOT NULL CHECK (party_size > 0),
+                                            starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                            ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                            status reservation_status NOT NULL DEFAULT 'booked',
+                                            notes TEXT,
+                                            created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                            updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                            CHECK (ends_at > starts_at),
+                                            EXCLUDE USING gist (table_id WITH =, tstzrange(starts_at, ends_at) WITH &&)
+                                                WHERE (status IN ('booked', 'seated'))
+);
+
+CREATE INDEX IF NOT EXISTS reservations_restaurant_idx ON reservations (restaurant_id, starts_at);
+CREATE INDEX IF NOT EXISTS reservations_user_idx ON reservations (user_id, starts_at);
@@ -0,0 +1,39 @@
+-- every time a party sits at a table, from a reservation or the waitlist;
+-- the finished ones are the turnover history wait estimates are based on
+CREATE TABLE IF NOT EXISTS table_sessions (
+                                              id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                              restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                              table_id UUID REFERENCES restaurant_tables(id) NOT NULL,
+                                              party_size INTEGER NOT NULL CHECK (party_size > 0),
+                                              reservation_id UUID REFERENCES reservations(id),
+                                              seated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                              cleared_at TIMESTAMP WITH TIME ZONE,
+                                              CHECK (cleared_at IS NULL OR cleared_at >= seated_at)
+);
+
+-- one party at a table at a time
+CREATE UNIQUE INDEX IF NOT EXISTS table_sessions_open_idx ON table_sessions (table_id) WHERE cleared_at IS NULL;
+CREATE INDEX IF NOT EXISTS table_sessions_history_idx ON table_sessions (restaurant_id, cleared_at);
+
+
+CREATE TYPE waitlist_status AS ENUM ('waiting', 'notified', 'seated', 'removed');
+
+
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+                                                id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                                restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                                party_name TEXT NOT NULL,
+                                                party_size INTEGER NOT NULL CHECK (party_size > 0),
+                                                phone TEXT,
+                                                notes TEXT,
+                                                status waitlist_status NOT NULL DEFAULT 'waiting',
+                                                token TEXT NOT NULL UNIQUE, -- lets the guest check their place without logging in
+                                                table_session_id UUID REFERENCES table_sessions(id),
+                                                created_by UUID REFERENCES users(id) NOT NULL,
+                                                created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+                                                notified_at TIMESTAMP WITH TIME ZONE,
+                                                updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS waitlist_entries_active_idx
+    ON waitlist_entries (restaurant_id, created_at) WHERE status IN ('waiting', 'notified');
@@ -0,0 +1,30 @@
+-- bumped to invalidate every QR code printed for a table
+ALTER TABLE restaurant_tables
+    ADD COLUMN IF NOT EXISTS qr_version INTEGER NOT NULL DEFAULT 1;
+
+
+CREATE TYPE tab_status AS ENUM ('open', 'closed');
+
+
+-- the running bill of a table; every guest who scans the table's code while
+-- it is open orders onto the same tab
+CREATE TABLE IF NOT EXISTS table_tabs (
+                                          id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                          restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                          table_id UUID REFERENCES restaurant_tables(id) NOT NULL,
+                                          status tab_status NOT NULL DEFAULT 'open',
+                                          opened_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                          closed_at TIMESTAMP WITH TIME ZONE,
+                                          closed_by UUID REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS table_tabs_open_idx ON table_tabs (table_id) WHERE status = 'open';
+
+
+-- dine-in guests order without an account, onto their table's tab
+ALTER TABLE orders
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS tab_id UUID REFERENCES table_tabs(id),
+    ADD CONSTRAINT orders_customer_check CHECK (user_id IS NOT NULL OR tab_id IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS orders_tab_idx ON orders (tab_id) WHERE tab_id IS NOT NULL;
@@ -0,0 +1,39 @@
+CREATE TYPE split_method AS ENUM ('items', 'equal', 'custom');
+
+
+-- one part of a tab's bill, paid by a single payment; shares nobody has
+-- started paying are voided when the rest of the bill is split again
+CREATE TABLE IF NOT EXISTS tab_bill_shares (
+                                               id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                               tab_id UUID REFERENCES table_tabs(id) NOT NULL,
+                                               method split_method NOT NULL,
+                                               amount money_amount NOT NULL CHECK ((amount).amount > 0),
+                                               paid_at TIMESTAMP WITH TIME ZONE,
+                                               voided_at TIMESTAMP WITH TIME ZONE,
+                                               created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS tab_bill_shares_tab_idx ON tab_bill_shares (tab_id) WHERE voided_at IS NULL;
+
+
+-- the order items a share split by item pays for
+CREATE TABLE IF NOT EXISTS tab_bill_share_items (
+                                                    share_id UUID REFERENCES tab_bill_shares(id) NOT NULL,
+                                                    order_item_id UUID REFERENCES order_items(id) NOT NULL,
+                                                    quantity INTEGER NOT NULL CHECK (quantity > 0),
+                                                    amount money_amount NOT NULL,
+                                                    PRIMARY KEY (share_id, order_item_id)
+);
+
+
+-- tab payments pay a bill share instead of a single order
+ALTER TABLE payments
+    ALTER COLUMN order_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS bill_share_id UUID REFERENCES tab_bill_shares(id),
+    ADD CONSTRAINT payments_target_check CHECK (num_nonnulls(order_id, bill_share_id) = 1);
+
+CREATE INDEX IF NOT EXISTS payments_bill_share_idx ON payments (bill_share_id) WHERE bill_share_id IS NOT NULL;
+
+-- a share is paid by one payment at a time; failed attempts can be retried
+CREATE UNIQUE INDEX IF NOT EXISTS payments_bill_share_active_idx ON payments (bill_share_id)
+    WHERE status IN ('pending', 'authorized', 'captured');
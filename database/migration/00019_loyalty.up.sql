@@ -0,0 +1,46 @@
+-- how customers earn and redeem points at a restaurant; restaurants without
+-- a row award no points
+CREATE TABLE IF NOT EXISTS restaurant_loyalty_settings (
+                                                           restaurant_id UUID PRIMARY KEY REFERENCES restaurant(id),
+                                                           earn_rate NUMERIC(8,2) NOT NULL DEFAULT 0 CHECK (earn_rate >= 0), -- points per currency unit spent
+                                                           point_value money_amount CHECK ((point_value).amount > 0), -- NULL disables redemption
+                                                           expiry_days INTEGER CHECK (expiry_days > 0), -- NULL never expires
+                                                           updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+
+CREATE TYPE loyalty_entry_kind AS ENUM ('earn', 'redeem', 'expire', 'restore');
+
+
+-- every change to a customer's points at a restaurant; the balance is the sum
+-- of points. Earned and restored points keep what is left of them in
+-- remaining, which redemptions and expiry use up oldest expiry first.
+CREATE TABLE IF NOT EXISTS loyalty_ledger (
+                                              id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                              user_id UUID REFERENCES users(id) NOT NULL,
+                                              restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                              order_id UUID REFERENCES orders(id),
+                                              kind loyalty_entry_kind NOT NULL,
+                                              points INTEGER NOT NULL CHECK (points <> 0),
+                                              remaining INTEGER NOT NULL DEFAULT 0 CHECK (remaining >= 0),
+                                              expires_at TIMESTAMP WITH TIME ZONE,
+                                              created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS loyalty_ledger_user_idx ON loyalty_ledger (user_id, restaurant_id, created_at);
+CREATE INDEX IF NOT EXISTS loyalty_ledger_remaining_idx ON loyalty_ledger (user_id, expires_at) WHERE remaining > 0;
+-- an order earns points once
+CREATE UNIQUE INDEX IF NOT EXISTS loyalty_ledger_earn_idx ON loyalty_ledger (order_id) WHERE kind = 'earn';
+
+
+-- points redeemed at checkout come off the items like a discount
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS points_redeemed INTEGER NOT NULL DEFAULT 0 CHECK (points_redeemed >= 0),
+    ADD COLUMN IF NOT EXISTS points_discount money_amount;
+UPDATE orders SET points_discount = ROW(0, (total).currency)::money_amount;
+ALTER TABLE orders ALTER COLUMN points_discount SET NOT NULL;
+
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS points_discount money_amount;
+UPDATE invoices SET points_discount = ROW(0, (total).currency)::money_amount;
+ALTER TABLE invoices ALTER COLUMN points_discount SET NOT NULL;
@@ -0,0 +1,15 @@
+-- restaurants a customer saved to find again quickly
+CREATE TABLE IF NOT EXISTS favorite_restaurants (
+                                                    user_id UUID REFERENCES users(id) NOT NULL,
+                                                    restaurant_id UUID REFERENCES restaurant(id) NOT NULL,
+                                                    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                                    PRIMARY KEY (user_id, restaurant_id)
+);
+
+-- dishes a customer saved to find again quickly
+CREATE TABLE IF NOT EXISTS favorite_dishes (
+                                               user_id UUID REFERENCES users(id) NOT NULL,
+                                               dish_id UUID REFERENCES dishes(id) NOT NULL,
+                                               created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+                                               PRIMARY KEY (user_id, dish_id)
+);
@@ -0,0 +1,4 @@
+-- an order has at most one payment in flight or captured, so concurrent
+-- attempts with different idempotency keys cannot charge it twice
+CREATE UNIQUE INDEX IF NOT EXISTS payments_order_active_idx ON payments (order_id)
+    WHERE status IN ('pending', 'authorized', 'captured');
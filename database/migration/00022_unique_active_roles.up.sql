@@ -0,0 +1,9 @@
+-- keep the oldest of any role granted twice by concurrent requests
+UPDATE user_role r SET archived_at = NOW()
+WHERE r.archived_at IS NULL
+  AND EXISTS (SELECT 1 FROM user_role o
+              WHERE o.user_id = r.user_id AND o.role_type = r.role_type AND o.archived_at IS NULL
+                AND (o.created_at, o.id) < (r.created_at, r.id));
+
+-- a user holds each role at most once at a time
+CREATE UNIQUE INDEX IF NOT EXISTS user_role_active_idx ON user_role (user_id, role_type) WHERE archived_at IS NULL;
@@ -0,0 +1,8 @@
+-- the earned points each redemption used up, so points given back when an
+-- order is called off keep their original expiry
+CREATE TABLE IF NOT EXISTS loyalty_redemption_lots (
+                                                       redeem_id UUID REFERENCES loyalty_ledger(id) NOT NULL,
+                                                       lot_id UUID REFERENCES loyalty_ledger(id) NOT NULL,
+                                                       points INTEGER NOT NULL CHECK (points > 0),
+                                                       PRIMARY KEY (redeem_id, lot_id)
+);
@@ -0,0 +1,5 @@
+-- the part of each line tax given back by refunds, so the order's tax
+-- breakdown shrinks with its tax_total
+ALTER TABLE order_item_taxes ADD COLUMN IF NOT EXISTS refunded money_amount;
+UPDATE order_item_taxes SET refunded = ROW(0, (amount).currency)::money_amount WHERE refunded IS NULL;
+ALTER TABLE order_item_taxes ALTER COLUMN refunded SET NOT NULL;
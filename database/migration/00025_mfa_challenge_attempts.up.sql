@@ -0,0 +1,8 @@
+-- codes tried against each login challenge token, so a token stops working
+-- after a few wrong codes and cannot be used to guess every TOTP code
+CREATE TABLE IF NOT EXISTS mfa_challenge_attempts (
+                                                      token_id UUID PRIMARY KEY,
+                                                      user_id UUID REFERENCES users(id) NOT NULL,
+                                                      attempts INTEGER NOT NULL DEFAULT 0,
+                                                      created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- points taken back when an order that earned them is refunded after delivery
+ALTER TYPE loyalty_entry_kind ADD VALUE IF NOT EXISTS 'clawback';
@@ -0,0 +1,7 @@
+-- the random code printed in a table's QR code. It does not depend on the
+-- JWT signing keys, so rotating them leaves printed codes working; rotating
+-- the table's code replaces it.
+ALTER TABLE restaurant_tables
+    ADD COLUMN IF NOT EXISTS qr_token TEXT NOT NULL DEFAULT replace(gen_random_uuid()::TEXT || gen_random_uuid()::TEXT, '-', '');
+
+CREATE UNIQUE INDEX IF NOT EXISTS restaurant_tables_qr_token_idx ON restaurant_tables (qr_token);
@@ -0,0 +1,8 @@
+-- the first unit of the order line a refund item covers, so the discount and
+-- tax given back when it completes belong to the same units it was priced for.
+-- Existing items are taken to start after the units refunded so far.
+ALTER TABLE refund_items ADD COLUMN IF NOT EXISTS first_unit INTEGER;
+UPDATE refund_items ri SET first_unit = oi.refunded_quantity
+FROM order_items oi
+WHERE oi.id = ri.order_item_id AND ri.first_unit IS NULL;
+ALTER TABLE refund_items ALTER COLUMN first_unit SET NOT NULL;
@@ -0,0 +1,96 @@
+// Package dinein renders the QR codes placed on tables and splits table
+// bills. Scanning a code opens the dine-in ordering page with the table's
+// signed token.
+package dinein
+
+import (
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	DefaultSize = 256
+	MinSize     = 128
+	MaxSize     = 2048
+)
+
+// URL is the dine-in page the codes open, with the table token appended as
+// ?table=. Empty encodes the bare token.
+var URL string
+
+// URLFromEnv reads DINE_IN_URL, which must be an absolute http(s) URL if set
+func URLFromEnv() (string, error) {
+	value := strings.TrimSpace(os.Getenv("DINE_IN_URL"))
+	if value == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("invalid DINE_IN_URL %q", value)
+	}
+	return value, nil
+}
+
+// Link is what a table's code encodes for the token
+func Link(token string) string {
+	if URL == "" {
+		return token
+	}
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return token
+	}
+	query := parsed.Query()
+	query.Set("table", token)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// PNG writes the code for content as a size x size pixel PNG
+func PNG(w io.Writer, content string, size int) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	image, err := code.PNG(size)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(image)
+	return err
+}
+
+// SVG writes the code for content as a scalable SVG, one unit per module.
+// Dark modules in a row are merged into a single rect to keep it small.
+func SVG(w io.Writer, content string) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	bitmap := code.Bitmap()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, len(bitmap), len(bitmap))
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`, len(bitmap), len(bitmap))
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="1"/>`, start, y, x-start)
+		}
+	}
+	b.WriteString(`</svg>`)
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
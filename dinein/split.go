@@ -0,0 +1,51 @@
+package dinein
+
+import (
+	"github.com/google/uuid"
+	"new_restaurant/models"
+	"new_restaurant/money"
+)
+
+// MaxParts is the most equal shares a bill can be split into
+const MaxParts = 50
+
+// Billable reports whether an order counts towards its tab's bill
+func Billable(order models.Order) bool {
+	return order.Status != models.OrderRejected && order.Status != models.OrderCancelled
+}
+
+// Totals sums what is owed for a tab's billable orders and what its paid
+// shares have covered
+func Totals(orders []models.Order, shares []models.BillShare, currency string) (total, paid money.Money) {
+	total, paid = money.Zero(currency), money.Zero(currency)
+	for _, order := range orders {
+		if Billable(order) {
+			total = total.Add(order.Total.Sub(order.RefundedTotal))
+		}
+	}
+	for _, share := range shares {
+		if share.PaidAt != nil {
+			paid = paid.Add(share.Amount)
+		}
+	}
+	return total, paid
+}
+
+// ItemCosts spreads what is left of an order's total after refunds over the
+// units of its items still unrefunded, in proportion to what they are worth,
+// so whoever pays for an item also pays its part of order level charges such
+// as the service charge
+func ItemCosts(order models.Order, items []models.OrderItem) map[uuid.UUID]money.Money {
+	weights := make([]money.Money, len(items))
+	for i, item := range items {
+		// refunds give back an item's first units
+		weights[i] = money.UnitsCost(item.LineTotal, item.Quantity, item.RefundedQuantity, item.Quantity-item.RefundedQuantity)
+	}
+	shares := money.Allocate(order.Total.Sub(order.RefundedTotal), weights)
+
+	costs := make(map[uuid.UUID]money.Money, len(items))
+	for i, item := range items {
+		costs[item.ID] = shares[i]
+	}
+	return costs
+}
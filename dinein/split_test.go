@@ -0,0 +1,43 @@
+package dinein
+
+import (
+	"github.com/google/uuid"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"testing"
+)
+
+func TestItemCosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		refunded int
+		refund   int64
+		want     []int64
+	}{
+		{"no refund", 0, 0, []int64{525, 525, 1051}},
+		{"one unit refunded", 1, 525, []int64{526, 525, 525}},
+		{"whole line refunded", 2, 1051, []int64{525, 525, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []models.OrderItem{
+				{ID: uuid.New(), Quantity: 1, LineTotal: money.New(500, "INR")},
+				{ID: uuid.New(), Quantity: 1, LineTotal: money.New(500, "INR")},
+				{ID: uuid.New(), Quantity: 2, LineTotal: money.New(1000, "INR"), RefundedQuantity: tt.refunded},
+			}
+			order := models.Order{Total: money.New(2101, "INR"), RefundedTotal: money.New(tt.refund, "INR")}
+
+			costs := ItemCosts(order, items)
+			var sum int64
+			for i, item := range items {
+				if costs[item.ID].Amount != tt.want[i] {
+					t.Errorf("item %d costs %d, want %d", i, costs[item.ID].Amount, tt.want[i])
+				}
+				sum += costs[item.ID].Amount
+			}
+			if left := order.Total.Sub(order.RefundedTotal); sum != left.Amount {
+				t.Errorf("item costs add up to %d, want %d", sum, left.Amount)
+			}
+		})
+	}
+}
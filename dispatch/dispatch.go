@@ -0,0 +1,183 @@
+// Package dispatch finds couriers for orders. An accepted order is offered to
+// the nearest free courier; an offer that is declined or not answered in time
+// goes to the next nearest one, until someone accepts it.
+package dispatch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"math"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNoCourier            = errors.New("no courier available")
+	ErrNoRestaurantLocation = errors.New("restaurant has no coordinates")
+)
+
+// Config tunes the assignment engine
+type Config struct {
+	// OfferTimeout is how long a courier has to accept an offer
+	OfferTimeout time.Duration
+	// MaxDistanceKm is the furthest a courier may be from the restaurant; 0 means any distance
+	MaxDistanceKm float64
+	// LocationMaxAge skips couriers whose last position is older than this
+	LocationMaxAge time.Duration
+	// SweepInterval is how often expired offers and unassigned orders are retried
+	SweepInterval time.Duration
+}
+
+// Default is the configuration used by handlers and Run
+var Default = Config{
+	OfferTimeout:   time.Minute,
+	MaxDistanceKm:  10,
+	LocationMaxAge: 5 * time.Minute,
+	SweepInterval:  5 * time.Second,
+}
+
+// FromEnv reads COURIER_OFFER_TIMEOUT, COURIER_MAX_DISTANCE_KM and
+// COURIER_LOCATION_MAX_AGE over the defaults. Durations use Go syntax, e.g. 90s.
+func FromEnv() (Config, error) {
+	config := Default
+	for name, target := range map[string]*time.Duration{
+		"COURIER_OFFER_TIMEOUT":    &config.OfferTimeout,
+		"COURIER_LOCATION_MAX_AGE": &config.LocationMaxAge,
+	} {
+		if value := os.Getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration <= 0 {
+				return config, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = duration
+		}
+	}
+	if value := os.Getenv("COURIER_MAX_DISTANCE_KM"); value != "" {
+		distance, err := strconv.ParseFloat(value, 64)
+		if err != nil || distance < 0 {
+			return config, fmt.Errorf("invalid COURIER_MAX_DISTANCE_KM %q", value)
+		}
+		config.MaxDistanceKm = distance
+	}
+	return config, nil
+}
+
+// dispatchable are the statuses in which an order can be given a courier
+var dispatchable = map[models.OrderStatus]bool{
+	models.OrderAccepted:  true,
+	models.OrderPreparing: true,
+	models.OrderReady:     true,
+}
+
+// AssignOrder offers the order to the nearest free courier. It does nothing
+// if the order already has a courier or an open offer, and returns
+// ErrNoCourier when nobody can take it yet.
+func AssignOrder(orderID uuid.UUID) (*models.DeliveryAssignment, error) {
+	var offer *models.DeliveryAssignment
+	err := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		offer, err = offerOrder(tx, orderID)
+		return err
+	})
+	return offer, err
+}
+
+func offerOrder(tx *sqlx.Tx, orderID uuid.UUID) (*models.DeliveryAssignment, error) {
+	// the order lock serialises dispatches of the same order
+	order, err := dbHelper.GetOrderForUpdate(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	// dine-in orders are served at the table
+	if order.CourierID != nil || order.TabID != nil || !dispatchable[order.Status] {
+		return nil, nil
+	}
+	if _, err := dbHelper.GetActiveAssignment(tx, orderID); !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, order.RestaurantID.String())
+	if err != nil {
+		return nil, err
+	}
+	if restaurant.Latitude == nil || restaurant.Longitude == nil {
+		return nil, ErrNoRestaurantLocation
+	}
+
+	couriers, err := dbHelper.ListFreeCouriers(tx, orderID, time.Now().Add(-Default.LocationMaxAge))
+	if err != nil {
+		return nil, err
+	}
+	var nearest *models.Courier
+	best := math.Inf(1)
+	for i, courier := range couriers {
+		distance := utils.CalculateDistance(*restaurant.Latitude, *restaurant.Longitude, *courier.Latitude, *courier.Longitude)
+		if distance < best && (Default.MaxDistanceKm == 0 || distance <= Default.MaxDistanceKm) {
+			nearest, best = &couriers[i], distance
+		}
+	}
+	if nearest == nil {
+		return nil, ErrNoCourier
+	}
+
+	offer := models.DeliveryAssignment{
+		ID:         uuid.New(),
+		OrderID:    orderID,
+		CourierID:  nearest.UserID,
+		Status:     models.AssignmentOffered,
+		DistanceKm: best,
+		ExpiresAt:  time.Now().Add(Default.OfferTimeout),
+	}
+	if err := dbHelper.CreateAssignment(tx, offer); err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// Sweep expires unanswered offers, frees the couriers of cancelled orders
+// and retries every order still waiting for a courier
+func Sweep() error {
+	if _, err := dbHelper.ExpireOffers(database.Rest); err != nil {
+		return err
+	}
+	if err := dbHelper.CancelStaleAssignments(database.Rest); err != nil {
+		return err
+	}
+	orderIDs, err := dbHelper.ListOrdersAwaitingCourier(database.Rest)
+	if err != nil {
+		return err
+	}
+	for _, orderID := range orderIDs {
+		if _, err := AssignOrder(orderID); err != nil && !errors.Is(err, ErrNoCourier) {
+			logrus.Errorf("failed to dispatch order %s: %s", orderID, err)
+		}
+	}
+	return nil
+}
+
+// Run sweeps every SweepInterval until the context is done. Every server
+// instance may run it; the order locks keep them from double booking.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(Default.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Sweep(); err != nil {
+				logrus.Errorf("courier dispatch sweep failed: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package events fans order events out to the clients watching them. Events
+// are published with Postgres NOTIFY when the transaction that caused them
+// commits, and every server instance LISTENs and hands them to its own
+// subscribers, so a client sees every event whichever instance it is on.
+package events
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Channel is the NOTIFY channel events are published on
+const Channel = "order_events"
+
+const (
+	// TypeOrderStatus is an order moving to a new status
+	TypeOrderStatus = "order.status"
+	// TypeCourierAssigned is a courier accepting to deliver an order
+	TypeCourierAssigned = "courier.assigned"
+	// TypeCourierLocation is a courier's position while delivering an order.
+	// Locations are not stored, so they have no ID and are never replayed.
+	TypeCourierLocation = "courier.location"
+)
+
+// Event is something that happened to an order. Stored events have
+// increasing IDs that clients can resume from.
+type Event struct {
+	ID           int64           `json:"id,omitempty" db:"id"`
+	OrderID      uuid.UUID       `json:"order_id" db:"order_id"`
+	RestaurantID uuid.UUID       `json:"restaurant_id" db:"restaurant_id"`
+	Type         string          `json:"type" db:"type"`
+	Data         json.RawMessage `json:"data" db:"data"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+}
+
+// StatusChange is the data of a TypeOrderStatus event
+type StatusChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// CourierLocation is the data of a TypeCourierLocation event
+type CourierLocation struct {
+	CourierID uuid.UUID `json:"courier_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+}
+
+// CourierAssigned is the data of a TypeCourierAssigned event
+type CourierAssigned struct {
+	CourierID   uuid.UUID `json:"courier_id"`
+	CourierName string    `json:"courier_name"`
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it is dropped; a dropped client reconnects and resumes from its last event
+const subscriberBuffer = 64
+
+// Hub delivers events to the subscribers on this server instance
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[*Subscription]struct{}
+}
+
+// Default is the hub used by handlers
+var Default = NewHub()
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[uuid.UUID]map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the events of one order or restaurant on C. C is
+// closed when the subscription is closed or falls too far behind.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	hub   *Hub
+	topic uuid.UUID
+}
+
+// Subscribe receives the events of the order or restaurant with the ID
+func (h *Hub) Subscribe(topic uuid.UUID) *Subscription {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, hub: h, topic: topic}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[topic][sub] = struct{}{}
+	return sub
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// remove drops a subscription; the caller holds mu
+func (h *Hub) remove(sub *Subscription) {
+	subs, ok := h.subscribers[sub.topic]
+	if _, subscribed := subs[sub]; !ok || !subscribed {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.topic)
+	}
+	close(sub.c)
+}
+
+// Publish hands the event to the subscribers of its order and its
+// restaurant on this instance. Other instances only see events sent with
+// NOTIFY, which is what Listen turns into Publish calls.
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, topic := range []uuid.UUID{event.OrderID, event.RestaurantID} {
+		for sub := range h.subscribers[topic] {
+			select {
+			case sub.c <- event:
+			default:
+				logrus.Warnf("dropping slow subscriber to %s", topic)
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+// Listen subscribes the listener to Channel and publishes every notification
+// to the hub until the listener is closed
+func (h *Hub) Listen(listener *pq.Listener) error {
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+
+	go func() {
+		// the listener only notices a dead connection when it is used
+		ping := time.NewTicker(90 * time.Second)
+		defer ping.Stop()
+		for {
+			select {
+			case notification, ok := <-listener.Notify:
+				if !ok {
+					return
+				}
+				if notification == nil {
+					logrus.Warn("event listener reconnected, events sent meanwhile were missed")
+					continue
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+					logrus.Errorf("invalid event notification: %s", err)
+					continue
+				}
+				h.Publish(event)
+			case <-ping.C:
+				go listener.Ping()
+			}
+		}
+	}()
+	return nil
+}
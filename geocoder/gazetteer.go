@@ -0,0 +1,129 @@
+package geocoder
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"new_restaurant/utils"
+)
+
+type gazetteerEntry struct {
+	name       string
+	normalized string
+	latitude   float64
+	longitude  float64
+}
+
+// maxReverseDistanceKm is how far a position may be from the nearest known
+// place for ReverseGeocode to still name it
+const maxReverseDistanceKm = 25.0
+
+// Gazetteer is an offline geocoder backed by a list of known places
+type Gazetteer struct {
+	entries []gazetteerEntry
+}
+
+// NewGazetteerFromFile loads a CSV gazetteer of name,latitude,longitude rows.
+// Blank lines and lines starting with # are ignored.
+func NewGazetteerFromFile(path string) (*Gazetteer, error) {
+	if path == "" {
+		return nil, fmt.Errorf("GEOCODER_GAZETTEER is required for the offline geocoder")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewGazetteer(f)
+}
+
+// NewGazetteer parses a CSV gazetteer from r
+func NewGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	g := &Gazetteer{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lat, latErr := strconv.ParseFloat(record[1], 64)
+		lon, lonErr := strconv.ParseFloat(record[2], 64)
+		if latErr != nil || lonErr != nil || !utils.ValidCoordinates(&lat, &lon) {
+			if line == 1 {
+				continue // header row
+			}
+			return nil, fmt.Errorf("invalid coordinates for %q in gazetteer", record[0])
+		}
+
+		g.entries = append(g.entries, gazetteerEntry{
+			name:       record[0],
+			normalized: normalizeAddress(record[0]),
+			latitude:   lat,
+			longitude:  lon,
+		})
+	}
+	return g, nil
+}
+
+func normalizeAddress(address string) string {
+	fields := strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	return " " + strings.Join(fields, " ") + " "
+}
+
+// Geocode returns the most specific known place mentioned in address,
+// preferring an exact match and otherwise the longest contained name
+func (g *Gazetteer) Geocode(_ context.Context, address string) (*Location, error) {
+	query := normalizeAddress(address)
+
+	var best *gazetteerEntry
+	for i := range g.entries {
+		entry := &g.entries[i]
+		if entry.normalized == query {
+			best = entry
+			break
+		}
+		if strings.Contains(query, entry.normalized) &&
+			(best == nil || len(entry.normalized) > len(best.normalized)) {
+			best = entry
+		}
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+
+	return &Location{Address: best.name, Latitude: best.latitude, Longitude: best.longitude}, nil
+}
+
+// ReverseGeocode returns the nearest known place, or ErrNotFound if none is
+// within maxReverseDistanceKm
+func (g *Gazetteer) ReverseGeocode(_ context.Context, latitude, longitude float64) (*Location, error) {
+	var best *gazetteerEntry
+	bestDistance := 0.0
+	for i := range g.entries {
+		entry := &g.entries[i]
+		distance := utils.CalculateDistance(latitude, longitude, entry.latitude, entry.longitude)
+		if best == nil || distance < bestDistance {
+			best, bestDistance = entry, distance
+		}
+	}
+	if best == nil || bestDistance > maxReverseDistanceKm {
+		return nil, ErrNotFound
+	}
+
+	return &Location{Address: best.name, Latitude: best.latitude, Longitude: best.longitude}, nil
+}
@@ -0,0 +1,48 @@
+package geocoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNotFound is returned when an address or position cannot be resolved
+var ErrNotFound = errors.New("location not found")
+
+// Location is a resolved point together with the address it was matched to
+type Location struct {
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder resolves free-text addresses to coordinates and back
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (*Location, error)
+	ReverseGeocode(ctx context.Context, latitude, longitude float64) (*Location, error)
+}
+
+// Default is the geocoder used by handlers; nil means geocoding is disabled
+// and clients must send coordinates themselves
+var Default Geocoder
+
+// FromEnv builds the geocoder selected by GEOCODER ("offline", "http" or empty
+// to disable). The offline geocoder reads GEOCODER_GAZETTEER, the HTTP one
+// talks to GEOCODER_URL.
+func FromEnv() (Geocoder, error) {
+	switch provider := os.Getenv("GEOCODER"); provider {
+	case "":
+		return nil, nil
+	case "offline":
+		return NewGazetteerFromFile(os.Getenv("GEOCODER_GAZETTEER"))
+	case "http":
+		baseURL := os.Getenv("GEOCODER_URL")
+		if baseURL == "" {
+			return nil, errors.New("GEOCODER_URL is required for the http geocoder")
+		}
+		return NewHTTPGeocoder(baseURL, os.Getenv("GEOCODER_USER_AGENT")), nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", provider)
+	}
+}
@@ -0,0 +1,102 @@
+package geocoder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"new_restaurant/utils"
+)
+
+// HTTPGeocoder talks to a Nominatim-compatible geocoding service
+type HTTPGeocoder struct {
+	baseURL   string
+	userAgent string
+	client    *http.Client
+}
+
+type nominatimPlace struct {
+	DisplayName string `json:"display_name"`
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	Error       string `json:"error"`
+}
+
+func NewHTTPGeocoder(baseURL, userAgent string) *HTTPGeocoder {
+	if userAgent == "" {
+		userAgent = "new_restaurant"
+	}
+	return &HTTPGeocoder{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (g *HTTPGeocoder) Geocode(ctx context.Context, address string) (*Location, error) {
+	params := url.Values{}
+	params.Set("q", address)
+	params.Set("format", "json")
+	params.Set("limit", "1")
+
+	var places []nominatimPlace
+	if err := g.get(ctx, "/search", params, &places); err != nil {
+		return nil, err
+	}
+	if len(places) == 0 {
+		return nil, ErrNotFound
+	}
+	return places[0].location()
+}
+
+func (g *HTTPGeocoder) ReverseGeocode(ctx context.Context, latitude, longitude float64) (*Location, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(latitude, 'f', -1, 64))
+	params.Set("lon", strconv.FormatFloat(longitude, 'f', -1, 64))
+	params.Set("format", "json")
+
+	var place nominatimPlace
+	if err := g.get(ctx, "/reverse", params, &place); err != nil {
+		return nil, err
+	}
+	if place.Error != "" {
+		return nil, ErrNotFound
+	}
+	return place.location()
+}
+
+func (g *HTTPGeocoder) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", g.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("geocoding service returned %s", resp.Status)
+	}
+	return utils.JSON.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p nominatimPlace) location() (*Location, error) {
+	lat, err := strconv.ParseFloat(p.Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude from geocoding service: %w", err)
+	}
+	lon, err := strconv.ParseFloat(p.Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude from geocoding service: %w", err)
+	}
+	return &Location{Address: p.DisplayName, Latitude: lat, Longitude: lon}, nil
+}
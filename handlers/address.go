@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/geocoder"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"strings"
+)
+
+func CreateAddress(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") && !utils.HasRole(r, "sub_admin") && !utils.HasRole(r, "user") {
+		http.Error(w, "user not logged in", http.StatusForbidden)
+		return
+	}
+
+	var req models.UserAddressRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Label == "" {
+		req.Label = models.AddressLabelOther
+	}
+	if strings.TrimSpace(req.Address) == "" || !req.Label.IsValid() ||
+		!utils.ValidCoordinates(req.Latitude, req.Longitude) {
+		http.Error(w, "invalid address, label or coordinates", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	req.Latitude, req.Longitude, ok = resolveCoordinates(w, r, req.Address, req.Latitude, req.Longitude)
+	if !ok {
+		return
+	}
+
+	address := models.UserAddress{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Address:   req.Address,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Label:     req.Label,
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if err := dbHelper.CreateUserAddress(tx, address); err != nil {
+			return err
+		}
+
+		// the first address a user saves becomes their default
+		hasDefault, err := dbHelper.HasDefaultAddress(tx, userID)
+		if err != nil {
+			return err
+		}
+		if req.IsDefault || !hasDefault {
+			return dbHelper.SetDefaultAddress(tx, userID, address.ID)
+		}
+		return nil
+	})
+	if txErr != nil {
+		http.Error(w, "failed to create user address", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(map[string]string{
+		"id":      address.ID.String(),
+		"message": "User address created successfully",
+	})
+}
+
+func ListAddresses(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	addresses, err := dbHelper.ListUserAddresses(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to list addresses", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"addresses": addresses,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// ownedAddressFromPath loads the {id} address, writing a 404 unless it
+// belongs to the caller
+func ownedAddressFromPath(w http.ResponseWriter, r *http.Request) (*models.UserAddress, bool) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	addressID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(addressID); err != nil {
+		http.Error(w, "invalid address ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	address, err := dbHelper.GetUserAddress(database.Rest, addressID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "address not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch address", http.StatusInternalServerError)
+		return nil, false
+	}
+	return address, true
+}
+
+func GetAddress(w http.ResponseWriter, r *http.Request) {
+	address, ok := ownedAddressFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(address); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	address, ok := ownedAddressFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserAddressRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Address != nil {
+		address.Address = *req.Address
+	}
+	if req.Latitude != nil || req.Longitude != nil {
+		address.Latitude, address.Longitude = req.Latitude, req.Longitude
+	} else if req.Address != nil && geocoder.Default != nil {
+		// the stored coordinates belong to the old address text
+		address.Latitude, address.Longitude, ok = resolveCoordinates(w, r, address.Address, nil, nil)
+		if !ok {
+			return
+		}
+	} else if req.Address != nil {
+		// nothing can locate the new text, so rather than keep pointing at the
+		// old address the coordinates are dropped until the client sends them
+		address.Latitude, address.Longitude = nil, nil
+	}
+	if req.Label != nil {
+		address.Label = *req.Label
+	}
+	if strings.TrimSpace(address.Address) == "" || !address.Label.IsValid() ||
+		!utils.ValidCoordinates(address.Latitude, address.Longitude) {
+		http.Error(w, "invalid address, label or coordinates", http.StatusBadRequest)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if err := dbHelper.UpdateUserAddress(tx, *address); err != nil {
+			return err
+		}
+		if req.IsDefault != nil && *req.IsDefault && !address.IsDefault {
+			return dbHelper.SetDefaultAddress(tx, address.UserID, address.ID)
+		}
+		return nil
+	})
+	if txErr != nil {
+		http.Error(w, "failed to update address", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "address updated successfully"})
+}
+
+func SetDefaultAddress(w http.ResponseWriter, r *http.Request) {
+	address, ok := ownedAddressFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbHelper.SetDefaultAddress(tx, address.UserID, address.ID)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to set default address", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "default address updated successfully"})
+}
+
+// DeleteAddress removes one of the caller's addresses. Deleting the default
+// address makes the most recently saved remaining one the default.
+func DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	address, ok := ownedAddressFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var deleted bool
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		deleted, err = dbHelper.ArchiveUserAddress(tx, address.UserID, address.ID)
+		if err != nil || !deleted {
+			return err
+		}
+		return dbHelper.PromoteLatestAddress(tx, address.UserID)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to delete address", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "address not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "address deleted successfully"})
+}
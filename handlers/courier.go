@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/dispatch"
+	"new_restaurant/events"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"time"
+)
+
+var (
+	errAssignmentNotFound = errors.New("assignment not found")
+	errAssignmentClosed   = errors.New("assignment is no longer open")
+)
+
+// courierFromRequest returns the calling courier's user ID, writing the error
+// response if the caller is not a courier
+func courierFromRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	if !utils.HasRole(r, string(models.RoleCourier)) {
+		http.Error(w, "only couriers can do this", http.StatusForbidden)
+		return uuid.Nil, false
+	}
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// dispatchInBackground looks for a courier without holding up the response;
+// the sweep retries whatever this misses
+func dispatchInBackground(orderID uuid.UUID) {
+	go func() {
+		if _, err := dispatch.AssignOrder(orderID); err != nil && !errors.Is(err, dispatch.ErrNoCourier) {
+			logrus.Errorf("failed to dispatch order %s: %s", orderID, err)
+		}
+	}()
+}
+
+// SetCourierAvailability starts or ends the courier's shift. Couriers off
+// shift get no new offers but keep the deliveries they accepted.
+func SetCourierAvailability(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := courierFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CourierAvailabilityRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := dbHelper.SetCourierAvailability(database.Rest, courierID, req.Available); err != nil {
+		http.Error(w, "failed to update availability", http.StatusInternalServerError)
+		return
+	}
+
+	courier, err := dbHelper.GetCourier(database.Rest, courierID)
+	if err != nil {
+		http.Error(w, "failed to fetch courier", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(courier)
+}
+
+// UpdateCourierLocation records the courier's position and shares it with
+// the customers of the orders they are delivering
+func UpdateCourierLocation(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := courierFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CourierLocationRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.Latitude == nil || req.Longitude == nil ||
+		!utils.ValidCoordinates(req.Latitude, req.Longitude) {
+		http.Error(w, "valid latitude and longitude are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := dbHelper.UpdateCourierLocation(database.Rest, courierID, *req.Latitude, *req.Longitude); err != nil {
+		http.Error(w, "failed to update location", http.StatusInternalServerError)
+		return
+	}
+
+	orders, err := dbHelper.ListDeliveringOrders(database.Rest, courierID)
+	if err != nil {
+		http.Error(w, "failed to fetch deliveries", http.StatusInternalServerError)
+		return
+	}
+	data, _ := json.Marshal(events.CourierLocation{CourierID: courierID, Latitude: *req.Latitude, Longitude: *req.Longitude})
+	for _, order := range orders {
+		err := dbHelper.NotifyEvent(database.Rest, events.Event{
+			OrderID:      order.ID,
+			RestaurantID: order.RestaurantID,
+			Type:         events.TypeCourierLocation,
+			Data:         data,
+			CreatedAt:    time.Now(),
+		})
+		if err != nil {
+			// the position is stored; watchers get the next one
+			logrus.Errorf("failed to publish courier location for order %s: %s", order.ID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListCourierAssignments returns the courier's open offers and deliveries
+func ListCourierAssignments(w http.ResponseWriter, r *http.Request) {
+	courierID, ok := courierFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	assignments, err := dbHelper.ListCourierAssignments(database.Rest, courierID)
+	if err != nil {
+		http.Error(w, "failed to list assignments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(assignments); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// updateAssignment locks the caller's {id} assignment and its order, checks
+// the assignment is in the expected status and runs fn, writing the error
+// response on failure
+func updateAssignment(w http.ResponseWriter, r *http.Request, expected models.AssignmentStatus,
+	fn func(tx *sqlx.Tx, assignment *models.DeliveryAssignment, order *models.Order) error) (*models.DeliveryAssignment, bool) {
+	courierID, ok := courierFromRequest(w, r)
+	if !ok {
+		return nil, false
+	}
+	assignmentID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid assignment ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var assignment *models.DeliveryAssignment
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		assignment, err = dbHelper.GetAssignmentForUpdate(tx, assignmentID)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && assignment.CourierID != courierID {
+			return errAssignmentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		order, err := dbHelper.GetOrderForUpdate(tx, assignment.OrderID)
+		if err != nil {
+			return err
+		}
+		if assignment.Status != expected {
+			return errAssignmentClosed
+		}
+		return fn(tx, assignment, order)
+	})
+	switch {
+	case errors.Is(txErr, errAssignmentNotFound):
+		http.Error(w, "assignment not found", http.StatusNotFound)
+	case errors.Is(txErr, errAssignmentClosed):
+		http.Error(w, "assignment is no longer open", http.StatusConflict)
+	case errors.Is(txErr, models.ErrInvalidTransition):
+		http.Error(w, "the order is not in a state that allows this", http.StatusConflict)
+	case txErr != nil:
+		http.Error(w, "failed to update assignment", http.StatusInternalServerError)
+	default:
+		return assignment, true
+	}
+	return nil, false
+}
+
+// AcceptAssignment takes an offered order. The offer must not have expired
+// and the order must still need a courier.
+func AcceptAssignment(w http.ResponseWriter, r *http.Request) {
+	assignment, ok := updateAssignment(w, r, models.AssignmentOffered,
+		func(tx *sqlx.Tx, assignment *models.DeliveryAssignment, order *models.Order) error {
+			if !time.Now().Before(assignment.ExpiresAt) || order.Status == models.OrderCancelled || order.Status == models.OrderRejected {
+				return errAssignmentClosed
+			}
+			courier, err := dbHelper.GetUserByID(database.Rest, assignment.CourierID)
+			if err != nil {
+				return err
+			}
+
+			assignment.Status = models.AssignmentAccepted
+			if err := dbHelper.UpdateAssignmentStatus(tx, assignment.ID, assignment.Status); err != nil {
+				return err
+			}
+			if err := dbHelper.SetOrderCourier(tx, order.ID, &assignment.CourierID); err != nil {
+				return err
+			}
+			data, err := json.Marshal(events.CourierAssigned{CourierID: courier.ID, CourierName: courier.Name})
+			if err != nil {
+				return err
+			}
+			return dbHelper.CreateOrderEvent(tx, &events.Event{
+				OrderID:      order.ID,
+				RestaurantID: order.RestaurantID,
+				Type:         events.TypeCourierAssigned,
+				Data:         data,
+			})
+		})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(assignment)
+}
+
+// DeclineAssignment turns an offer down; the order goes to the next courier
+func DeclineAssignment(w http.ResponseWriter, r *http.Request) {
+	assignment, ok := updateAssignment(w, r, models.AssignmentOffered,
+		func(tx *sqlx.Tx, assignment *models.DeliveryAssignment, _ *models.Order) error {
+			assignment.Status = models.AssignmentDeclined
+			return dbHelper.UpdateAssignmentStatus(tx, assignment.ID, assignment.Status)
+		})
+	if !ok {
+		return
+	}
+	dispatchInBackground(assignment.OrderID)
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(assignment)
+}
+
+// PickUpAssignment marks the order as collected from the restaurant
+func PickUpAssignment(w http.ResponseWriter, r *http.Request) {
+	assignment, ok := updateAssignment(w, r, models.AssignmentAccepted,
+		func(tx *sqlx.Tx, assignment *models.DeliveryAssignment, _ *models.Order) error {
+			return dbHelper.TransitionOrderStatus(tx, assignment.OrderID, models.OrderOutForDelivery)
+		})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(assignment)
+}
+
+// CompleteAssignment marks the order as delivered and frees the courier
+func CompleteAssignment(w http.ResponseWriter, r *http.Request) {
+	assignment, ok := updateAssignment(w, r, models.AssignmentAccepted,
+		func(tx *sqlx.Tx, assignment *models.DeliveryAssignment, _ *models.Order) error {
+			if err := dbHelper.TransitionOrderStatus(tx, assignment.OrderID, models.OrderDelivered); err != nil {
+				return err
+			}
+			assignment.Status = models.AssignmentCompleted
+			return dbHelper.UpdateAssignmentStatus(tx, assignment.ID, assignment.Status)
+		})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(assignment)
+}
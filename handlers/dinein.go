@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/dinein"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"new_restaurant/pricing"
+	"new_restaurant/utils"
+	"strconv"
+	"time"
+)
+
+var (
+	errTabClosed   = errors.New("tab is closed")
+	errTabNotFound = errors.New("tab not found")
+	errTabUnserved = errors.New("tab has orders still in progress")
+	errTabUnpaid   = errors.New("tab has an outstanding balance")
+)
+
+// GetTableQRCode renders the code to print on a table. format selects png
+// (the default, size pixels wide) or svg.
+func GetTableQRCode(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+	tableID, err := uuid.Parse(mux.Vars(r)["tableId"])
+	if err != nil {
+		http.Error(w, "invalid table ID format", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	size := dinein.DefaultSize
+	switch format {
+	case "", "png":
+		if value := r.URL.Query().Get("size"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < dinein.MinSize || parsed > dinein.MaxSize {
+				http.Error(w, "size must be between 128 and 2048", http.StatusBadRequest)
+				return
+			}
+			size = parsed
+		}
+	case "svg":
+	default:
+		http.Error(w, "format must be png or svg", http.StatusBadRequest)
+		return
+	}
+
+	table, err := dbHelper.GetDiningTable(database.Rest, restaurant.ID, tableID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "table not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch table", http.StatusInternalServerError)
+		return
+	}
+
+	// render into a buffer so a failure can still be reported as an error
+	var body bytes.Buffer
+	filename := "table-" + table.ID.String()
+	if format == "svg" {
+		err = dinein.SVG(&body, dinein.Link(table.QRToken))
+		w.Header().Set("Content-Type", "image/svg+xml")
+		filename += ".svg"
+	} else {
+		err = dinein.PNG(&body, dinein.Link(table.QRToken), size)
+		w.Header().Set("Content-Type", "image/png")
+		filename += ".png"
+	}
+	if err != nil {
+		http.Error(w, "failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	w.Write(body.Bytes())
+}
+
+// RotateTableQRCode revokes every code printed for a table, e.g. after one was
+// copied. Guests already seated keep their sessions.
+func RotateTableQRCode(w http.ResponseWriter, r *http.Request) {
+	table, ok := changeDiningTable(w, r, func(tx *sqlx.Tx, table *models.DiningTable) error {
+		var err error
+		table.QRVersion, err = dbHelper.RotateTableQRCode(tx, table.ID)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(table)
+}
+
+// tableFromCode locks the table a scanned code belongs to. Codes are the
+// table's random QR token, or a signed table token printed before tables had
+// one, which is honoured until the table's code is rotated.
+func tableFromCode(tx *sqlx.Tx, code string) (*models.DiningTable, error) {
+	table, err := dbHelper.GetDiningTableByQRTokenForUpdate(tx, code)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return table, err
+	}
+
+	claims, err := utils.ParseTableClaims(code, utils.PurposeTable)
+	if err != nil {
+		return nil, errTableNotFound
+	}
+	restaurantID, restaurantErr := uuid.Parse(claims.RestaurantID)
+	tableID, tableErr := uuid.Parse(claims.TableID)
+	if restaurantErr != nil || tableErr != nil {
+		return nil, errTableNotFound
+	}
+	table, err = dbHelper.GetDiningTableForUpdate(tx, restaurantID, tableID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTableNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// codes printed before the last rotation are revoked
+	if table.QRVersion != claims.Version {
+		return nil, errTableNotFound
+	}
+	return table, nil
+}
+
+// StartDineIn exchanges the code scanned from a table for a guest session on
+// the table's open tab, opening a tab if the table has none
+func StartDineIn(w http.ResponseWriter, r *http.Request) {
+	var req models.StartDineInRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var tab *models.TableTab
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		table, err := tableFromCode(tx, req.Token)
+		if err != nil {
+			return err
+		}
+		tab, err = dbHelper.OpenTab(tx, table.RestaurantID, table.ID)
+		return err
+	})
+	if errors.Is(txErr, errTableNotFound) {
+		http.Error(w, "this table code is no longer valid, please ask staff for help", http.StatusGone)
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to open tab", http.StatusInternalServerError)
+		return
+	}
+
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, tab.RestaurantID.String())
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+	token, err := utils.GenerateDineInToken(restaurant.ID.String(), tab.TableID.String(), tab.ID.String())
+	if err != nil {
+		http.Error(w, "failed to start session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(models.DineInSession{
+		Token:          token,
+		RestaurantID:   restaurant.ID,
+		RestaurantName: restaurant.Name,
+		TableName:      tab.TableName,
+		TabID:          tab.ID,
+	})
+}
+
+// dineInSession parses the IDs in the guest's session, writing the error
+// response if they are malformed
+func dineInSession(w http.ResponseWriter, r *http.Request) (restaurantID, tabID uuid.UUID, ok bool) {
+	claims, ok := utils.GetTableClaims(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+	restaurantID, err := uuid.Parse(claims.RestaurantID)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+	tabID, err = uuid.Parse(claims.TabID)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return restaurantID, tabID, true
+}
+
+// GetDineInMenu lists the dishes the guest can order to their table
+func GetDineInMenu(w http.ResponseWriter, r *http.Request) {
+	restaurantID, _, ok := dineInSession(w, r)
+	if !ok {
+		return
+	}
+
+	dishes, err := dbHelper.ListAllDishByRestaurant(database.Rest, restaurantID)
+	if err != nil {
+		http.Error(w, "failed to list dishes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"dishes": dishes,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// CreateDineInOrder orders dishes onto the guest's tab. The order goes
+// straight to the kitchen; it is paid when the tab is settled, so it carries
+// no delivery or packaging fee. Promotions need an account and do not apply.
+func CreateDineInOrder(w http.ResponseWriter, r *http.Request) {
+	restaurantID, tabID, ok := dineInSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateDineInOrderRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Items) == 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String())
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+
+	cart, ok := buildCart(w, restaurant, req.Items)
+	if !ok {
+		return
+	}
+	cart.DeliveryFee = money.Zero(cart.Currency)
+	cart.Tax.PackagingFee = money.Zero(cart.Currency)
+	quote := pricing.Price(cart, nil, nil, time.Now())
+
+	order := models.Order{
+		ID:               uuid.New(),
+		RestaurantID:     restaurant.ID,
+		TabID:            &tabID,
+		Status:           models.OrderPendingPayment,
+		Subtotal:         quote.Subtotal,
+		DeliveryFee:      quote.DeliveryFee,
+		PackagingFee:     quote.PackagingFee,
+		ServiceCharge:    quote.ServiceCharge,
+		DiscountTotal:    quote.DiscountTotal,
+		PointsRedeemed:   quote.PointsRedeemed,
+		PointsDiscount:   quote.PointsDiscount,
+		TaxTotal:         quote.TaxTotal,
+		PricesIncludeTax: quote.PricesIncludeTax,
+		Total:            quote.Total,
+	}
+
+	items := make([]models.OrderItem, 0, len(quote.Lines))
+	for _, line := range quote.Lines {
+		item := models.OrderItem{
+			ID:             uuid.New(),
+			OrderID:        order.ID,
+			DishID:         line.DishID,
+			Name:           line.Name,
+			Category:       line.Category,
+			UnitPrice:      line.UnitPrice,
+			Quantity:       line.Quantity,
+			DiscountAmount: line.Discount,
+			TaxAmount:      line.TaxTotal,
+			LineTotal:      line.Total,
+			Taxes:          make([]models.OrderItemTax, 0, len(line.Taxes)),
+		}
+		for _, tax := range line.Taxes {
+			item.Taxes = append(item.Taxes, models.OrderItemTax{OrderItemID: item.ID, TaxAmount: tax})
+		}
+		items = append(items, item)
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		tab, err := dbHelper.GetTabForUpdate(tx, tabID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errTabClosed
+		}
+		if err != nil {
+			return err
+		}
+		if tab.Status != models.TabOpen {
+			return errTabClosed
+		}
+		order.TableName = &tab.TableName
+
+		if err := dbHelper.CreateOrder(tx, order); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := dbHelper.CreateOrderItem(tx, item); err != nil {
+				return err
+			}
+		}
+		// placing it records the event that shows it on the kitchen feed
+		return dbHelper.TransitionOrderStatus(tx, order.ID, models.OrderPlaced)
+	})
+	if errors.Is(txErr, errTabClosed) {
+		http.Error(w, "this tab is closed, scan the table code again", http.StatusForbidden)
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to create order", http.StatusInternalServerError)
+		return
+	}
+	order.Status = models.OrderPlaced
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(models.OrderWithItems{
+		Order:     order,
+		Items:     items,
+		Discounts: []models.PromotionRedemption{},
+		Taxes:     quote.Taxes,
+	})
+}
+
+// tabWithOrders loads a tab's orders and bill shares and works out what is
+// still owed on it
+func tabWithOrders(tab models.TableTab, currency string) (models.TabWithOrders, error) {
+	full := models.TabWithOrders{TableTab: tab}
+	orders, err := dbHelper.ListTabOrders(database.Rest, tab.ID)
+	if err != nil {
+		return full, err
+	}
+	full.Orders = make([]models.OrderWithItems, 0, len(orders))
+	for _, order := range orders {
+		withItems, err := orderWithItems(order)
+		if err != nil {
+			return full, err
+		}
+		full.Orders = append(full.Orders, withItems)
+	}
+	if full.Shares, err = dbHelper.ListBillShares(database.Rest, tab.ID); err != nil {
+		return full, err
+	}
+	full.Total, full.Paid = dinein.Totals(orders, full.Shares, currency)
+	full.Outstanding = full.Total.Sub(full.Paid)
+	return full, nil
+}
+
+// GetDineInTab shows the guest everything ordered on their table's tab
+func GetDineInTab(w http.ResponseWriter, r *http.Request) {
+	restaurantID, tabID, ok := dineInSession(w, r)
+	if !ok {
+		return
+	}
+
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String())
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+	tab, err := dbHelper.GetTab(database.Rest, tabID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "tab not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch tab", http.StatusInternalServerError)
+		return
+	}
+
+	full, err := tabWithOrders(*tab, restaurant.Currency)
+	if err != nil {
+		http.Error(w, "failed to fetch tab orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(full); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// ListOpenTabs lists the restaurant's open tabs with their orders
+func ListOpenTabs(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	tabs, err := dbHelper.ListOpenTabs(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to list tabs", http.StatusInternalServerError)
+		return
+	}
+	full := make([]models.TabWithOrders, 0, len(tabs))
+	for _, tab := range tabs {
+		withOrders, err := tabWithOrders(tab, restaurant.Currency)
+		if err != nil {
+			http.Error(w, "failed to fetch tab orders", http.StatusInternalServerError)
+			return
+		}
+		full = append(full, withOrders)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"tabs": full,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// CloseTab closes a tab once all its orders are served and its bill is paid.
+// Guests who scan the table afterwards start a new tab.
+func CloseTab(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	tabID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid tab ID format", http.StatusBadRequest)
+		return
+	}
+
+	var tab *models.TableTab
+	var outstanding money.Money
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		tab, err = dbHelper.GetTabForUpdate(tx, tabID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errTabNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !isRestaurantStaff(r, tab.RestaurantID) {
+			return errTabNotFound
+		}
+		if tab.Status != models.TabOpen {
+			return errTabClosed
+		}
+		restaurant, err := dbHelper.GetRestaurantByID(database.Rest, tab.RestaurantID.String())
+		if err != nil {
+			return err
+		}
+
+		orders, err := dbHelper.ListTabOrders(tx, tab.ID)
+		if err != nil {
+			return err
+		}
+		for _, order := range orders {
+			switch order.Status {
+			case models.OrderDelivered, models.OrderRejected, models.OrderCancelled:
+			default:
+				return errTabUnserved
+			}
+		}
+		shares, err := dbHelper.ListBillShares(tx, tab.ID)
+		if err != nil {
+			return err
+		}
+		total, paid := dinein.Totals(orders, shares, restaurant.Currency)
+		if outstanding = total.Sub(paid); outstanding.IsPositive() {
+			return errTabUnpaid
+		}
+
+		// shares nobody started paying are not needed any more
+		if err := dbHelper.VoidUnpaidBillShares(tx, tab.ID); err != nil {
+			return err
+		}
+		if err := dbHelper.CloseTab(tx, tab.ID, userID); err != nil {
+			return err
+		}
+		now := time.Now()
+		tab.Status = models.TabClosed
+		tab.ClosedAt = &now
+		tab.ClosedBy = &userID
+		return nil
+	})
+	switch {
+	case errors.Is(txErr, errTabNotFound):
+		http.Error(w, "tab not found", http.StatusNotFound)
+	case errors.Is(txErr, errTabClosed):
+		http.Error(w, "the tab is already closed", http.StatusConflict)
+	case errors.Is(txErr, errTabUnserved):
+		http.Error(w, "the tab has orders that are not served yet", http.StatusConflict)
+	case errors.Is(txErr, errTabUnpaid):
+		http.Error(w, "the tab still has "+outstanding.String()+" outstanding", http.StatusConflict)
+	case txErr != nil:
+		http.Error(w, "failed to close tab", http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		utils.JSON.NewEncoder(w).Encode(tab)
+	}
+}
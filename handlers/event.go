@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/events"
+	"new_restaurant/utils"
+	"strconv"
+	"time"
+)
+
+// sseKeepAlive is how often an idle stream sends a comment, so proxies do not
+// close it and dead clients are noticed
+const sseKeepAlive = 25 * time.Second
+
+// writeSSE writes one server-sent event. Events without an ID (courier
+// locations) do not move the client's Last-Event-ID.
+func writeSSE(w http.ResponseWriter, event events.Event) error {
+	data, err := utils.JSON.Marshal(event)
+	if err != nil {
+		return err
+	}
+	frame := "event: " + event.Type + "\ndata: " + string(data) + "\n\n"
+	if event.ID != 0 {
+		frame = "id: " + strconv.FormatInt(event.ID, 10) + "\n" + frame
+	}
+	_, err = w.Write([]byte(frame))
+	return err
+}
+
+// OrderEvents streams an order's status changes and courier locations as
+// server-sent events. The order's past events are sent first; a client that
+// reconnects with Last-Event-ID only gets the ones it missed, which is safe
+// because stored events commit in id order (see CreateOrderEvent). Browsers
+// authenticate with stream_token, as EventSource cannot send headers.
+func OrderEvents(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var lastID int64
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = parsed
+	}
+
+	// subscribe before reading the history so nothing falls between the two
+	sub := events.Default.Subscribe(order.ID)
+	defer sub.Close()
+
+	missed, err := dbHelper.ListOrderEvents(database.Rest, order.ID, lastID)
+	if err != nil {
+		http.Error(w, "failed to fetch order events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range missed {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
+		lastID = event.ID
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-sub.C:
+			if !open {
+				// dropped for falling behind; the client resumes from lastID
+				return
+			}
+			if event.ID != 0 && event.ID <= lastID {
+				continue
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			if event.ID != 0 {
+				lastID = event.ID
+			}
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+)
+
+// ListFavorites returns the caller's saved restaurants and dishes that are
+// still on offer
+func ListFavorites(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	restaurants, err := dbHelper.ListFavoriteRestaurants(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to fetch favorite restaurants", http.StatusInternalServerError)
+		return
+	}
+	dishes, err := dbHelper.ListFavoriteDishes(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to fetch favorite dishes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(models.Favorites{Restaurants: restaurants, Dishes: dishes}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// favoriteFromPath returns the caller and the {id} they are saving or
+// removing, writing the error response if either is missing
+func favoriteFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid ID format", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+func AddFavoriteRestaurant(w http.ResponseWriter, r *http.Request) {
+	userID, restaurantID, ok := favoriteFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String()); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to fetch restaurant", http.StatusInternalServerError)
+		return
+	}
+
+	if err := dbHelper.AddFavoriteRestaurant(database.Rest, userID, restaurantID); err != nil {
+		http.Error(w, "failed to save favorite restaurant", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "restaurant added to favorites"})
+}
+
+func RemoveFavoriteRestaurant(w http.ResponseWriter, r *http.Request) {
+	userID, restaurantID, ok := favoriteFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := dbHelper.RemoveFavoriteRestaurant(database.Rest, userID, restaurantID); err != nil {
+		http.Error(w, "failed to remove favorite restaurant", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "restaurant removed from favorites"})
+}
+
+func AddFavoriteDish(w http.ResponseWriter, r *http.Request) {
+	userID, dishID, ok := favoriteFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := dbHelper.GetDishByID(database.Rest, dishID); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "dish not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to fetch dish", http.StatusInternalServerError)
+		return
+	}
+
+	if err := dbHelper.AddFavoriteDish(database.Rest, userID, dishID); err != nil {
+		http.Error(w, "failed to save favorite dish", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "dish added to favorites"})
+}
+
+func RemoveFavoriteDish(w http.ResponseWriter, r *http.Request) {
+	userID, dishID, ok := favoriteFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := dbHelper.RemoveFavoriteDish(database.Rest, userID, dishID); err != nil {
+		http.Error(w, "failed to remove favorite dish", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "dish removed from favorites"})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"new_restaurant/geocoder"
+	"new_restaurant/utils"
+	"strconv"
+	"strings"
+)
+
+// resolveCoordinates fills in missing coordinates by geocoding address. When
+// coordinates are given, or no geocoder is configured, they are returned as is.
+// On failure the error response is written and ok is false.
+func resolveCoordinates(w http.ResponseWriter, r *http.Request, address string, lat, lon *float64) (*float64, *float64, bool) {
+	if lat != nil || lon != nil || geocoder.Default == nil {
+		return lat, lon, true
+	}
+
+	location, err := geocoder.Default.Geocode(r.Context(), address)
+	if errors.Is(err, geocoder.ErrNotFound) {
+		http.Error(w, "could not find coordinates for address", http.StatusUnprocessableEntity)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, "geocoding failed", http.StatusBadGateway)
+		return nil, nil, false
+	}
+	return &location.Latitude, &location.Longitude, true
+}
+
+func GeocodeAddress(w http.ResponseWriter, r *http.Request) {
+	if geocoder.Default == nil {
+		http.Error(w, "geocoding is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	address := strings.TrimSpace(r.URL.Query().Get("address"))
+	if address == "" {
+		http.Error(w, "address is required", http.StatusBadRequest)
+		return
+	}
+
+	location, err := geocoder.Default.Geocode(r.Context(), address)
+	if errors.Is(err, geocoder.ErrNotFound) {
+		http.Error(w, "address not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "geocoding failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(location); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func ReverseGeocode(w http.ResponseWriter, r *http.Request) {
+	if geocoder.Default == nil {
+		http.Error(w, "geocoding is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	lat, latErr := strconv.ParseFloat(r.URL.Query().Get("latitude"), 64)
+	lon, lonErr := strconv.ParseFloat(r.URL.Query().Get("longitude"), 64)
+	if latErr != nil || lonErr != nil || !utils.ValidCoordinates(&lat, &lon) {
+		http.Error(w, "valid latitude and longitude are required", http.StatusBadRequest)
+		return
+	}
+
+	location, err := geocoder.Default.ReverseGeocode(r.Context(), lat, lon)
+	if errors.Is(err, geocoder.ErrNotFound) {
+		http.Error(w, "no address found for coordinates", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "geocoding failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(location); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/invoice"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"strconv"
+)
+
+// errOrderNotPaid means an invoice was asked for before the order was paid
+var errOrderNotPaid = errors.New("order has not been paid")
+
+// ensureInvoice returns the order's invoice, issuing it if the order has been
+// paid but has none yet. The order row is locked so it is only issued once.
+func ensureInvoice(tx *sqlx.Tx, orderID uuid.UUID) (*models.Invoice, error) {
+	order, err := dbHelper.GetOrderForUpdate(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := dbHelper.GetInvoiceByOrder(tx, orderID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return existing, err
+	}
+	if order.Status == models.OrderPendingPayment || order.Status == models.OrderCancelled {
+		return nil, errOrderNotPaid
+	}
+	return dbHelper.IssueInvoice(tx, orderID)
+}
+
+// GetInvoice returns the invoice of a paid order to its customer or the
+// restaurant's staff. format selects json (the default), pdf, or escpos for a
+// thermal printer, whose line width can be set with width.
+func GetInvoice(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	width := invoice.DefaultWidth
+	switch format {
+	case "", "json", "pdf":
+	case "escpos":
+		if value := r.URL.Query().Get("width"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < invoice.MinWidth || parsed > invoice.MaxWidth {
+				http.Error(w, "width must be between 32 and 64", http.StatusBadRequest)
+				return
+			}
+			width = parsed
+		}
+	default:
+		http.Error(w, "format must be json, pdf or escpos", http.StatusBadRequest)
+		return
+	}
+
+	var issued *models.Invoice
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		issued, err = ensureInvoice(tx, order.ID)
+		return err
+	})
+	if errors.Is(txErr, errOrderNotPaid) {
+		http.Error(w, "order has not been paid", http.StatusConflict)
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to issue invoice", http.StatusInternalServerError)
+		return
+	}
+
+	doc := models.InvoiceWithItems{
+		Invoice:       *issued,
+		InvoiceNumber: issued.InvoiceNumber(),
+		RefundedTotal: order.RefundedTotal,
+	}
+	var err error
+	if doc.Items, err = dbHelper.ListOrderItems(database.Rest, order.ID); err != nil {
+		http.Error(w, "failed to fetch order items", http.StatusInternalServerError)
+		return
+	}
+	if doc.Discounts, err = dbHelper.ListOrderRedemptions(database.Rest, order.ID); err != nil {
+		http.Error(w, "failed to fetch order discounts", http.StatusInternalServerError)
+		return
+	}
+	if doc.Taxes, err = dbHelper.ListInvoicedTaxes(database.Rest, order.ID); err != nil {
+		http.Error(w, "failed to fetch order taxes", http.StatusInternalServerError)
+		return
+	}
+
+	// render into a buffer so a failure can still be reported as an error
+	var body bytes.Buffer
+	filename := doc.InvoiceNumber
+	switch format {
+	case "pdf":
+		if err := invoice.PDF(&body, doc); err != nil {
+			http.Error(w, "failed to render invoice", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.pdf"`)
+	case "escpos":
+		if err := invoice.ESCPOS(&body, doc, width); err != nil {
+			http.Error(w, "failed to render invoice", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=us-ascii")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.txt"`)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		if err := utils.JSON.NewEncoder(&body).Encode(doc); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Write(body.Bytes())
+}
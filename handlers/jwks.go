@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+	"new_restaurant/utils"
+)
+
+// JWKSHandler publishes the public signing keys so other services can verify
+// our tokens without sharing a secret
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": utils.JWKS(),
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
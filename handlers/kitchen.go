@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/events"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"strconv"
+	"time"
+)
+
+const (
+	kitchenWriteWait = 10 * time.Second
+	// the screen must answer a ping within kitchenPongWait
+	kitchenPongWait   = 60 * time.Second
+	kitchenPingPeriod = kitchenPongWait * 9 / 10
+	kitchenMaxMessage = 4096
+)
+
+// kitchenStatuses are the orders a kitchen screen shows
+var kitchenStatuses = []models.OrderStatus{models.OrderPlaced, models.OrderAccepted, models.OrderPreparing, models.OrderReady}
+
+var kitchenUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// kitchenMessageForEvent attaches the order to a status event so the screen
+// can redraw it without another request
+func kitchenMessageForEvent(event events.Event) (models.KitchenMessage, error) {
+	message := models.KitchenMessage{Type: models.KitchenEvent, Event: &event}
+	if event.Type != events.TypeOrderStatus {
+		return message, nil
+	}
+	order, err := dbHelper.GetOrderByID(database.Rest, event.OrderID)
+	if err != nil {
+		return message, err
+	}
+	full, err := orderWithItems(*order)
+	if err != nil {
+		return message, err
+	}
+	message.Order = &full
+	return message, nil
+}
+
+// runKitchenCommand moves one of the restaurant's orders as the kitchen asked.
+// The resulting event reaches every screen through the hub.
+func runKitchenCommand(restaurantID uuid.UUID, command models.KitchenCommand) models.KitchenMessage {
+	result := models.KitchenMessage{Type: models.KitchenResult, Ref: command.Ref}
+
+	next, ok := models.KitchenActions[command.Action]
+	if !ok {
+		result.Error = "action must be accept, reject, ready or serve"
+		return result
+	}
+	orderID, err := uuid.Parse(command.OrderID)
+	if err != nil {
+		result.Error = "invalid order_id"
+		return result
+	}
+	order, err := dbHelper.GetOrderByID(database.Rest, orderID)
+	if err != nil || order.RestaurantID != restaurantID {
+		result.Error = "order not found"
+		return result
+	}
+	if next == models.OrderDelivered && order.TabID == nil {
+		result.Error = "only dine-in orders are served by the kitchen"
+		return result
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbHelper.TransitionOrderStatus(tx, orderID, next)
+	})
+	if errors.Is(txErr, models.ErrInvalidTransition) {
+		result.Error = "cannot " + command.Action + " an order that is " + string(order.Status)
+		return result
+	}
+	if txErr != nil {
+		result.Error = "failed to update order"
+		return result
+	}
+	if next == models.OrderAccepted && order.TabID == nil {
+		dispatchInBackground(orderID)
+	}
+	result.OK = true
+	return result
+}
+
+// KitchenFeed is a WebSocket for a restaurant's kitchen screen. It starts
+// with a snapshot of the open orders, or with the events missed since
+// last_event_id when reconnecting, then pushes every event of the
+// restaurant's orders. The screen sends KitchenCommands to accept, reject or
+// mark orders ready, and to serve dine-in orders. Browsers, which cannot set
+// the Authorization header on a WebSocket, authenticate with stream_token.
+func KitchenFeed(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var lastID int64
+	resume := r.URL.Query().Get("last_event_id")
+	if resume != "" {
+		parsed, err := strconv.ParseInt(resume, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "invalid last_event_id", http.StatusBadRequest)
+			return
+		}
+		lastID = parsed
+	}
+
+	conn, err := kitchenUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already written the error response
+		return
+	}
+	defer conn.Close()
+
+	// subscribe before reading the history so nothing falls between the two
+	sub := events.Default.Subscribe(restaurant.ID)
+	defer sub.Close()
+
+	var backlog []models.KitchenMessage
+	if resume == "" {
+		snapshot := models.KitchenMessage{Type: models.KitchenSnapshot, Orders: make([]models.OrderWithItems, 0)}
+		if lastID, err = dbHelper.LastRestaurantEventID(database.Rest, restaurant.ID); err != nil {
+			logrus.Errorf("kitchen feed: failed to fetch last event: %s", err)
+			return
+		}
+		orders, err := dbHelper.ListRestaurantOrdersByStatus(database.Rest, restaurant.ID, kitchenStatuses)
+		if err != nil {
+			logrus.Errorf("kitchen feed: failed to fetch orders: %s", err)
+			return
+		}
+		for _, order := range orders {
+			full, err := orderWithItems(order)
+			if err != nil {
+				logrus.Errorf("kitchen feed: failed to fetch order %s: %s", order.ID, err)
+				return
+			}
+			snapshot.Orders = append(snapshot.Orders, full)
+		}
+		snapshot.LastEventID = lastID
+		backlog = append(backlog, snapshot)
+	} else {
+		missed, err := dbHelper.ListRestaurantEvents(database.Rest, restaurant.ID, lastID)
+		if err != nil {
+			logrus.Errorf("kitchen feed: failed to fetch events: %s", err)
+			return
+		}
+		for _, event := range missed {
+			message, err := kitchenMessageForEvent(event)
+			if err != nil {
+				logrus.Errorf("kitchen feed: failed to fetch order %s: %s", event.OrderID, err)
+				return
+			}
+			backlog = append(backlog, message)
+			lastID = event.ID
+		}
+	}
+
+	// commands are read on their own goroutine; only this one writes
+	results := make(chan models.KitchenMessage)
+	closed, done := make(chan struct{}), make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(kitchenMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(kitchenPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(kitchenPongWait))
+		})
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var command models.KitchenCommand
+			result := models.KitchenMessage{Type: models.KitchenResult, Error: "invalid command"}
+			if err := utils.JSON.Unmarshal(data, &command); err == nil {
+				result = runKitchenCommand(restaurant.ID, command)
+			}
+			select {
+			case results <- result:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	send := func(message models.KitchenMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(kitchenWriteWait))
+		return conn.WriteJSON(message) == nil
+	}
+	for _, message := range backlog {
+		if !send(message) {
+			return
+		}
+	}
+
+	ping := time.NewTicker(kitchenPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case result := <-results:
+			if !send(result) {
+				return
+			}
+		case event, open := <-sub.C:
+			if !open {
+				// dropped for falling behind; the screen resumes from its last event
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"), time.Now().Add(kitchenWriteWait))
+				return
+			}
+			if event.ID != 0 && event.ID <= lastID {
+				continue
+			}
+			message, err := kitchenMessageForEvent(event)
+			if err != nil {
+				logrus.Errorf("kitchen feed: failed to fetch order %s: %s", event.OrderID, err)
+				return
+			}
+			if !send(message) {
+				return
+			}
+			if event.ID != 0 {
+				lastID = event.ID
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(kitchenWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/pricing"
+	"new_restaurant/utils"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLedgerLimit = 50
+	maxLedgerLimit     = 200
+)
+
+// addPointsToCart lets the cart redeem the customer's loyalty points at its
+// restaurant, writing the error response if the restaurant takes none or the
+// customer does not have enough
+func addPointsToCart(w http.ResponseWriter, userID uuid.UUID, cart *pricing.Cart, points int) bool {
+	if points == 0 {
+		return true
+	}
+	if points < 0 {
+		http.Error(w, "redeem_points must be positive", http.StatusBadRequest)
+		return false
+	}
+
+	settings, err := dbHelper.GetLoyaltySettings(database.Rest, cart.RestaurantID)
+	if err != nil {
+		http.Error(w, "failed to fetch loyalty settings", http.StatusInternalServerError)
+		return false
+	}
+	if settings.PointValue == nil {
+		http.Error(w, "this restaurant does not take loyalty points", http.StatusUnprocessableEntity)
+		return false
+	}
+	balance, err := dbHelper.LoyaltyBalance(database.Rest, userID, cart.RestaurantID, time.Now())
+	if err != nil {
+		http.Error(w, "failed to fetch loyalty points", http.StatusInternalServerError)
+		return false
+	}
+	if balance < points {
+		http.Error(w, fmt.Sprintf("you only have %d points at this restaurant", balance), http.StatusUnprocessableEntity)
+		return false
+	}
+
+	cart.RedeemPoints, cart.PointValue = points, *settings.PointValue
+	return true
+}
+
+func GetLoyaltySettings(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	settings, err := dbHelper.GetLoyaltySettings(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch loyalty settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(settings); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// UpdateLoyaltySettings replaces how a restaurant awards and takes points.
+// Points already earned keep their expiry.
+func UpdateLoyaltySettings(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateLoyaltySettingsRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.EarnRate.IsNegative() || req.EarnRate.GreaterThan(decimal.NewFromInt(1000)) {
+		http.Error(w, "earn_rate must be between 0 and 1000", http.StatusBadRequest)
+		return
+	}
+	if req.PointValue != nil && (req.PointValue.InCurrency(restaurant.Currency) != nil || !req.PointValue.IsPositive()) {
+		http.Error(w, "point_value must be a positive amount in "+restaurant.Currency, http.StatusBadRequest)
+		return
+	}
+	if req.ExpiryDays != nil && (*req.ExpiryDays < 1 || *req.ExpiryDays > 3650) {
+		http.Error(w, "expiry_days must be between 1 and 3650", http.StatusBadRequest)
+		return
+	}
+
+	settings := models.LoyaltySettings{
+		RestaurantID: restaurant.ID,
+		EarnRate:     req.EarnRate,
+		PointValue:   req.PointValue,
+		ExpiryDays:   req.ExpiryDays,
+	}
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbHelper.ReplaceLoyaltySettings(tx, settings)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to update loyalty settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "loyalty settings updated successfully"})
+}
+
+// GetMyLoyalty returns the caller's points at each restaurant and their
+// ledger, newest first. restaurant_id narrows the ledger to one restaurant
+// and limit sets how many entries are returned.
+func GetMyLoyalty(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var restaurantID *uuid.UUID
+	if value := r.URL.Query().Get("restaurant_id"); value != "" {
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "invalid restaurant_id", http.StatusBadRequest)
+			return
+		}
+		restaurantID = &parsed
+	}
+	limit := defaultLedgerLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLedgerLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLedgerLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	// write off expired points first so the ledger shows when they expired
+	now := time.Now()
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if err := dbHelper.LockLoyaltyAccount(tx, userID); err != nil {
+			return err
+		}
+		return dbHelper.ExpireLoyaltyPoints(tx, userID, now)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to update loyalty points", http.StatusInternalServerError)
+		return
+	}
+
+	balances, err := dbHelper.ListLoyaltyBalances(database.Rest, userID, now)
+	if err != nil {
+		http.Error(w, "failed to fetch loyalty points", http.StatusInternalServerError)
+		return
+	}
+	entries, err := dbHelper.ListLoyaltyEntries(database.Rest, userID, restaurantID, limit)
+	if err != nil {
+		http.Error(w, "failed to fetch loyalty ledger", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"balances": balances,
+		"entries":  entries,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
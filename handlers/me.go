@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+)
+
+func GetMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := dbHelper.GetUserByID(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	history, err := dbHelper.GetUserRoles(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to fetch user roles", http.StatusInternalServerError)
+		return
+	}
+
+	addresses, err := dbHelper.ListUserAddresses(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to fetch user addresses", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(models.MeResponse{
+		User:      user,
+		Roles:     activeRoles(history),
+		Addresses: addresses,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg, ok := validateUpdateUserRequest(req); !ok {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := dbHelper.UpdateUser(database.Rest, userID, req.Name, req.Email)
+	if dbHelper.IsUniqueViolation(err) {
+		http.Error(w, "email already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to update profile", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "profile updated successfully"})
+}
+
+func ListMySessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := dbHelper.ListActiveSessions(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": sessions,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// RevokeMySession logs one of the caller's sessions out; its access and
+// stream tokens stop working on their next request
+func RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid session ID format", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := dbHelper.ArchiveUserSession(database.Rest, userID, sessionID)
+	if err != nil {
+		http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "session revoked successfully"})
+}
+
+// RevokeAllMySessions logs the caller out everywhere, including the session
+// making the request
+func RevokeAllMySessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbHelper.ArchiveUserSessions(tx, userID)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "all sessions revoked successfully"})
+}
+
+// CreateStreamToken issues a short-lived token for opening the kitchen feed or
+// an order's event stream from a browser, which cannot send the
+// Authorization header on a WebSocket or EventSource
+func CreateStreamToken(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetClaims(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := utils.GenerateStreamToken(claims.UserID, claims.Role, claims.SessionID)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"stream_token": token,
+		"expires_in":   int(utils.StreamTokenTTL.Seconds()),
+	})
+}
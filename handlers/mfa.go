@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"os"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+// maxMFAAttempts is how many codes can be tried with one login challenge
+// token; after that the user has to log in with their password again
+const maxMFAAttempts = 5
+
+// mfaRequiredForRole reports whether policy forces the given role to use 2FA.
+// MFA_REQUIRED_ROLES is a comma separated list, e.g. "admin,sub_admin"
+func mfaRequiredForRole(role string) bool {
+	for _, required := range strings.Split(os.Getenv("MFA_REQUIRED_ROLES"), ",") {
+		if strings.TrimSpace(required) == role {
+			return true
+		}
+	}
+	return false
+}
+
+func mfaIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "new_restaurant"
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func verifySecondFactor(mfa *models.UserMFA, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return dbHelper.UseRecoveryCode(database.Rest, mfa.UserID, utils.HashRecoveryCode(recoveryCode))
+	}
+
+	step, ok := utils.ValidateTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return dbHelper.ConsumeMFAStep(database.Rest, mfa.ID, step)
+}
+
+// startMFAEnrollment replaces any pending enrollment with a fresh secret
+func startMFAEnrollment(userID uuid.UUID) (*models.MFAEnrollResponse, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dbHelper.GetUserByID(database.Rest, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if err := dbHelper.ArchiveMFA(tx, userID); err != nil {
+			return err
+		}
+		return dbHelper.CreateMFA(tx, models.UserMFA{
+			ID:     uuid.New(),
+			UserID: userID,
+			Secret: secret,
+		})
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return &models.MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(mfaIssuer(), user.Email, secret),
+	}, nil
+}
+
+// completeMFAEnrollment enables a pending enrollment and returns fresh recovery codes
+func completeMFAEnrollment(mfa *models.UserMFA) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, utils.HashRecoveryCode(code))
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if err := dbHelper.EnableMFA(tx, mfa.ID); err != nil {
+			return err
+		}
+		return dbHelper.ReplaceRecoveryCodes(tx, mfa.UserID, hashes)
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return codes, nil
+}
+
+func EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	mfa, err := dbHelper.GetActiveMFA(database.Rest, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "failed to fetch mfa settings", http.StatusInternalServerError)
+		return
+	}
+	if mfa != nil && mfa.EnabledAt != nil {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	enrollment, err := startMFAEnrollment(userID)
+	if err != nil {
+		http.Error(w, "failed to start mfa enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(enrollment)
+}
+
+func ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := dbHelper.GetActiveMFA(database.Rest, userID)
+	if err != nil || mfa.EnabledAt != nil {
+		http.Error(w, "no pending mfa enrollment", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := verifySecondFactor(mfa, req.Code, "")
+	if err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := completeMFAEnrollment(mfa)
+	if err != nil {
+		http.Error(w, "failed to enable mfa", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func DisableMFA(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetClaims(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := utils.GetUserID(r)
+
+	for _, role := range claims.Roles {
+		if mfaRequiredForRole(role) {
+			http.Error(w, "two-factor authentication is required for your role", http.StatusForbidden)
+			return
+		}
+	}
+
+	var req models.MFACodeRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := dbHelper.GetActiveMFA(database.Rest, userID)
+	if err != nil || mfa.EnabledAt == nil {
+		http.Error(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := verifySecondFactor(mfa, req.Code, req.RecoveryCode)
+	if err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbHelper.ArchiveMFA(tx, userID)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to disable mfa", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "two-factor authentication disabled"})
+}
+
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := dbHelper.GetActiveMFA(database.Rest, userID)
+	if err != nil || mfa.EnabledAt == nil {
+		http.Error(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := verifySecondFactor(mfa, req.Code, "")
+	if err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := completeMFAEnrollment(mfa)
+	if err != nil {
+		http.Error(w, "failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// LoginMFAEnrollHandler lets a user whose role requires 2FA enroll using the
+// challenge token, before they have ever received an access token
+func LoginMFAEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.MFALoginRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := utils.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	mfa, err := dbHelper.GetActiveMFA(database.Rest, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "failed to fetch mfa settings", http.StatusInternalServerError)
+		return
+	}
+	if mfa != nil && mfa.EnabledAt != nil {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	enrollment, err := startMFAEnrollment(userID)
+	if err != nil {
+		http.Error(w, "failed to start mfa enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(enrollment)
+}
+
+// LoginMFAHandler exchanges a challenge token plus a TOTP or recovery code for
+// access and refresh tokens. A pending enrollment is confirmed by the same call.
+// Each challenge token allows maxMFAAttempts codes and is used up by a login.
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.MFALoginRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := utils.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	mfa, err := dbHelper.GetActiveMFA(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "two-factor authentication is not set up", http.StatusBadRequest)
+		return
+	}
+
+	// count the attempt before checking the code so parallel requests cannot
+	// try more codes than the token allows
+	tokenID := uuid.MustParse(claims.ID)
+	attempts, err := dbHelper.RecordMFAAttempt(database.Rest, tokenID, userID)
+	if err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if attempts > maxMFAAttempts {
+		http.Error(w, "too many attempts, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	enrolling := mfa.EnabledAt == nil
+	if enrolling && req.RecoveryCode != "" {
+		http.Error(w, "recovery codes cannot be used before enrollment is complete", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := verifySecondFactor(mfa, req.Code, req.RecoveryCode)
+	if err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+	// a challenge token logs in once
+	if err := dbHelper.RevokeMFAChallenge(database.Rest, tokenID, maxMFAAttempts); err != nil {
+		http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+
+	var recoveryCodes []string
+	if enrolling {
+		recoveryCodes, err = completeMFAEnrollment(mfa)
+		if err != nil {
+			http.Error(w, "failed to enable mfa", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tokens, err := issueLoginTokens(userID, claims.Role)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+	}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(response)
+}
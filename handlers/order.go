@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/pricing"
+	"new_restaurant/scheduling"
+	"new_restaurant/utils"
+	"strings"
+	"time"
+)
+
+// buildCart resolves the requested dishes at the restaurant into priced cart
+// lines, merging repeated dishes, and loads the restaurant's tax rules. It
+// writes the error response on failure.
+func buildCart(w http.ResponseWriter, restaurant *models.Restaurant, requested []models.OrderItemRequest) (pricing.Cart, bool) {
+	cart := pricing.Cart{
+		RestaurantID: restaurant.ID,
+		Currency:     restaurant.Currency,
+		DeliveryFee:  restaurant.DeliveryFee,
+	}
+
+	quantities := map[uuid.UUID]int{}
+	dishIDs := make([]uuid.UUID, 0, len(requested))
+	for _, item := range requested {
+		dishID, err := uuid.Parse(item.DishID)
+		if err != nil || item.Quantity < 1 {
+			http.Error(w, "invalid dish_id or quantity", http.StatusBadRequest)
+			return cart, false
+		}
+		if _, seen := quantities[dishID]; !seen {
+			dishIDs = append(dishIDs, dishID)
+		}
+		quantities[dishID] += item.Quantity
+	}
+
+	dishes, err := dbHelper.GetDishesByIDs(database.Rest, restaurant.ID, dishIDs)
+	if err != nil {
+		http.Error(w, "failed to fetch dishes", http.StatusInternalServerError)
+		return cart, false
+	}
+	if len(dishes) != len(dishIDs) {
+		http.Error(w, "some dishes are unavailable at this restaurant", http.StatusUnprocessableEntity)
+		return cart, false
+	}
+
+	for _, dish := range dishes {
+		if dish.Price == nil {
+			http.Error(w, "dish "+dish.Name+" has no price", http.StatusUnprocessableEntity)
+			return cart, false
+		}
+		cart.Lines = append(cart.Lines, pricing.Line{
+			DishID:    dish.ID,
+			Name:      dish.Name,
+			Category:  dish.Category,
+			UnitPrice: *dish.Price,
+			Quantity:  quantities[dish.ID],
+		})
+	}
+
+	rules, err := dbHelper.GetTaxRules(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch tax rules", http.StatusInternalServerError)
+		return cart, false
+	}
+	cart.Tax = *rules
+	return cart, true
+}
+
+// priceCart applies the automatic promotions and the entered promo code to the
+// cart, writing the error response if the promotions cannot be loaded
+func priceCart(w http.ResponseWriter, userID uuid.UUID, cart pricing.Cart, promoCode string) (pricing.Quote, bool) {
+	automatic, err := dbHelper.ListAutomaticPromotions(database.Rest, cart.RestaurantID, userID)
+	if err != nil {
+		http.Error(w, "failed to fetch promotions", http.StatusInternalServerError)
+		return pricing.Quote{}, false
+	}
+
+	var code *models.Promotion
+	codeMissing := false
+	if promoCode = strings.TrimSpace(promoCode); promoCode != "" {
+		code, err = dbHelper.GetPromotionByCode(database.Rest, promoCode, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			codeMissing = true
+		} else if err != nil {
+			http.Error(w, "failed to fetch promo code", http.StatusInternalServerError)
+			return pricing.Quote{}, false
+		}
+	}
+
+	quote := pricing.Price(cart, automatic, code, time.Now())
+	if codeMissing {
+		quote.PromoCodeError = "promo code not found"
+	}
+	return quote, true
+}
+
+// PriceCart returns the price breakdown of a cart, including every discount
+// that would be applied, without placing an order
+func PriceCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.PriceCartRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Items) == 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := uuid.Parse(req.RestaurantID); err != nil {
+		http.Error(w, "invalid restaurant_id", http.StatusBadRequest)
+		return
+	}
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, req.RestaurantID)
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+
+	cart, ok := buildCart(w, restaurant, req.Items)
+	if !ok || !addPointsToCart(w, userID, &cart, req.RedeemPoints) {
+		return
+	}
+	quote, ok := priceCart(w, userID, cart, req.PromoCode)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(quote); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// errPromotionUnavailable means a promotion in the quote was used up or
+// expired between pricing and placing the order
+var errPromotionUnavailable = errors.New("promotion no longer available")
+
+// errSlotFull means the scheduled slot reached its capacity while ordering
+var errSlotFull = errors.New("slot is fully booked")
+
+func CreateOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateOrderRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Items) == 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := uuid.Parse(req.RestaurantID); err != nil {
+		http.Error(w, "invalid restaurant_id", http.StatusBadRequest)
+		return
+	}
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, req.RestaurantID)
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+
+	full, ok := placeOrder(w, userID, restaurant, req)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(full)
+}
+
+// placeOrder prices the requested items and places the customer's order,
+// writing the error response if it cannot be placed
+func placeOrder(w http.ResponseWriter, userID uuid.UUID, restaurant *models.Restaurant, req models.CreateOrderRequest) (models.OrderWithItems, bool) {
+	address, err := dbHelper.GetUserAddress(database.Rest, req.UserAddressID, userID)
+	if err != nil {
+		http.Error(w, "user address not found", http.StatusNotFound)
+		return models.OrderWithItems{}, false
+	}
+
+	var schedule *models.RestaurantSchedule
+	if req.ScheduledFor != nil {
+		schedule, err = dbHelper.GetRestaurantSchedule(database.Rest, restaurant.ID)
+		if err != nil {
+			http.Error(w, "failed to fetch restaurant schedule", http.StatusInternalServerError)
+			return models.OrderWithItems{}, false
+		}
+		if err := scheduling.CheckSlot(*schedule, *req.ScheduledFor, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return models.OrderWithItems{}, false
+		}
+	}
+
+	cart, ok := buildCart(w, restaurant, req.Items)
+	if !ok || !addPointsToCart(w, userID, &cart, req.RedeemPoints) {
+		return models.OrderWithItems{}, false
+	}
+	quote, ok := priceCart(w, userID, cart, req.PromoCode)
+	if !ok {
+		return models.OrderWithItems{}, false
+	}
+	if quote.PromoCodeError != "" {
+		http.Error(w, quote.PromoCodeError, http.StatusUnprocessableEntity)
+		return models.OrderWithItems{}, false
+	}
+
+	order := models.Order{
+		ID:               uuid.New(),
+		UserID:           &userID,
+		RestaurantID:     restaurant.ID,
+		UserAddressID:    &address.ID,
+		Status:           models.OrderPendingPayment,
+		ScheduledFor:     req.ScheduledFor,
+		Subtotal:         quote.Subtotal,
+		DeliveryFee:      quote.DeliveryFee,
+		PackagingFee:     quote.PackagingFee,
+		ServiceCharge:    quote.ServiceCharge,
+		DiscountTotal:    quote.DiscountTotal,
+		PointsRedeemed:   quote.PointsRedeemed,
+		PointsDiscount:   quote.PointsDiscount,
+		TaxTotal:         quote.TaxTotal,
+		PricesIncludeTax: quote.PricesIncludeTax,
+		Total:            quote.Total,
+	}
+
+	items := make([]models.OrderItem, 0, len(quote.Lines))
+	for _, line := range quote.Lines {
+		item := models.OrderItem{
+			ID:             uuid.New(),
+			OrderID:        order.ID,
+			DishID:         line.DishID,
+			Name:           line.Name,
+			Category:       line.Category,
+			UnitPrice:      line.UnitPrice,
+			Quantity:       line.Quantity,
+			DiscountAmount: line.Discount,
+			TaxAmount:      line.TaxTotal,
+			LineTotal:      line.Total,
+			Taxes:          make([]models.OrderItemTax, 0, len(line.Taxes)),
+		}
+		for _, tax := range line.Taxes {
+			item.Taxes = append(item.Taxes, models.OrderItemTax{OrderItemID: item.ID, TaxAmount: tax})
+		}
+		items = append(items, item)
+	}
+
+	discounts := make([]models.PromotionRedemption, 0, len(quote.Discounts))
+	for _, discount := range quote.Discounts {
+		discounts = append(discounts, models.PromotionRedemption{
+			ID:          uuid.New(),
+			PromotionID: discount.PromotionID,
+			UserID:      userID,
+			OrderID:     order.ID,
+			Name:        discount.Name,
+			Amount:      discount.Amount,
+		})
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if schedule != nil && schedule.SlotCapacity != nil {
+			if err := dbHelper.LockRestaurantSlots(tx, restaurant.ID); err != nil {
+				return err
+			}
+			slotEnd := order.ScheduledFor.Add(time.Duration(schedule.SlotMinutes) * time.Minute)
+			counts, err := dbHelper.CountSlotOrders(tx, restaurant.ID, *order.ScheduledFor, slotEnd)
+			if err != nil {
+				return err
+			}
+			booked := 0
+			for _, count := range counts {
+				booked += count
+			}
+			if booked >= *schedule.SlotCapacity {
+				return errSlotFull
+			}
+		}
+
+		if err := dbHelper.CreateOrder(tx, order); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := dbHelper.CreateOrderItem(tx, item); err != nil {
+				return err
+			}
+		}
+
+		// points are spent with the order and come back if it is called off
+		// or expires unpaid; the balance is checked again under lock so
+		// concurrent orders cannot spend the same points
+		if order.PointsRedeemed > 0 {
+			if err := dbHelper.LockLoyaltyAccount(tx, userID); err != nil {
+				return err
+			}
+			if err := dbHelper.ExpireLoyaltyPoints(tx, userID, time.Now()); err != nil {
+				return err
+			}
+			if err := dbHelper.RedeemLoyaltyPoints(tx, userID, restaurant.ID, order.ID, order.PointsRedeemed); err != nil {
+				return err
+			}
+		}
+
+		// usage limits are checked again under lock so concurrent orders
+		// cannot redeem a promotion past its limit
+		for _, discount := range discounts {
+			promotion, err := dbHelper.GetPromotionForUpdate(tx, discount.PromotionID, userID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return errPromotionUnavailable
+			}
+			if err != nil {
+				return err
+			}
+			if pricing.CheckEligibility(*promotion, cart, time.Now()) != nil {
+				return errPromotionUnavailable
+			}
+			if err := dbHelper.CreatePromotionRedemption(tx, discount); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(txErr, errPromotionUnavailable) {
+		http.Error(w, "a promotion is no longer available, please price your cart again", http.StatusConflict)
+		return models.OrderWithItems{}, false
+	}
+	if errors.Is(txErr, dbHelper.ErrNotEnoughPoints) {
+		http.Error(w, "your loyalty points changed, please price your cart again", http.StatusConflict)
+		return models.OrderWithItems{}, false
+	}
+	if errors.Is(txErr, errSlotFull) {
+		http.Error(w, "this slot is fully booked, please pick another", http.StatusConflict)
+		return models.OrderWithItems{}, false
+	}
+	if txErr != nil {
+		http.Error(w, "failed to create order", http.StatusInternalServerError)
+		return models.OrderWithItems{}, false
+	}
+
+	return models.OrderWithItems{
+		Order:     order,
+		Items:     items,
+		Discounts: discounts,
+		Taxes:     quote.Taxes,
+	}, true
+}
+
+func ListMyOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	orders, err := dbHelper.ListOrdersByUser(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to list orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"orders": orders,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// isRestaurantStaff reports whether the caller is an admin, or the sub admin
+// who created the restaurant
+func isRestaurantStaff(r *http.Request, restaurantID uuid.UUID) bool {
+	if utils.HasRole(r, "admin") {
+		return true
+	}
+	if !utils.HasRole(r, "sub_admin") {
+		return false
+	}
+
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		return false
+	}
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String())
+	return err == nil && restaurant.CreatedBy == userID
+}
+
+// orderFromPath loads the {id} order if the caller placed it or works at its
+// restaurant, writing the error response otherwise
+func orderFromPath(w http.ResponseWriter, r *http.Request) (*models.Order, bool) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	orderID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid order ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	order, err := dbHelper.GetOrderByID(database.Rest, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch order", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !order.PlacedBy(userID) && !isRestaurantStaff(r, order.RestaurantID) {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return nil, false
+	}
+	return order, true
+}
+
+// orderWithItems loads everything shown with an order
+func orderWithItems(order models.Order) (models.OrderWithItems, error) {
+	full := models.OrderWithItems{Order: order}
+	var err error
+	if full.Items, err = dbHelper.ListOrderItems(database.Rest, order.ID); err != nil {
+		return full, err
+	}
+	if err = dbHelper.LoadOrderItemTaxes(database.Rest, full.Items); err != nil {
+		return full, err
+	}
+	if full.Discounts, err = dbHelper.ListOrderRedemptions(database.Rest, order.ID); err != nil {
+		return full, err
+	}
+	full.Taxes, err = dbHelper.ListOrderTaxes(database.Rest, order.ID)
+	return full, err
+}
+
+func GetOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	full, err := orderWithItems(*order)
+	if err != nil {
+		http.Error(w, "failed to fetch order details", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(full); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
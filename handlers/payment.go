@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/payments"
+	"new_restaurant/utils"
+)
+
+const maxWebhookBodySize = 1 << 20
+
+var errUnknownPayment = errors.New("unknown payment")
+
+// errOrderNotPayable means the order stopped awaiting payment, e.g. it
+// expired, before its payment was created
+var errOrderNotPayable = errors.New("order is not awaiting payment")
+
+// paymentStatusFromProvider maps provider statuses onto our payment_status enum
+func paymentStatusFromProvider(status payments.Status) models.PaymentStatus {
+	switch status {
+	case payments.StatusAuthorized:
+		return models.PaymentAuthorized
+	case payments.StatusCaptured:
+		return models.PaymentCaptured
+	case payments.StatusFailed:
+		return models.PaymentFailed
+	default:
+		return models.PaymentPending
+	}
+}
+
+// advancePayment moves a locked payment forward and, once the money is
+// captured, releases its order to the restaurant and invoices it. Stale or
+// repeated updates are ignored so that synchronous results and webhooks can
+// race safely.
+func advancePayment(tx *sqlx.Tx, payment *models.Payment, status models.PaymentStatus, providerRef, reason string) error {
+	if providerRef != "" && payment.ProviderRef == nil {
+		payment.ProviderRef = &providerRef
+	}
+	if !payment.Status.CanAdvanceTo(status) {
+		return dbHelper.UpdatePayment(tx, *payment)
+	}
+
+	payment.Status = status
+	if reason != "" {
+		payment.FailureReason = &reason
+	}
+	if err := dbHelper.UpdatePayment(tx, *payment); err != nil {
+		return err
+	}
+
+	if status != models.PaymentCaptured {
+		return nil
+	}
+	if payment.BillShareID != nil {
+		// tab orders went to the kitchen when they were placed; paying a
+		// share only settles part of the bill
+		return dbHelper.MarkBillSharePaid(tx, *payment.BillShareID)
+	}
+
+	orderID := *payment.OrderID
+	order, err := dbHelper.GetOrderForUpdate(tx, orderID)
+	if err != nil {
+		return err
+	}
+	// pre-orders wait for the scheduler to release them to the kitchen
+	next := models.OrderPlaced
+	if order.ScheduledFor != nil {
+		next = models.OrderScheduled
+	}
+	err = dbHelper.TransitionOrderStatus(tx, orderID, next)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		// the order moved on (e.g. was cancelled) while the payment was in flight
+		logrus.Warnf("payment %s captured for order %s that can no longer be placed", payment.ID, orderID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// invoices are numbered in the order payments are captured
+	_, err = ensureInvoice(tx, orderID)
+	return err
+}
+
+// applyPaymentResult records a synchronous provider result for a payment
+func applyPaymentResult(paymentID uuid.UUID, result *payments.Result) (*models.Payment, error) {
+	var payment *models.Payment
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		payment, err = dbHelper.GetPaymentForUpdate(tx, paymentID)
+		if err != nil {
+			return err
+		}
+		return advancePayment(tx, payment, paymentStatusFromProvider(result.Status), result.ProviderRef, result.FailureReason)
+	})
+	return payment, txErr
+}
+
+// PayOrder authorizes and captures the order total with the configured
+// provider. Retries with the same Idempotency-Key header return the original
+// payment instead of charging again, and an attempt left unfinished is
+// resumed rather than started over.
+func PayOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	userID, _ := utils.GetUserID(r)
+	if !order.PlacedBy(userID) {
+		http.Error(w, "only the customer can pay for an order", http.StatusForbidden)
+		return
+	}
+
+	// one attempt per order until it fails, then a fresh attempt is allowed
+	key, done := paymentKey(w, r, "user:"+userID.String(), func() (string, error) {
+		failed, err := dbHelper.CountFailedPayments(database.Rest, order.ID)
+		return fmt.Sprintf("order:%s:%d", order.ID, failed), err
+	}, func(existing *models.Payment) bool {
+		return existing.OrderID != nil && *existing.OrderID == order.ID
+	}, order.ID.String())
+	if done {
+		return
+	}
+
+	if order.Status != models.OrderPendingPayment {
+		http.Error(w, "order is not awaiting payment", http.StatusConflict)
+		return
+	}
+
+	payment := models.Payment{
+		ID:             uuid.New(),
+		OrderID:        &order.ID,
+		Provider:       payments.Default.Name(),
+		Amount:         order.Total.Amount,
+		Currency:       order.Total.Currency,
+		Status:         models.PaymentPending,
+		IdempotencyKey: key,
+	}
+
+	// the order lock keeps unpaid order expiry from cancelling it meanwhile
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		locked, err := dbHelper.GetOrderForUpdate(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		if locked.Status != models.OrderPendingPayment {
+			return errOrderNotPayable
+		}
+		return dbHelper.CreatePayment(tx, payment)
+	})
+	if errors.Is(txErr, errOrderNotPayable) {
+		http.Error(w, "order is not awaiting payment", http.StatusConflict)
+		return
+	}
+	if dbHelper.IsUniqueViolation(txErr) {
+		// another attempt is live; carry on with it instead of charging twice
+		live, err := dbHelper.GetLivePayment(database.Rest, order.ID)
+		if err != nil {
+			http.Error(w, "a payment for this order is already in progress", http.StatusConflict)
+			return
+		}
+		chargePayment(w, r, *live, order.ID.String())
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	chargePayment(w, r, payment, order.ID.String())
+}
+
+// paymentKey returns the request's Idempotency-Key within namespace, or the
+// key made by fallback if none was sent. Namespacing keeps clients from
+// taking another payer's keys or the fallback keys. If a payment was already
+// made with the key it is resumed with reference and written as the response,
+// and done is true; payments made for anything ownedBy does not accept are a
+// conflict.
+func paymentKey(w http.ResponseWriter, r *http.Request, namespace string, fallback func() (string, error), ownedBy func(*models.Payment) bool, reference string) (key string, done bool) {
+	if key = r.Header.Get("Idempotency-Key"); key != "" {
+		key = namespace + ":" + key
+	} else {
+		var err error
+		if key, err = fallback(); err != nil {
+			http.Error(w, "failed to fetch payments", http.StatusInternalServerError)
+			return "", true
+		}
+	}
+
+	existing, err := dbHelper.GetPaymentByIdempotencyKey(database.Rest, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, false
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch payment", http.StatusInternalServerError)
+		return "", true
+	}
+	if !ownedBy(existing) {
+		http.Error(w, "idempotency key already used for another payment", http.StatusConflict)
+		return "", true
+	}
+	chargePayment(w, r, *existing, reference)
+	return "", true
+}
+
+// chargePayment authorizes and captures a recorded payment with the
+// configured provider and writes the resulting payment as the response.
+// Payments an earlier attempt left pending or authorized, e.g. because the
+// provider was unreachable, carry on from where they stopped; the provider
+// answers the repeated calls by their idempotency keys, so nothing is charged
+// twice. Finished payments are written as they are.
+func chargePayment(w http.ResponseWriter, r *http.Request, payment models.Payment, reference string) {
+	provider := payments.Default
+	key := payment.IdempotencyKey
+	updated := &payment
+
+	if updated.Status == models.PaymentPending {
+		result, err := provider.Authorize(r.Context(), payments.AuthorizeRequest{
+			Amount:         payment.Amount,
+			Currency:       payment.Currency,
+			Reference:      reference,
+			IdempotencyKey: key,
+		})
+		if err != nil {
+			logrus.Errorf("payment %s authorization failed: %v", payment.ID, err)
+			http.Error(w, "payment provider unavailable", http.StatusBadGateway)
+			return
+		}
+		if updated, err = applyPaymentResult(payment.ID, result); err != nil {
+			http.Error(w, "failed to record payment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// payments are captured as soon as they are authorized
+	if updated.Status == models.PaymentAuthorized && updated.ProviderRef != nil {
+		result, err := provider.Capture(r.Context(), *updated.ProviderRef, updated.Amount, key+":capture")
+		if err != nil {
+			logrus.Errorf("payment %s capture failed: %v", payment.ID, err)
+			http.Error(w, "payment provider unavailable", http.StatusBadGateway)
+			return
+		}
+		if updated, err = applyPaymentResult(payment.ID, result); err != nil {
+			http.Error(w, "failed to record payment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if updated.Status == models.PaymentFailed {
+		w.WriteHeader(http.StatusPaymentRequired)
+	}
+	utils.JSON.NewEncoder(w).Encode(updated)
+}
+
+func ListOrderPayments(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	orderPayments, err := dbHelper.ListPaymentsByOrder(database.Rest, order.ID)
+	if err != nil {
+		http.Error(w, "failed to list payments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"payments": orderPayments,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// PaymentWebhook receives signed notifications from the payment provider.
+// Each event is applied at most once; redeliveries are acknowledged with 200.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	provider := payments.Default
+	if mux.Vars(r)["provider"] != provider.Name() {
+		http.Error(w, "unknown payment provider", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := provider.VerifyWebhook(body, r.Header)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	duplicate := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		recorded, err := dbHelper.RecordWebhookEvent(tx, provider.Name(), event.ID, event.Type, body)
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			duplicate = true
+			return nil
+		}
+		return applyWebhookEvent(tx, provider.Name(), event)
+	})
+	if errors.Is(txErr, errUnknownPayment) {
+		// not recorded, so the provider's retry will be processed once we know the payment
+		http.Error(w, "unknown payment", http.StatusNotFound)
+		return
+	}
+	if txErr != nil {
+		logrus.Errorf("failed to process %s webhook %s: %v", provider.Name(), event.ID, txErr)
+		http.Error(w, "failed to process webhook", http.StatusInternalServerError)
+		return
+	}
+
+	status := "processed"
+	if duplicate {
+		status = "duplicate"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// applyWebhookEvent updates our records from a verified, first-seen webhook event
+func applyWebhookEvent(tx *sqlx.Tx, provider string, event *payments.WebhookEvent) error {
+	var status models.PaymentStatus
+	switch event.Type {
+	case payments.EventRefundSucceeded, payments.EventRefundFailed:
+		refund, err := dbHelper.GetRefundByProviderRefForUpdate(tx, event.ProviderRef)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errUnknownPayment
+		}
+		if err != nil {
+			return err
+		}
+		refundStatus := models.RefundSucceeded
+		if event.Type == payments.EventRefundFailed {
+			refundStatus = models.RefundFailed
+		}
+		return completeRefund(tx, refund, refundStatus, "")
+	case payments.EventPaymentAuthorized:
+		status = models.PaymentAuthorized
+	case payments.EventPaymentCaptured:
+		status = models.PaymentCaptured
+	case payments.EventPaymentFailed:
+		status = models.PaymentFailed
+	default:
+		logrus.Infof("ignoring %s webhook event type %q", provider, event.Type)
+		return nil
+	}
+
+	payment, err := dbHelper.GetPaymentByProviderRefForUpdate(tx, provider, event.ProviderRef)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUnknownPayment
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.PaymentFailed && event.Amount != payment.Amount {
+		// never release an order for a different amount than it costs; the
+		// event stays recorded for someone to reconcile
+		logrus.Errorf("%s webhook %s reports %d for payment %s of %d, not applied",
+			provider, event.ID, event.Amount, payment.ID, payment.Amount)
+		return nil
+	}
+	return advancePayment(tx, payment, status, "", event.FailureReason)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"new_restaurant/utils"
+	"strings"
+	"time"
+)
+
+// validatePromotionRequest checks that the fields a promotion type needs are
+// present and returns the reason otherwise
+func validatePromotionRequest(req models.CreatePromotionRequest) string {
+	if strings.TrimSpace(req.Name) == "" || !req.Type.IsValid() {
+		return "name and a valid type are required"
+	}
+	if req.MinOrderValue != nil && req.MinOrderValue.IsNegative() || req.MaxDiscount != nil && !req.MaxDiscount.IsPositive() ||
+		req.UsageLimit != nil && *req.UsageLimit < 1 || req.PerUserLimit != nil && *req.PerUserLimit < 1 {
+		return "invalid min_order_value, max_discount or usage limits"
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return "ends_at must be after starts_at"
+	}
+
+	switch req.Type {
+	case models.PromotionPercentage:
+		if req.PercentOff == nil || !req.PercentOff.IsPositive() || req.PercentOff.GreaterThan(decimal.NewFromInt(100)) {
+			return "percentage promotions need a percent_off between 0 and 100"
+		}
+	case models.PromotionFlat:
+		if req.AmountOff == nil || !req.AmountOff.IsPositive() {
+			return "flat promotions need a positive amount_off"
+		}
+	case models.PromotionBOGO:
+		if req.RestaurantID == nil || len(req.DishIDs) == 0 {
+			return "bogo promotions need a restaurant_id and dish_ids"
+		}
+	}
+	return ""
+}
+
+func CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") && !utils.HasRole(r, "sub_admin") {
+		http.Error(w, "only admin and sub_admin can create promotions", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreatePromotionRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if reason := validatePromotionRequest(req); reason != "" {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+
+	promotion := models.Promotion{
+		ID:            uuid.New(),
+		Name:          strings.TrimSpace(req.Name),
+		Type:          req.Type,
+		PercentOff:    req.PercentOff,
+		AmountOff:     req.AmountOff,
+		MaxDiscount:   req.MaxDiscount,
+		MinOrderValue: req.MinOrderValue,
+		StartsAt:      time.Now(),
+		EndsAt:        req.EndsAt,
+		UsageLimit:    req.UsageLimit,
+		PerUserLimit:  req.PerUserLimit,
+		CreatedBy:     userID,
+	}
+	if req.StartsAt != nil {
+		promotion.StartsAt = *req.StartsAt
+	}
+	if req.Code != nil {
+		if code := strings.ToUpper(strings.TrimSpace(*req.Code)); code != "" {
+			promotion.Code = &code
+		}
+	}
+
+	// sub admins may only run promotions at their own restaurants
+	if req.RestaurantID != nil {
+		restaurantID, err := uuid.Parse(*req.RestaurantID)
+		if err != nil {
+			http.Error(w, "invalid restaurant_id", http.StatusBadRequest)
+			return
+		}
+		if !isRestaurantStaff(r, restaurantID) {
+			http.Error(w, "you can only create promotions for your own restaurants", http.StatusForbidden)
+			return
+		}
+		promotion.RestaurantID = &restaurantID
+	} else if !utils.HasRole(r, "admin") {
+		http.Error(w, "only admin can create promotions for every restaurant", http.StatusForbidden)
+		return
+	}
+
+	// amounts are in the restaurant's currency; promotions for every
+	// restaurant are in the default one and only apply where it is used
+	currency := money.DefaultCurrency
+	if promotion.RestaurantID != nil {
+		restaurant, err := dbHelper.GetRestaurantByID(database.Rest, promotion.RestaurantID.String())
+		if err != nil {
+			http.Error(w, "restaurant not found", http.StatusNotFound)
+			return
+		}
+		currency = restaurant.Currency
+	}
+	for _, amount := range []*money.Money{promotion.AmountOff, promotion.MaxDiscount, promotion.MinOrderValue} {
+		if amount != nil && amount.InCurrency(currency) != nil {
+			http.Error(w, "amounts must be in "+currency, http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, id := range req.DishIDs {
+		dishID, err := uuid.Parse(id)
+		if err != nil {
+			http.Error(w, "invalid dish_ids", http.StatusBadRequest)
+			return
+		}
+		promotion.DishIDs = append(promotion.DishIDs, dishID)
+	}
+	if len(promotion.DishIDs) > 0 {
+		if promotion.RestaurantID == nil {
+			http.Error(w, "dish_ids need a restaurant_id", http.StatusBadRequest)
+			return
+		}
+		dishes, err := dbHelper.GetDishesByIDs(database.Rest, *promotion.RestaurantID, promotion.DishIDs)
+		if err != nil {
+			http.Error(w, "failed to fetch dishes", http.StatusInternalServerError)
+			return
+		}
+		if len(dishes) != len(promotion.DishIDs) {
+			http.Error(w, "some dishes do not belong to this restaurant", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if err := dbHelper.CreatePromotion(tx, promotion); err != nil {
+			return err
+		}
+		for _, dishID := range promotion.DishIDs {
+			if err := dbHelper.AddPromotionDish(tx, promotion.ID, dishID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if dbHelper.IsUniqueViolation(txErr) {
+		http.Error(w, "promo code already exists", http.StatusConflict)
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to create promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(promotion)
+}
+
+// ListPromotions returns every promotion to admins, and to sub admins the ones
+// they created or that run at their restaurants
+func ListPromotions(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") && !utils.HasRole(r, "sub_admin") {
+		http.Error(w, "only admin and sub_admin can list promotions", http.StatusForbidden)
+		return
+	}
+
+	var createdBy *uuid.UUID
+	if !utils.HasRole(r, "admin") {
+		userID, ok := utils.GetUserID(r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		createdBy = &userID
+	}
+
+	promotions, err := dbHelper.ListPromotions(database.Rest, createdBy)
+	if err != nil {
+		http.Error(w, "failed to list promotions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"promotions": promotions,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// DeletePromotion ends a promotion; orders that already used it keep their discount
+func DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") && !utils.HasRole(r, "sub_admin") {
+		http.Error(w, "only admin and sub_admin can delete promotions", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	promotionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid promotion ID format", http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := dbHelper.GetPromotionByID(database.Rest, promotionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "promotion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch promotion", http.StatusInternalServerError)
+		return
+	}
+
+	if !utils.HasRole(r, "admin") && promotion.CreatedBy != userID &&
+		(promotion.RestaurantID == nil || !isRestaurantStaff(r, *promotion.RestaurantID)) {
+		http.Error(w, "you can only delete your own promotions", http.StatusForbidden)
+		return
+	}
+
+	if err := dbHelper.ArchivePromotion(database.Rest, promotion.ID); err != nil {
+		http.Error(w, "failed to delete promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "promotion deleted successfully"})
+}
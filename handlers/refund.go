@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"new_restaurant/payments"
+	"new_restaurant/utils"
+)
+
+var (
+	errNotRefundable     = errors.New("order has no captured payment to refund")
+	errNothingToRefund   = errors.New("nothing left to refund")
+	errInvalidRefundItem = errors.New("invalid order item or quantity")
+)
+
+// buildRefundItems turns a refund request into ledger lines, checking each
+// quantity against what has not been refunded or reserved by a pending refund
+func buildRefundItems(req models.CreateRefundRequest, items []models.OrderItem, pending map[uuid.UUID]int) ([]models.RefundItem, error) {
+	remaining := make(map[uuid.UUID]int, len(items))
+	lines := make(map[uuid.UUID]models.OrderItem, len(items))
+	for _, item := range items {
+		remaining[item.ID] = item.Quantity - item.RefundedQuantity - pending[item.ID]
+		lines[item.ID] = item
+	}
+
+	requested := map[uuid.UUID]int{}
+	order := make([]uuid.UUID, 0)
+	if req.Full {
+		for _, item := range items {
+			if remaining[item.ID] > 0 {
+				requested[item.ID] = remaining[item.ID]
+				order = append(order, item.ID)
+			}
+		}
+	} else {
+		for _, line := range req.Items {
+			itemID, err := uuid.Parse(line.OrderItemID)
+			if _, known := remaining[itemID]; err != nil || !known || line.Quantity < 1 {
+				return nil, errInvalidRefundItem
+			}
+			if _, seen := requested[itemID]; !seen {
+				order = append(order, itemID)
+			}
+			requested[itemID] += line.Quantity
+			if requested[itemID] > remaining[itemID] {
+				return nil, errInvalidRefundItem
+			}
+		}
+	}
+
+	if len(order) == 0 {
+		return nil, errNothingToRefund
+	}
+
+	refundItems := make([]models.RefundItem, 0, len(order))
+	for _, itemID := range order {
+		// units are refunded at what the customer paid for them, after
+		// discounts and including tax, taking them after the ones already
+		// refunded so that refunding every unit gives back the line total
+		line := lines[itemID]
+		from := line.RefundedQuantity + pending[itemID]
+		amount := money.UnitsCost(line.LineTotal, line.Quantity, from, requested[itemID])
+		refundItems = append(refundItems, models.RefundItem{
+			ID:          uuid.New(),
+			OrderItemID: itemID,
+			Quantity:    requested[itemID],
+			FirstUnit:   from,
+			Amount:      amount.Amount,
+		})
+	}
+	return refundItems, nil
+}
+
+// refundShares works out the refunded units' share of their lines' discounts
+// and of each line tax. The shares are taken for the same units the refund
+// was priced for, so once every unit of a line is refunded its whole discount
+// and tax have been given back.
+func refundShares(orderItems []models.OrderItem, refundItems []models.RefundItem, currency string) (money.Money, []models.OrderItemTax) {
+	lines := make(map[uuid.UUID]models.OrderItem, len(orderItems))
+	for _, item := range orderItems {
+		lines[item.ID] = item
+	}
+
+	discount := money.Zero(currency)
+	taxes := make([]models.OrderItemTax, 0)
+	for _, refunded := range refundItems {
+		line := lines[refunded.OrderItemID]
+		discount = discount.Add(money.UnitsCost(line.DiscountAmount, line.Quantity, refunded.FirstUnit, refunded.Quantity))
+		for _, tax := range line.Taxes {
+			tax.Refunded = money.UnitsCost(tax.Amount, line.Quantity, refunded.FirstUnit, refunded.Quantity)
+			taxes = append(taxes, tax)
+		}
+	}
+	return discount, taxes
+}
+
+// completeRefund settles a pending refund. On success the refunded units are
+// removed from the order, points it earned on them are taken back, and an
+// order whose every item is refunded is cancelled.
+func completeRefund(tx *sqlx.Tx, refund *models.Refund, status models.RefundStatus, providerRef string) error {
+	if refund.Status != models.RefundPending {
+		return nil
+	}
+
+	refund.Status = status
+	if providerRef != "" {
+		refund.ProviderRef = &providerRef
+	}
+	if err := dbHelper.UpdateRefund(tx, *refund); err != nil {
+		return err
+	}
+	if status != models.RefundSucceeded {
+		return nil
+	}
+
+	order, err := dbHelper.GetOrderForUpdate(tx, refund.OrderID)
+	if err != nil {
+		return err
+	}
+	refundItems, err := dbHelper.ListRefundItems(tx, refund.ID)
+	if err != nil {
+		return err
+	}
+	orderItems, err := dbHelper.ListOrderItems(tx, refund.OrderID)
+	if err != nil {
+		return err
+	}
+	if err := dbHelper.LoadOrderItemTaxes(tx, orderItems); err != nil {
+		return err
+	}
+	discount, taxes := refundShares(orderItems, refundItems, refund.Currency)
+	amount := money.New(refund.Amount, refund.Currency)
+	if err := dbHelper.ApplyRefundToOrder(tx, refund.OrderID, refundItems, amount, discount, taxes); err != nil {
+		return err
+	}
+	// a delivered order already earned points on the amount now refunded
+	if err := dbHelper.ClawBackLoyaltyPoints(tx, *order, amount); err != nil {
+		return err
+	}
+
+	refunded := make(map[uuid.UUID]int, len(refundItems))
+	for _, item := range refundItems {
+		refunded[item.OrderItemID] += item.Quantity
+	}
+	for _, item := range orderItems {
+		if item.RefundedQuantity+refunded[item.ID] < item.Quantity {
+			return nil
+		}
+	}
+
+	err = dbHelper.TransitionOrderStatus(tx, refund.OrderID, models.OrderCancelled)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		// already delivered or on its way; the refund stands but the order is not cancelled
+		return nil
+	}
+	return err
+}
+
+// processRefund sends a pending refund to the provider and records the
+// outcome. The refund's idempotency key makes retries safe.
+func processRefund(ctx context.Context, refund *models.Refund) (*models.Refund, error) {
+	payment, err := dbHelper.GetPaymentByID(database.Rest, refund.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := payments.Default.Refund(ctx, *payment.ProviderRef, refund.Amount, refund.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.RefundPending
+	switch result.Status {
+	case payments.StatusRefunded:
+		status = models.RefundSucceeded
+	case payments.StatusFailed:
+		status = models.RefundFailed
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		locked, err := dbHelper.GetRefundForUpdate(tx, refund.ID)
+		if err != nil {
+			return err
+		}
+		if status == models.RefundPending {
+			// asynchronous provider: remember the reference and wait for the webhook
+			locked.ProviderRef = &result.ProviderRef
+			refund = locked
+			return dbHelper.UpdateRefund(tx, *locked)
+		}
+		refund = locked
+		return completeRefund(tx, locked, status, result.ProviderRef)
+	})
+	return refund, txErr
+}
+
+// CreateRefund refunds a whole order or individual items. Only admins and the
+// restaurant's sub admin may refund. Retrying with the same Idempotency-Key
+// header returns the original refund, resubmitting it if it is still pending.
+func CreateRefund(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	if !isRestaurantStaff(r, order.RestaurantID) {
+		http.Error(w, "only admin or the restaurant's sub admin can issue refunds", http.StatusForbidden)
+		return
+	}
+
+	var req models.CreateRefundRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.Full == (len(req.Items) > 0) {
+		http.Error(w, "provide either full or items", http.StatusBadRequest)
+		return
+	}
+
+	// client keys are scoped to the order, so a key reused on another order,
+	// possibly at another restaurant, starts a new refund instead of
+	// revealing that it was used
+	userID, _ := utils.GetUserID(r)
+	key := uuid.NewString()
+	if clientKey := r.Header.Get("Idempotency-Key"); clientKey != "" {
+		key = "order:" + order.ID.String() + ":" + clientKey
+	}
+
+	refund, err := dbHelper.GetRefundByIdempotencyKey(database.Rest, key)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "failed to fetch refund", http.StatusInternalServerError)
+		return
+	}
+	if refund != nil && refund.OrderID != order.ID {
+		http.Error(w, "idempotency key already used for another order", http.StatusConflict)
+		return
+	}
+
+	if refund == nil {
+		refund = &models.Refund{
+			ID:             uuid.New(),
+			OrderID:        order.ID,
+			Reason:         req.Reason,
+			Status:         models.RefundPending,
+			IdempotencyKey: key,
+			CreatedBy:      userID,
+		}
+
+		txErr := database.Tx(func(tx *sqlx.Tx) error {
+			if _, err := dbHelper.GetOrderForUpdate(tx, order.ID); err != nil {
+				return err
+			}
+			payment, err := dbHelper.GetCapturedPaymentForUpdate(tx, order.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return errNotRefundable
+			}
+			if err != nil {
+				return err
+			}
+
+			orderItems, err := dbHelper.ListOrderItems(tx, order.ID)
+			if err != nil {
+				return err
+			}
+			pending, err := dbHelper.PendingRefundQuantities(tx, order.ID)
+			if err != nil {
+				return err
+			}
+			refundItems, err := buildRefundItems(req, orderItems, pending)
+			if err != nil {
+				return err
+			}
+
+			for _, item := range refundItems {
+				refund.Amount += item.Amount
+			}
+			refunded, err := dbHelper.SumRefunded(tx, payment.ID)
+			if err != nil {
+				return err
+			}
+			// a full refund also returns the delivery, packaging and service charges
+			if req.Full || refund.Amount > payment.Amount-refunded {
+				refund.Amount = payment.Amount - refunded
+			}
+			if refund.Amount <= 0 {
+				return errNothingToRefund
+			}
+
+			refund.PaymentID, refund.Currency = payment.ID, payment.Currency
+			if err := dbHelper.CreateRefund(tx, *refund); err != nil {
+				return err
+			}
+			for _, item := range refundItems {
+				item.RefundID = refund.ID
+				if err := dbHelper.CreateRefundItem(tx, item); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(txErr, errInvalidRefundItem):
+			http.Error(w, txErr.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(txErr, errNotRefundable), errors.Is(txErr, errNothingToRefund):
+			http.Error(w, txErr.Error(), http.StatusConflict)
+			return
+		case dbHelper.IsUniqueViolation(txErr):
+			http.Error(w, "a refund with this idempotency key is already in progress", http.StatusConflict)
+			return
+		case txErr != nil:
+			http.Error(w, "failed to create refund", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if refund.Status == models.RefundPending {
+		processed, err := processRefund(r.Context(), refund)
+		if err != nil {
+			logrus.Errorf("refund %s failed at provider: %v", refund.ID, err)
+			http.Error(w, "payment provider unavailable, retry with the same Idempotency-Key", http.StatusBadGateway)
+			return
+		}
+		refund = processed
+	}
+
+	refundItems, err := dbHelper.ListRefundItems(database.Rest, refund.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch refund items", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if refund.Status == models.RefundFailed {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	utils.JSON.NewEncoder(w).Encode(models.RefundWithItems{Refund: *refund, Items: refundItems})
+}
+
+func ListOrderRefunds(w http.ResponseWriter, r *http.Request) {
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	refunds, err := dbHelper.ListRefundsByOrder(database.Rest, order.ID)
+	if err != nil {
+		http.Error(w, "failed to list refunds", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"refunds": refunds,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
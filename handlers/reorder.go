@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+)
+
+// Reorder places one of the caller's past orders again at the menu's current
+// prices. Dishes that are off the menu are left out; the response lists them
+// with every dish whose price changed.
+func Reorder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	orderID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid order ID format", http.StatusBadRequest)
+		return
+	}
+	past, err := dbHelper.GetOrderByID(database.Rest, orderID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "failed to fetch order", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || !past.PlacedBy(userID) {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	}
+
+	// the body is optional, so an empty one reorders with the past defaults
+	var req models.ReorderRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserAddressID == "" {
+		if past.UserAddressID == nil {
+			http.Error(w, "user_address_id is required", http.StatusBadRequest)
+			return
+		}
+		req.UserAddressID = past.UserAddressID.String()
+	}
+
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, past.RestaurantID.String())
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "this restaurant no longer takes orders", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch restaurant", http.StatusInternalServerError)
+		return
+	}
+
+	pastItems, err := dbHelper.ListOrderItems(database.Rest, past.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch order items", http.StatusInternalServerError)
+		return
+	}
+	dishIDs := make([]uuid.UUID, 0, len(pastItems))
+	for _, item := range pastItems {
+		dishIDs = append(dishIDs, item.DishID)
+	}
+	dishes, err := dbHelper.GetDishesByIDs(database.Rest, restaurant.ID, dishIDs)
+	if err != nil {
+		http.Error(w, "failed to fetch dishes", http.StatusInternalServerError)
+		return
+	}
+	menu := make(map[uuid.UUID]models.Dish, len(dishes))
+	for _, dish := range dishes {
+		menu[dish.ID] = dish
+	}
+
+	changes := make([]models.ReorderChange, 0)
+	items := make([]models.OrderItemRequest, 0, len(pastItems))
+	for _, item := range pastItems {
+		change := models.ReorderChange{
+			DishID:   item.DishID,
+			Name:     item.Name,
+			Quantity: item.Quantity,
+			OldPrice: item.UnitPrice,
+		}
+		dish, onMenu := menu[item.DishID]
+		if !onMenu || dish.Price == nil {
+			change.Kind = models.ReorderUnavailable
+			changes = append(changes, change)
+			continue
+		}
+		if *dish.Price != item.UnitPrice {
+			change.Kind, change.NewPrice = models.ReorderPriceChanged, dish.Price
+			changes = append(changes, change)
+		}
+		items = append(items, models.OrderItemRequest{DishID: item.DishID.String(), Quantity: item.Quantity})
+	}
+	if len(items) == 0 {
+		http.Error(w, "none of the dishes in this order are available anymore", http.StatusUnprocessableEntity)
+		return
+	}
+
+	full, ok := placeOrder(w, userID, restaurant, models.CreateOrderRequest{
+		RestaurantID:  restaurant.ID.String(),
+		UserAddressID: req.UserAddressID,
+		Items:         items,
+		PromoCode:     req.PromoCode,
+		RedeemPoints:  req.RedeemPoints,
+		ScheduledFor:  req.ScheduledFor,
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(models.ReorderResult{OrderWithItems: full, Changes: changes})
+}
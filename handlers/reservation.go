@@ -0,0 +1,648 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/scheduling"
+	"new_restaurant/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bookingAttempts is how many times a booking looks for another table after
+// a concurrent booking took the one it picked
+const bookingAttempts = 3
+
+var (
+	errTableNotFound       = errors.New("table not found")
+	errTableInUse          = errors.New("table has upcoming reservations")
+	errNoTableFree         = errors.New("no table is free for this party at that time")
+	errReservationNotFound = errors.New("reservation not found")
+	errReservationStarted  = errors.New("reservation has already started")
+	errReservationNotDue   = errors.New("reservation has not started yet")
+	errTableOccupied       = errors.New("table is occupied")
+	errTableNotOccupied    = errors.New("table is not occupied")
+)
+
+func ListDiningTables(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	tables, err := dbHelper.ListDiningTables(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to list tables", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(tables); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func CreateDiningTable(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateTableRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Capacity < 1 {
+		http.Error(w, "name and a positive capacity are required", http.StatusBadRequest)
+		return
+	}
+
+	table := models.DiningTable{
+		ID:           uuid.New(),
+		RestaurantID: restaurant.ID,
+		Name:         req.Name,
+		Capacity:     req.Capacity,
+	}
+	err := dbHelper.CreateDiningTable(database.Rest, table)
+	if dbHelper.IsUniqueViolation(err) {
+		http.Error(w, "a table with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to create table", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(table)
+}
+
+// changeDiningTable locks the {tableId} table of the {id} restaurant and runs
+// fn on it, writing the error response on failure
+func changeDiningTable(w http.ResponseWriter, r *http.Request, fn func(tx *sqlx.Tx, table *models.DiningTable) error) (*models.DiningTable, bool) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+	tableID, err := uuid.Parse(mux.Vars(r)["tableId"])
+	if err != nil {
+		http.Error(w, "invalid table ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var table *models.DiningTable
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		table, err = dbHelper.GetDiningTableForUpdate(tx, restaurant.ID, tableID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errTableNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return fn(tx, table)
+	})
+	switch {
+	case errors.Is(txErr, errTableNotFound):
+		http.Error(w, "table not found", http.StatusNotFound)
+	case errors.Is(txErr, errTableInUse):
+		http.Error(w, "the table has upcoming reservations that would no longer fit", http.StatusConflict)
+	case errors.Is(txErr, errTableNotOccupied):
+		http.Error(w, "the table is not occupied", http.StatusConflict)
+	case errors.Is(txErr, errTableOccupied):
+		http.Error(w, "the table is still occupied, clear it first", http.StatusConflict)
+	case dbHelper.IsUniqueViolation(txErr):
+		http.Error(w, "a table with this name already exists", http.StatusConflict)
+	case txErr != nil:
+		http.Error(w, "failed to update table", http.StatusInternalServerError)
+	default:
+		return table, true
+	}
+	return nil, false
+}
+
+// UpdateDiningTable renames or resizes a table. A table cannot shrink below
+// a party that has already reserved it.
+func UpdateDiningTable(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateTableRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		req.Name = &name
+	}
+	if req.Name != nil && *req.Name == "" || req.Capacity != nil && *req.Capacity < 1 {
+		http.Error(w, "name must not be empty and capacity must be positive", http.StatusBadRequest)
+		return
+	}
+
+	table, ok := changeDiningTable(w, r, func(tx *sqlx.Tx, table *models.DiningTable) error {
+		if req.Name != nil {
+			table.Name = *req.Name
+		}
+		if req.Capacity != nil {
+			largest, err := dbHelper.LargestUpcomingParty(tx, table.ID)
+			if err != nil {
+				return err
+			}
+			if largest > *req.Capacity {
+				return errTableInUse
+			}
+			table.Capacity = *req.Capacity
+		}
+		return dbHelper.UpdateDiningTable(tx, *table)
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(table)
+}
+
+// DeleteDiningTable removes a table that is empty and has no upcoming reservations
+func DeleteDiningTable(w http.ResponseWriter, r *http.Request) {
+	_, ok := changeDiningTable(w, r, func(tx *sqlx.Tx, table *models.DiningTable) error {
+		largest, err := dbHelper.LargestUpcomingParty(tx, table.ID)
+		if err != nil {
+			return err
+		}
+		if largest > 0 {
+			return errTableInUse
+		}
+		if _, err := dbHelper.GetOpenTableSessionForUpdate(tx, table.ID); err == nil {
+			return errTableOccupied
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return dbHelper.ArchiveDiningTable(tx, table.ID)
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "table deleted successfully"})
+}
+
+// seatParty records a party sitting down, failing with errTableOccupied if
+// the previous party's table was not cleared
+func seatParty(tx *sqlx.Tx, session models.TableSession) error {
+	err := dbHelper.CreateTableSession(tx, session)
+	if dbHelper.IsUniqueViolation(err) {
+		return errTableOccupied
+	}
+	return err
+}
+
+// ClearDiningTable records that the party at the table has left. A seated
+// reservation at the table is completed with it.
+func ClearDiningTable(w http.ResponseWriter, r *http.Request) {
+	table, ok := changeDiningTable(w, r, func(tx *sqlx.Tx, table *models.DiningTable) error {
+		session, err := dbHelper.GetOpenTableSessionForUpdate(tx, table.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errTableNotOccupied
+		}
+		if err != nil {
+			return err
+		}
+		if err := dbHelper.ClearTableSession(tx, session.ID); err != nil {
+			return err
+		}
+		if session.ReservationID == nil {
+			return nil
+		}
+		reservation, err := dbHelper.GetReservationForUpdate(tx, *session.ReservationID)
+		if err != nil {
+			return err
+		}
+		if !reservation.Status.CanTransitionTo(models.ReservationCompleted) {
+			return nil
+		}
+		return dbHelper.UpdateReservationStatus(tx, reservation.ID, models.ReservationCompleted)
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(table)
+}
+
+// SearchTableAvailability returns the slots on ?date=YYYY-MM-DD with a table
+// free for ?party_size. With ?time=HH:MM only slots within an hour of it are
+// returned, so a customer whose time is taken sees the nearest alternatives.
+func SearchTableAvailability(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid restaurant ID format", http.StatusBadRequest)
+		return
+	}
+	if _, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String()); err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+
+	partySize, err := strconv.Atoi(r.URL.Query().Get("party_size"))
+	if err != nil || partySize < 1 {
+		http.Error(w, "party_size must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := dbHelper.GetRestaurantSchedule(database.Rest, restaurantID)
+	if err != nil {
+		http.Error(w, "failed to fetch restaurant schedule", http.StatusInternalServerError)
+		return
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		http.Error(w, "restaurant timezone is misconfigured", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	date, err := dateParam(r, loc, now)
+	if err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	var around *time.Time
+	if value := r.URL.Query().Get("time"); value != "" {
+		clock, err := time.Parse("15:04", value)
+		if err != nil {
+			http.Error(w, "time must be HH:MM", http.StatusBadRequest)
+			return
+		}
+		at := time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		around = &at
+	}
+
+	tables, err := dbHelper.ListDiningTables(database.Rest, restaurantID)
+	if err != nil {
+		http.Error(w, "failed to list tables", http.StatusInternalServerError)
+		return
+	}
+	fitting := make([]models.DiningTable, 0, len(tables))
+	for _, table := range tables {
+		if table.Capacity >= partySize {
+			fitting = append(fitting, table)
+		}
+	}
+
+	starts, err := scheduling.TableSlots(*schedule, date.Year(), date.Month(), date.Day(), now)
+	if err != nil {
+		http.Error(w, "failed to list slots", http.StatusInternalServerError)
+		return
+	}
+
+	length := time.Duration(schedule.ReservationMinutes) * time.Minute
+	availability := make([]models.TableAvailability, 0, len(starts))
+	if len(fitting) > 0 && len(starts) > 0 {
+		reservations, err := dbHelper.ListRestaurantReservations(database.Rest, restaurantID, starts[0], starts[len(starts)-1].Add(length))
+		if err != nil {
+			http.Error(w, "failed to fetch reservations", http.StatusInternalServerError)
+			return
+		}
+		for _, start := range starts {
+			if around != nil && (start.Before(around.Add(-time.Hour)) || start.After(around.Add(time.Hour))) {
+				continue
+			}
+			end := start.Add(length)
+			free := 0
+			for _, table := range fitting {
+				taken := false
+				for _, reservation := range reservations {
+					if reservation.TableID == table.ID && holdsTable(reservation.Status) &&
+						reservation.StartsAt.Before(end) && reservation.EndsAt.After(start) {
+						taken = true
+						break
+					}
+				}
+				if !taken {
+					free++
+				}
+			}
+			if free > 0 {
+				availability = append(availability, models.TableAvailability{StartsAt: start, EndsAt: end, FreeTables: free})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"timezone": schedule.Timezone,
+		"slots":    availability,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// holdsTable reports whether a reservation in the status keeps its table
+func holdsTable(status models.ReservationStatus) bool {
+	return status == models.ReservationBooked || status == models.ReservationSeated
+}
+
+// CreateReservation books the smallest free table that seats the party.
+// Overlapping bookings of a table are rejected by the database, so two
+// customers racing for the last table cannot both get it.
+func CreateReservation(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid restaurant ID format", http.StatusBadRequest)
+		return
+	}
+	if _, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String()); err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+
+	var req models.CreateReservationRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.PartySize < 1 || req.StartsAt.IsZero() {
+		http.Error(w, "party_size and starts_at are required", http.StatusBadRequest)
+		return
+	}
+	if req.Notes != nil {
+		if notes := strings.TrimSpace(*req.Notes); notes != "" {
+			req.Notes = &notes
+		} else {
+			req.Notes = nil
+		}
+	}
+
+	schedule, err := dbHelper.GetRestaurantSchedule(database.Rest, restaurantID)
+	if err != nil {
+		http.Error(w, "failed to fetch restaurant schedule", http.StatusInternalServerError)
+		return
+	}
+	if err := scheduling.CheckTableSlot(*schedule, req.StartsAt, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	userID, _ := utils.GetUserID(r)
+	startsAt := req.StartsAt.UTC()
+	reservation := models.Reservation{
+		ID:           uuid.New(),
+		RestaurantID: restaurantID,
+		UserID:       userID,
+		PartySize:    req.PartySize,
+		StartsAt:     startsAt,
+		EndsAt:       startsAt.Add(time.Duration(schedule.ReservationMinutes) * time.Minute),
+		Status:       models.ReservationBooked,
+		Notes:        req.Notes,
+	}
+
+	var txErr error
+	for attempt := 1; attempt <= bookingAttempts; attempt++ {
+		txErr = database.Tx(func(tx *sqlx.Tx) error {
+			table, err := dbHelper.FindFreeTable(tx, restaurantID, reservation.PartySize, reservation.StartsAt, reservation.EndsAt)
+			if errors.Is(err, sql.ErrNoRows) {
+				return errNoTableFree
+			}
+			if err != nil {
+				return err
+			}
+			reservation.TableID, reservation.TableName = table.ID, table.Name
+			return dbHelper.CreateReservation(tx, reservation)
+		})
+		// another booking took the table between the search and the insert
+		if !dbHelper.IsExclusionViolation(txErr) {
+			break
+		}
+	}
+	if errors.Is(txErr, errNoTableFree) || dbHelper.IsExclusionViolation(txErr) {
+		http.Error(w, fmt.Sprintf("no table for %d is free at that time, please pick another", req.PartySize), http.StatusConflict)
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to create reservation", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := dbHelper.GetReservation(database.Rest, reservation.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch reservation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(created)
+}
+
+func ListMyReservations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	reservations, err := dbHelper.ListUserReservations(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to list reservations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"reservations": reservations,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// ListRestaurantReservations returns the restaurant's reservations on
+// ?date=YYYY-MM-DD, today in its timezone by default
+func ListRestaurantReservations(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := dbHelper.GetRestaurantSchedule(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch restaurant schedule", http.StatusInternalServerError)
+		return
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		http.Error(w, "restaurant timezone is misconfigured", http.StatusInternalServerError)
+		return
+	}
+	date, err := dateParam(r, loc, time.Now())
+	if err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	reservations, err := dbHelper.ListRestaurantReservations(database.Rest, restaurant.ID, date, date.AddDate(0, 0, 1))
+	if err != nil {
+		http.Error(w, "failed to list reservations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"reservations": reservations,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// transitionReservation locks the {id} reservation, lets check decide whether
+// the caller may move it now, moves it to next and runs then if given,
+// writing the error response on failure
+func transitionReservation(w http.ResponseWriter, r *http.Request, next models.ReservationStatus,
+	check func(reservation *models.Reservation) error,
+	then func(tx *sqlx.Tx, reservation *models.Reservation) error) (*models.Reservation, bool) {
+	reservationID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid reservation ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var reservation *models.Reservation
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		reservation, err = dbHelper.GetReservationForUpdate(tx, reservationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := check(reservation); err != nil {
+			return err
+		}
+		if !reservation.Status.CanTransitionTo(next) {
+			return models.ErrInvalidReservationTransition
+		}
+		reservation.Status = next
+		if err := dbHelper.UpdateReservationStatus(tx, reservation.ID, next); err != nil {
+			return err
+		}
+		if then == nil {
+			return nil
+		}
+		return then(tx, reservation)
+	})
+	switch {
+	case errors.Is(txErr, errReservationNotFound):
+		http.Error(w, "reservation not found", http.StatusNotFound)
+	case errors.Is(txErr, models.ErrInvalidReservationTransition):
+		http.Error(w, fmt.Sprintf("a %s reservation cannot be marked %s", reservation.Status, next), http.StatusConflict)
+	case errors.Is(txErr, errReservationStarted), errors.Is(txErr, errReservationNotDue):
+		http.Error(w, txErr.Error(), http.StatusConflict)
+	case errors.Is(txErr, errTableOccupied):
+		http.Error(w, "the table is still occupied, clear it first", http.StatusConflict)
+	case txErr != nil:
+		http.Error(w, "failed to update reservation", http.StatusInternalServerError)
+	default:
+		return reservation, true
+	}
+	return nil, false
+}
+
+// staffOnly lets only the reservation's restaurant staff change it; anyone
+// else is told it does not exist
+func staffOnly(r *http.Request) func(reservation *models.Reservation) error {
+	return func(reservation *models.Reservation) error {
+		if !isRestaurantStaff(r, reservation.RestaurantID) {
+			return errReservationNotFound
+		}
+		return nil
+	}
+}
+
+// CancelReservation frees the table. Customers can cancel until the
+// reservation starts; the restaurant's staff can cancel any booking.
+func CancelReservation(w http.ResponseWriter, r *http.Request) {
+	userID, _ := utils.GetUserID(r)
+	reservation, ok := transitionReservation(w, r, models.ReservationCancelled, func(reservation *models.Reservation) error {
+		if isRestaurantStaff(r, reservation.RestaurantID) {
+			return nil
+		}
+		if reservation.UserID != userID {
+			return errReservationNotFound
+		}
+		if reservation.Status == models.ReservationBooked && !time.Now().Before(reservation.StartsAt) {
+			return errReservationStarted
+		}
+		return nil
+	}, nil)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(reservation)
+}
+
+// SeatReservation records that the party has arrived and now occupies its table
+func SeatReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := transitionReservation(w, r, models.ReservationSeated, staffOnly(r),
+		func(tx *sqlx.Tx, reservation *models.Reservation) error {
+			return seatParty(tx, models.TableSession{
+				ID:            uuid.New(),
+				RestaurantID:  reservation.RestaurantID,
+				TableID:       reservation.TableID,
+				PartySize:     reservation.PartySize,
+				ReservationID: &reservation.ID,
+			})
+		})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(reservation)
+}
+
+// CompleteReservation records that the party has left, freeing the table
+func CompleteReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := transitionReservation(w, r, models.ReservationCompleted, staffOnly(r),
+		func(tx *sqlx.Tx, reservation *models.Reservation) error {
+			return dbHelper.ClearReservationSession(tx, reservation.ID)
+		})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(reservation)
+}
+
+// MarkReservationNoShow records that the party never came, freeing the rest
+// of its time on the table. It is only allowed once the reservation started.
+func MarkReservationNoShow(w http.ResponseWriter, r *http.Request) {
+	staff := staffOnly(r)
+	reservation, ok := transitionReservation(w, r, models.ReservationNoShow, func(reservation *models.Reservation) error {
+		if err := staff(reservation); err != nil {
+			return err
+		}
+		if time.Now().Before(reservation.StartsAt) {
+			return errReservationNotDue
+		}
+		return nil
+	}, nil)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(reservation)
+}
@@ -2,12 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"math"
 	"net/http"
 	"new_restaurant/database"
 	"new_restaurant/database/dbHelper"
+	"new_restaurant/geocoder"
 	"new_restaurant/models"
+	"new_restaurant/money"
+	"new_restaurant/routing"
 	"new_restaurant/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func CreateRestaurant(w http.ResponseWriter, r *http.Request) {
@@ -29,14 +39,36 @@ func CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	deliveryFee := money.Zero(currency)
+	if req.DeliveryFee != nil {
+		deliveryFee = *req.DeliveryFee
+	}
+	if !utils.ValidCoordinates(req.Latitude, req.Longitude) || !money.ValidCurrency(currency) ||
+		deliveryFee.InCurrency(currency) != nil || deliveryFee.IsNegative() {
+		http.Error(w, "invalid coordinates, currency or delivery fee", http.StatusBadRequest)
+		return
+	}
+
+	req.Latitude, req.Longitude, ok = resolveCoordinates(w, r, req.Address, req.Latitude, req.Longitude)
+	if !ok {
+		return
+	}
+
 	restaurant := models.Restaurant{
-		ID:        uuid.New(),
-		Name:      req.Name,
-		Address:   req.Address,
-		Latitude:  req.Latitude,
-		Longitude: req.Longitude,
-		Rating:    req.Rating,
-		CreatedBy: userID,
+		ID:          uuid.New(),
+		Name:        req.Name,
+		Address:     req.Address,
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+		Geohash:     restaurantGeohash(req.Latitude, req.Longitude),
+		Rating:      req.Rating,
+		Currency:    currency,
+		DeliveryFee: deliveryFee,
+		CreatedBy:   userID,
 	}
 
 	if err := dbHelper.CreateRestaurant(database.Rest, restaurant); err != nil {
@@ -48,6 +80,215 @@ func CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "restaurant created successfully"})
 }
 
+// restaurantGeohash returns the geohash cell stored for a restaurant, or nil without coordinates
+func restaurantGeohash(lat, lon *float64) *string {
+	if lat == nil || lon == nil {
+		return nil
+	}
+	hash := utils.EncodeGeohash(*lat, *lon, utils.GeohashPrecision)
+	return &hash
+}
+
+func UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") && !utils.HasRole(r, "sub_admin") {
+		http.Error(w, "only admin and sub_admin can update restaurants", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(restaurantID); err != nil {
+		http.Error(w, "invalid restaurant ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateRestaurantRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID)
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+
+	// sub admins may only edit the restaurants they created
+	if !utils.HasRole(r, "admin") && restaurant.CreatedBy != userID {
+		http.Error(w, "you can only update your own restaurants", http.StatusForbidden)
+		return
+	}
+
+	if req.Name != nil {
+		restaurant.Name = *req.Name
+	}
+	if req.Rating != nil {
+		restaurant.Rating = *req.Rating
+	}
+	if req.DeliveryFee != nil {
+		restaurant.DeliveryFee = *req.DeliveryFee
+		if err := restaurant.DeliveryFee.InCurrency(restaurant.Currency); err != nil {
+			http.Error(w, "delivery fee must be in "+restaurant.Currency, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Address != nil {
+		restaurant.Address = *req.Address
+	}
+	if req.Latitude != nil || req.Longitude != nil {
+		restaurant.Latitude, restaurant.Longitude = req.Latitude, req.Longitude
+	} else if req.Address != nil && geocoder.Default != nil {
+		// the stored coordinates belong to the old address text
+		restaurant.Latitude, restaurant.Longitude, ok = resolveCoordinates(w, r, restaurant.Address, nil, nil)
+		if !ok {
+			return
+		}
+	} else if req.Address != nil {
+		// nothing can locate the new text, so the restaurant drops out of
+		// nearby search until the coordinates are sent
+		restaurant.Latitude, restaurant.Longitude = nil, nil
+	}
+
+	if restaurant.Name == "" || restaurant.Address == "" || restaurant.Rating < 0 || restaurant.Rating > 5 ||
+		restaurant.DeliveryFee.IsNegative() || !utils.ValidCoordinates(restaurant.Latitude, restaurant.Longitude) {
+		http.Error(w, "invalid name, address, rating, delivery fee or coordinates", http.StatusBadRequest)
+		return
+	}
+	restaurant.Geohash = restaurantGeohash(restaurant.Latitude, restaurant.Longitude)
+
+	if err := dbHelper.UpdateRestaurant(database.Rest, *restaurant); err != nil {
+		http.Error(w, "error updating restaurant", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "restaurant updated successfully"})
+}
+
+// ListNearbyRestaurants finds restaurants within radius km of a point. Only the
+// geohash cells around the point are read, then exact distances are checked.
+func ListNearbyRestaurants(w http.ResponseWriter, r *http.Request) {
+	const (
+		defaultRadiusKm = 5.0
+		maxRadiusKm     = 50.0
+		defaultLimit    = 20
+		maxLimit        = 100
+	)
+
+	req, ok := parseRestaurantSearch(w, r)
+	if !ok {
+		return
+	}
+
+	radius := defaultRadiusKm
+	if req.Radius != nil {
+		radius = *req.Radius
+	}
+	if radius <= 0 || radius > maxRadiusKm {
+		http.Error(w, "radius must be between 0 and 50 km", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := defaultLimit, 0
+	if req.Limit != nil && *req.Limit > 0 && *req.Limit <= maxLimit {
+		limit = *req.Limit
+	}
+	if req.Offset != nil && *req.Offset > 0 {
+		offset = *req.Offset
+	}
+
+	lat, lon := *req.Latitude, *req.Longitude
+	cells := utils.GeohashNeighborhood(lat, lon, utils.GeohashPrecisionForRadius(lat, radius))
+
+	candidates, err := dbHelper.ListRestaurantsInGeohashCells(database.Rest, cells)
+	if err != nil {
+		http.Error(w, "failed to list restaurants", http.StatusInternalServerError)
+		return
+	}
+
+	nearby := make([]models.NearbyRestaurant, 0)
+	for _, restaurant := range candidates {
+		if (req.MinRating != nil && restaurant.Rating < *req.MinRating) ||
+			(req.MaxRating != nil && restaurant.Rating > *req.MaxRating) {
+			continue
+		}
+		distance := utils.CalculateDistance(lat, lon, *restaurant.Latitude, *restaurant.Longitude)
+		if distance <= radius {
+			nearby = append(nearby, models.NearbyRestaurant{Restaurant: restaurant, DistanceKm: distance})
+		}
+	}
+	sort.Slice(nearby, func(i, j int) bool { return nearby[i].DistanceKm < nearby[j].DistanceKm })
+
+	total := len(nearby)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"restaurants": nearby[offset:end],
+		"total":       total,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// parseRestaurantSearch reads a RestaurantSearchRequest from the query string;
+// latitude and longitude are required
+func parseRestaurantSearch(w http.ResponseWriter, r *http.Request) (*models.RestaurantSearchRequest, bool) {
+	query := r.URL.Query()
+	req := &models.RestaurantSearchRequest{}
+
+	floats := map[string]**float64{
+		"latitude":   &req.Latitude,
+		"longitude":  &req.Longitude,
+		"radius":     &req.Radius,
+		"min_rating": &req.MinRating,
+		"max_rating": &req.MaxRating,
+	}
+	for name, field := range floats {
+		if raw := query.Get(name); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return nil, false
+			}
+			*field = &value
+		}
+	}
+
+	ints := map[string]**int{
+		"limit":  &req.Limit,
+		"offset": &req.Offset,
+	}
+	for name, field := range ints {
+		if raw := query.Get(name); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return nil, false
+			}
+			*field = &value
+		}
+	}
+
+	if req.Latitude == nil || req.Longitude == nil || !utils.ValidCoordinates(req.Latitude, req.Longitude) {
+		http.Error(w, "valid latitude and longitude are required", http.StatusBadRequest)
+		return nil, false
+	}
+	return req, true
+}
+
 func ListAllRestaurantBySubAdmin(w http.ResponseWriter, r *http.Request) {
 	if !utils.HasRole(r, "admin") && !utils.HasRole(r, "sub_admin") {
 		http.Error(w, "only admin or sub admins can access", http.StatusForbidden)
@@ -133,6 +374,22 @@ func CreateDish(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, restaurantUUID.String())
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+	if req.Price != nil {
+		if err := req.Price.InCurrency(restaurant.Currency); err != nil {
+			http.Error(w, "price must be in "+restaurant.Currency, http.StatusBadRequest)
+			return
+		}
+		if req.Price.IsNegative() {
+			http.Error(w, "price must not be negative", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Build dish object
 	dish := models.Dish{
 		ID:           uuid.New(),
@@ -140,6 +397,7 @@ func CreateDish(w http.ResponseWriter, r *http.Request) {
 		Name:         req.Name,
 		Description:  req.Description,
 		Price:        req.Price,
+		Category:     req.Category,
 		CreatedBy:    userID,
 	}
 
@@ -189,8 +447,14 @@ func CalculateDistance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user address
-	userAddress, err := dbHelper.GetUserAddress(database.Rest, req.UserAddressID)
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Get user address, only if it belongs to the caller
+	userAddress, err := dbHelper.GetUserAddress(database.Rest, req.UserAddressID, userID)
 	if err != nil {
 		http.Error(w, "User address not found", http.StatusNotFound)
 		return
@@ -210,16 +474,31 @@ func CalculateDistance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Calculate distance (in KM)
-	distance := utils.CalculateDistance(
-		*userAddress.Latitude, *userAddress.Longitude,
-		*restaurant.Latitude, *restaurant.Longitude,
-	)
+	from := routing.Point{Latitude: *restaurant.Latitude, Longitude: *restaurant.Longitude}
+	to := routing.Point{Latitude: *userAddress.Latitude, Longitude: *userAddress.Longitude}
+
+	// Road distance and travel time from the restaurant to the address
+	route, err := routing.Default.Route(r.Context(), from, to)
+	if errors.Is(err, routing.ErrNoRoute) {
+		http.Error(w, "No route between restaurant and address", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to calculate route", http.StatusBadGateway)
+		return
+	}
 
 	// Send response
 	response := models.DistanceResponse{
-		Distance: distance,
-		Message:  "Distance calculated successfully",
+		Distance: route.DistanceKm,
+		StraightLineDistance: utils.CalculateDistance(
+			*userAddress.Latitude, *userAddress.Longitude,
+			*restaurant.Latitude, *restaurant.Longitude,
+		),
+		DurationMinutes: math.Round(route.Duration.Minutes()*10) / 10,
+		ETA:             time.Now().Add(route.Duration).UTC(),
+		Estimated:       route.Estimated,
+		Message:         "Distance calculated successfully",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -227,3 +506,100 @@ func CalculateDistance(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+// CalculateDistanceMatrix returns straight-line distances from one of the
+// caller's addresses to many restaurants at once, sorted nearest first. Use
+// CalculateDistance for the road distance to one restaurant.
+func CalculateDistanceMatrix(w http.ResponseWriter, r *http.Request) {
+	const (
+		maxRestaurants  = 100
+		defaultRadiusKm = 5.0
+		maxRadiusKm     = 50.0
+	)
+
+	var req models.DistanceMatrixRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Nearby == (len(req.RestaurantIDs) > 0) {
+		http.Error(w, "provide either restaurant_ids or nearby", http.StatusBadRequest)
+		return
+	}
+	if len(req.RestaurantIDs) > maxRestaurants {
+		http.Error(w, "at most 100 restaurant_ids are allowed", http.StatusBadRequest)
+		return
+	}
+	for _, id := range req.RestaurantIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			http.Error(w, "invalid restaurant ID format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID, ok := utils.GetUserID(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := uuid.Parse(req.UserAddressID); err != nil {
+		http.Error(w, "invalid user_address_id", http.StatusBadRequest)
+		return
+	}
+	userAddress, err := dbHelper.GetUserAddress(database.Rest, req.UserAddressID, userID)
+	if err != nil {
+		http.Error(w, "user address not found", http.StatusNotFound)
+		return
+	}
+	if userAddress.Latitude == nil || userAddress.Longitude == nil {
+		http.Error(w, "missing coordinates for user address", http.StatusBadRequest)
+		return
+	}
+
+	var distances []models.RestaurantDistance
+	if req.Nearby {
+		radius := defaultRadiusKm
+		if req.RadiusKm != nil {
+			radius = *req.RadiusKm
+		}
+		if radius <= 0 || radius > maxRadiusKm {
+			http.Error(w, "radius_km must be between 0 and 50", http.StatusBadRequest)
+			return
+		}
+
+		lat, lon := *userAddress.Latitude, *userAddress.Longitude
+		cells := utils.GeohashNeighborhood(lat, lon, utils.GeohashPrecisionForRadius(lat, radius))
+		distances, err = dbHelper.ListDistancesInGeohashCells(database.Rest, userID, req.UserAddressID, cells, radius)
+		if len(distances) > maxRestaurants {
+			distances = distances[:maxRestaurants]
+		}
+	} else {
+		distances, err = dbHelper.ListDistancesToRestaurants(database.Rest, userID, req.UserAddressID, req.RestaurantIDs)
+	}
+	if err != nil {
+		http.Error(w, "failed to calculate distances", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.DistanceMatrixResponse{
+		UserAddressID: req.UserAddressID,
+		Distances:     distances,
+	}
+
+	found := make(map[string]bool, len(distances))
+	for _, distance := range distances {
+		found[distance.RestaurantID.String()] = true
+	}
+	for _, id := range req.RestaurantIDs {
+		if parsed, _ := uuid.Parse(id); !found[parsed.String()] {
+			response.Unresolved = append(response.Unresolved, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/scheduling"
+	"new_restaurant/utils"
+	"strings"
+	"time"
+)
+
+// dateParam parses ?date=YYYY-MM-DD as midnight in loc, defaulting to the
+// current date there
+func dateParam(r *http.Request, loc *time.Location, now time.Time) (time.Time, error) {
+	value := r.URL.Query().Get("date")
+	if value == "" {
+		local := now.In(loc)
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc), nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+func GetRestaurantSchedule(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := dbHelper.GetRestaurantSchedule(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch restaurant schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(schedule); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// UpdateRestaurantSchedule replaces a restaurant's pre-order settings and
+// opening hours. Orders already scheduled keep their slots.
+func UpdateRestaurantSchedule(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateScheduleRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.SlotMinutes < 5 || req.SlotMinutes > 240 || req.PrepLeadMinutes < 0 ||
+		req.MaxDaysAhead < 1 || req.MaxDaysAhead > 60 || (req.SlotCapacity != nil && *req.SlotCapacity < 1) {
+		http.Error(w, "slot_minutes must be 5-240, max_days_ahead 1-60, prep_lead_minutes and slot_capacity positive", http.StatusBadRequest)
+		return
+	}
+	if req.ReservationMinutes == 0 {
+		req.ReservationMinutes = 90
+	}
+	if req.ReservationMinutes < 15 || req.ReservationMinutes > 480 {
+		http.Error(w, "reservation_minutes must be 15-480", http.StatusBadRequest)
+		return
+	}
+
+	schedule := models.RestaurantSchedule{
+		ScheduleSettings: models.ScheduleSettings{
+			RestaurantID:       restaurant.ID,
+			Timezone:           strings.TrimSpace(req.Timezone),
+			SlotMinutes:        req.SlotMinutes,
+			SlotCapacity:       req.SlotCapacity,
+			PrepLeadMinutes:    req.PrepLeadMinutes,
+			MaxDaysAhead:       req.MaxDaysAhead,
+			ReservationMinutes: req.ReservationMinutes,
+		},
+		Hours: make([]models.OpeningHours, 0, len(req.Hours)),
+	}
+	for _, hours := range req.Hours {
+		schedule.Hours = append(schedule.Hours, models.OpeningHours{
+			ID:           uuid.New(),
+			RestaurantID: restaurant.ID,
+			Weekday:      hours.Weekday,
+			OpensAt:      strings.TrimSpace(hours.OpensAt),
+			ClosesAt:     strings.TrimSpace(hours.ClosesAt),
+		})
+	}
+	if err := scheduling.ValidateSchedule(schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbHelper.ReplaceRestaurantSchedule(tx, schedule)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to update restaurant schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "restaurant schedule updated successfully"})
+}
+
+// ListRestaurantSlots returns the slots a customer can still order for on
+// ?date=YYYY-MM-DD, today in the restaurant's timezone by default
+func ListRestaurantSlots(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid restaurant ID format", http.StatusBadRequest)
+		return
+	}
+	if _, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String()); err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+
+	schedule, err := dbHelper.GetRestaurantSchedule(database.Rest, restaurantID)
+	if err != nil {
+		http.Error(w, "failed to fetch restaurant schedule", http.StatusInternalServerError)
+		return
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		http.Error(w, "restaurant timezone is misconfigured", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	date, err := dateParam(r, loc, now)
+	if err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	starts, err := scheduling.DaySlots(*schedule, date.Year(), date.Month(), date.Day(), now)
+	if err != nil {
+		http.Error(w, "failed to list slots", http.StatusInternalServerError)
+		return
+	}
+
+	length := time.Duration(schedule.SlotMinutes) * time.Minute
+	slots := make([]models.Slot, 0, len(starts))
+	var counts map[time.Time]int
+	if schedule.SlotCapacity != nil && len(starts) > 0 {
+		counts, err = dbHelper.CountSlotOrders(database.Rest, restaurantID, starts[0], starts[len(starts)-1].Add(length))
+		if err != nil {
+			http.Error(w, "failed to count slot orders", http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, start := range starts {
+		slot := models.Slot{StartsAt: start, EndsAt: start.Add(length)}
+		if schedule.SlotCapacity != nil {
+			remaining := *schedule.SlotCapacity - counts[start.UTC()]
+			if remaining <= 0 {
+				continue
+			}
+			slot.Remaining = &remaining
+		}
+		slots = append(slots, slot)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"timezone": schedule.Timezone,
+		"slots":    slots,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
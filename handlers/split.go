@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/dinein"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"new_restaurant/payments"
+	"new_restaurant/utils"
+)
+
+// cashProvider records payments taken by staff at the table
+const cashProvider = "cash"
+
+var (
+	errNothingToSplit   = errors.New("nothing left to split")
+	errSplitTooLarge    = errors.New("shares exceed the outstanding balance")
+	errEmptyShare       = errors.New("share comes to nothing")
+	errItemNotOnTab     = errors.New("item is not on the tab")
+	errItemAlreadySplit = errors.New("item is already covered by another share")
+	errShareUnavailable = errors.New("bill share is paid or voided")
+)
+
+// validateSplit checks the parts of a split request that do not depend on
+// the tab, writing the error response if it is invalid
+func validateSplit(w http.ResponseWriter, req *models.SplitTabRequest, currency string) bool {
+	switch req.Method {
+	case models.SplitEqually:
+		if req.Parts < 1 || req.Parts > dinein.MaxParts {
+			http.Error(w, fmt.Sprintf("parts must be between 1 and %d", dinein.MaxParts), http.StatusBadRequest)
+			return false
+		}
+	case models.SplitCustom:
+		if len(req.Amounts) == 0 {
+			http.Error(w, "amounts are required", http.StatusBadRequest)
+			return false
+		}
+		for i := range req.Amounts {
+			if err := req.Amounts[i].InCurrency(currency); err != nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return false
+			}
+			if !req.Amounts[i].IsPositive() {
+				http.Error(w, "amounts must be positive", http.StatusBadRequest)
+				return false
+			}
+		}
+	case models.SplitByItem:
+		if len(req.Shares) == 0 {
+			http.Error(w, "shares are required", http.StatusBadRequest)
+			return false
+		}
+		for _, share := range req.Shares {
+			if len(share.Items) == 0 {
+				http.Error(w, "every share needs items", http.StatusBadRequest)
+				return false
+			}
+			for _, item := range share.Items {
+				if _, err := uuid.Parse(item.OrderItemID); err != nil || item.Quantity < 1 {
+					http.Error(w, "invalid order_item_id or quantity", http.StatusBadRequest)
+					return false
+				}
+			}
+		}
+	default:
+		http.Error(w, "method must be items, equal or custom", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// splitItems prices the item shares requested against the tab's orders.
+// Refunded units are off the bill and units already covered by the tab's
+// remaining shares cannot be split again.
+func splitItems(tx *sqlx.Tx, orders []models.Order, existing []models.BillShare, requested []models.ItemShareRequest) ([][]models.BillShareItem, error) {
+	type line struct {
+		cost  money.Money
+		units int
+	}
+	lines := map[uuid.UUID]line{}
+	for _, order := range orders {
+		if !dinein.Billable(order) {
+			continue
+		}
+		items, err := dbHelper.ListOrderItems(tx, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		costs := dinein.ItemCosts(order, items)
+		for _, item := range items {
+			lines[item.ID] = line{cost: costs[item.ID], units: item.Quantity - item.RefundedQuantity}
+		}
+	}
+
+	covered := map[uuid.UUID]int{}
+	for _, share := range existing {
+		for _, item := range share.Items {
+			covered[item.OrderItemID] += item.Quantity
+		}
+	}
+
+	shares := make([][]models.BillShareItem, 0, len(requested))
+	for _, share := range requested {
+		items := make([]models.BillShareItem, 0, len(share.Items))
+		for _, requestedItem := range share.Items {
+			itemID := uuid.MustParse(requestedItem.OrderItemID)
+			line, ok := lines[itemID]
+			if !ok {
+				return nil, errItemNotOnTab
+			}
+			from := covered[itemID]
+			if from+requestedItem.Quantity > line.units {
+				return nil, errItemAlreadySplit
+			}
+			items = append(items, models.BillShareItem{
+				OrderItemID: itemID,
+				Quantity:    requestedItem.Quantity,
+				Amount:      money.UnitsCost(line.cost, line.units, from, requestedItem.Quantity),
+			})
+			covered[itemID] += requestedItem.Quantity
+		}
+		shares = append(shares, items)
+	}
+	return shares, nil
+}
+
+// splitTab voids the tab's unpaid shares and splits what is left of its bill
+// as requested. Shares already paid or being paid are kept.
+func splitTab(tx *sqlx.Tx, tabID uuid.UUID, currency string, req models.SplitTabRequest) error {
+	tab, err := dbHelper.GetTabForUpdate(tx, tabID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errTabNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if tab.Status != models.TabOpen {
+		return errTabClosed
+	}
+
+	if err := dbHelper.VoidUnpaidBillShares(tx, tab.ID); err != nil {
+		return err
+	}
+	existing, err := dbHelper.ListBillShares(tx, tab.ID)
+	if err != nil {
+		return err
+	}
+	orders, err := dbHelper.ListTabOrders(tx, tab.ID)
+	if err != nil {
+		return err
+	}
+
+	total, _ := dinein.Totals(orders, nil, currency)
+	left := total
+	for _, share := range existing {
+		left = left.Sub(share.Amount)
+	}
+	if !left.IsPositive() {
+		return errNothingToSplit
+	}
+
+	shares := make([]models.BillShare, 0)
+	switch req.Method {
+	case models.SplitEqually:
+		for _, amount := range money.Equal(left, req.Parts) {
+			shares = append(shares, models.BillShare{Amount: amount})
+		}
+	case models.SplitCustom:
+		for _, amount := range req.Amounts {
+			shares = append(shares, models.BillShare{Amount: amount})
+		}
+	case models.SplitByItem:
+		items, err := splitItems(tx, orders, existing, req.Shares)
+		if err != nil {
+			return err
+		}
+		for _, shareItems := range items {
+			share := models.BillShare{Amount: money.Zero(currency), Items: shareItems}
+			for _, item := range shareItems {
+				share.Amount = share.Amount.Add(item.Amount)
+			}
+			shares = append(shares, share)
+		}
+	}
+
+	split := money.Zero(currency)
+	for _, share := range shares {
+		if !share.Amount.IsPositive() {
+			return errEmptyShare
+		}
+		split = split.Add(share.Amount)
+	}
+	if split.GreaterThan(left) {
+		return errSplitTooLarge
+	}
+
+	for _, share := range shares {
+		share.ID = uuid.New()
+		share.TabID = tab.ID
+		share.Method = req.Method
+		for i := range share.Items {
+			share.Items[i].ShareID = share.ID
+		}
+		if err := dbHelper.CreateBillShare(tx, share); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSplitTab runs splitTab and responds with the tab and its new shares
+func writeSplitTab(w http.ResponseWriter, r *http.Request, tab models.TableTab, currency string) {
+	var req models.SplitTabRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validateSplit(w, &req, currency) {
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return splitTab(tx, tab.ID, currency, req)
+	})
+	switch {
+	case errors.Is(txErr, errTabNotFound):
+		http.Error(w, "tab not found", http.StatusNotFound)
+		return
+	case errors.Is(txErr, errTabClosed):
+		http.Error(w, "the tab is closed", http.StatusConflict)
+		return
+	case errors.Is(txErr, errNothingToSplit):
+		http.Error(w, "nothing is left to split, the bill is already covered", http.StatusConflict)
+		return
+	case errors.Is(txErr, errSplitTooLarge):
+		http.Error(w, "the shares add up to more than is left to pay", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(txErr, errEmptyShare):
+		http.Error(w, "a share comes to nothing", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(txErr, errItemNotOnTab):
+		http.Error(w, "an item is not on this tab", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(txErr, errItemAlreadySplit):
+		http.Error(w, "an item is already covered by another share", http.StatusConflict)
+		return
+	case txErr != nil:
+		http.Error(w, "failed to split bill", http.StatusInternalServerError)
+		return
+	}
+
+	full, err := tabWithOrders(tab, currency)
+	if err != nil {
+		http.Error(w, "failed to fetch tab orders", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(full); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SplitDineInTab splits what is left of the guest's tab by item, into equal
+// parts or into custom amounts, replacing shares nobody has paid yet
+func SplitDineInTab(w http.ResponseWriter, r *http.Request) {
+	restaurantID, tabID, ok := dineInSession(w, r)
+	if !ok {
+		return
+	}
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String())
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return
+	}
+	tab, err := dbHelper.GetTab(database.Rest, tabID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "tab not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch tab", http.StatusInternalServerError)
+		return
+	}
+
+	writeSplitTab(w, r, *tab, restaurant.Currency)
+}
+
+// staffTabFromPath loads the {id} tab if the caller works at its restaurant,
+// writing the error response otherwise
+func staffTabFromPath(w http.ResponseWriter, r *http.Request) (*models.TableTab, *models.Restaurant, bool) {
+	tabID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid tab ID format", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	tab, err := dbHelper.GetTab(database.Rest, tabID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !isRestaurantStaff(r, tab.RestaurantID)) {
+		http.Error(w, "tab not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch tab", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, tab.RestaurantID.String())
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return tab, restaurant, true
+}
+
+// SplitTab lets staff split a tab's bill the way guests can
+func SplitTab(w http.ResponseWriter, r *http.Request) {
+	tab, restaurant, ok := staffTabFromPath(w, r)
+	if !ok {
+		return
+	}
+	writeSplitTab(w, r, *tab, restaurant.Currency)
+}
+
+// createSharePayment records a payment for a share that is still payable.
+// At most one payment per share can be in flight or captured.
+func createSharePayment(payment models.Payment) error {
+	return database.Tx(func(tx *sqlx.Tx) error {
+		share, err := dbHelper.GetBillShareForUpdate(tx, *payment.BillShareID)
+		if err != nil {
+			return err
+		}
+		if share.PaidAt != nil || share.VoidedAt != nil {
+			return errShareUnavailable
+		}
+		if err := dbHelper.CreatePayment(tx, payment); err != nil {
+			return err
+		}
+		if payment.Status == models.PaymentCaptured {
+			return dbHelper.MarkBillSharePaid(tx, share.ID)
+		}
+		return nil
+	})
+}
+
+// writeSharePaymentError writes the response for a failed createSharePayment
+func writeSharePaymentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errShareUnavailable):
+		http.Error(w, "this share is already paid or the bill was split again", http.StatusConflict)
+	case dbHelper.IsUniqueViolation(err):
+		http.Error(w, "a payment for this share is already in progress", http.StatusConflict)
+	default:
+		http.Error(w, "failed to create payment", http.StatusInternalServerError)
+	}
+}
+
+// PayBillShare charges the guest for one share of their tab's bill. Retries
+// with the same Idempotency-Key header return the original payment, and an
+// attempt left unfinished is resumed rather than started over.
+func PayBillShare(w http.ResponseWriter, r *http.Request) {
+	_, tabID, ok := dineInSession(w, r)
+	if !ok {
+		return
+	}
+	shareID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid share ID format", http.StatusBadRequest)
+		return
+	}
+	share, err := dbHelper.GetBillShare(database.Rest, shareID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && share.TabID != tabID) {
+		http.Error(w, "bill share not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch bill share", http.StatusInternalServerError)
+		return
+	}
+
+	// one attempt per share until it fails, then a fresh attempt is allowed
+	key, done := paymentKey(w, r, "tab:"+tabID.String(), func() (string, error) {
+		failed, err := dbHelper.CountFailedBillSharePayments(database.Rest, share.ID)
+		return fmt.Sprintf("share:%s:%d", share.ID, failed), err
+	}, func(existing *models.Payment) bool {
+		return existing.BillShareID != nil && *existing.BillShareID == share.ID
+	}, share.ID.String())
+	if done {
+		return
+	}
+
+	payment := models.Payment{
+		ID:             uuid.New(),
+		BillShareID:    &share.ID,
+		Provider:       payments.Default.Name(),
+		Amount:         share.Amount.Amount,
+		Currency:       share.Amount.Currency,
+		Status:         models.PaymentPending,
+		IdempotencyKey: key,
+	}
+	err = createSharePayment(payment)
+	if dbHelper.IsUniqueViolation(err) {
+		// another attempt is live; carry on with it instead of charging twice
+		if live, liveErr := dbHelper.GetLiveBillSharePayment(database.Rest, share.ID); liveErr == nil {
+			chargePayment(w, r, *live, share.ID.String())
+			return
+		}
+	}
+	if err != nil {
+		writeSharePaymentError(w, err)
+		return
+	}
+
+	chargePayment(w, r, payment, share.ID.String())
+}
+
+// RecordCashPayment lets staff mark a share as paid in cash at the table
+func RecordCashPayment(w http.ResponseWriter, r *http.Request) {
+	shareID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid share ID format", http.StatusBadRequest)
+		return
+	}
+	share, err := dbHelper.GetBillShare(database.Rest, shareID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "bill share not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch bill share", http.StatusInternalServerError)
+		return
+	}
+	tab, err := dbHelper.GetTab(database.Rest, share.TabID)
+	if err != nil || !isRestaurantStaff(r, tab.RestaurantID) {
+		http.Error(w, "bill share not found", http.StatusNotFound)
+		return
+	}
+
+	payment := models.Payment{
+		ID:             uuid.New(),
+		BillShareID:    &share.ID,
+		Provider:       cashProvider,
+		Amount:         share.Amount.Amount,
+		Currency:       share.Amount.Currency,
+		Status:         models.PaymentCaptured,
+		IdempotencyKey: "share:" + share.ID.String() + ":cash",
+	}
+	if err := createSharePayment(payment); err != nil {
+		writeSharePaymentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	utils.JSON.NewEncoder(w).Encode(payment)
+}
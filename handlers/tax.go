@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"strings"
+)
+
+// staffRestaurantFromPath parses the {id} restaurant and checks the caller is
+// an admin or the sub admin who created it, writing the error response otherwise
+func staffRestaurantFromPath(w http.ResponseWriter, r *http.Request) (*models.Restaurant, bool) {
+	restaurantID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid restaurant ID format", http.StatusBadRequest)
+		return nil, false
+	}
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, restaurantID.String())
+	if err != nil {
+		http.Error(w, "restaurant not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !isRestaurantStaff(r, restaurantID) {
+		http.Error(w, "you can only manage your own restaurants", http.StatusForbidden)
+		return nil, false
+	}
+	return restaurant, true
+}
+
+func GetTaxRules(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := dbHelper.GetTaxRules(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch tax rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(rules); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// UpdateTaxRules replaces a restaurant's tax rules. Orders already placed keep
+// the taxes they were charged.
+func UpdateTaxRules(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+	restaurantID := restaurant.ID
+
+	var req models.UpdateTaxRulesRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	hundred := decimal.NewFromInt(100)
+	if req.ServiceChargeRate.IsNegative() || req.ServiceChargeRate.GreaterThan(hundred) ||
+		req.PackagingFee.InCurrency(restaurant.Currency) != nil || req.PackagingFee.IsNegative() {
+		http.Error(w, "invalid service_charge_rate or packaging_fee", http.StatusBadRequest)
+		return
+	}
+
+	rules := models.TaxRules{
+		TaxSettings: models.TaxSettings{
+			RestaurantID:      restaurantID,
+			PricesIncludeTax:  req.PricesIncludeTax,
+			ServiceChargeRate: req.ServiceChargeRate,
+			PackagingFee:      req.PackagingFee,
+		},
+		Rates: make([]models.TaxRate, 0, len(req.Rates)),
+	}
+	for _, rate := range req.Rates {
+		name := strings.TrimSpace(rate.Name)
+		if name == "" || rate.Rate.IsNegative() || rate.Rate.GreaterThan(hundred) {
+			http.Error(w, "every rate needs a name and a rate between 0 and 100", http.StatusBadRequest)
+			return
+		}
+		if rate.Category != nil {
+			if category := strings.TrimSpace(*rate.Category); category != "" {
+				rate.Category = &category
+			} else {
+				rate.Category = nil
+			}
+		}
+		rules.Rates = append(rules.Rates, models.TaxRate{
+			ID:           uuid.New(),
+			RestaurantID: restaurantID,
+			Category:     rate.Category,
+			Name:         name,
+			Rate:         rate.Rate,
+		})
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbHelper.ReplaceTaxRules(tx, rules)
+	})
+	if txErr != nil {
+		http.Error(w, "failed to update tax rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "tax rules updated successfully"})
+}
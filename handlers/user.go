@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
@@ -9,6 +12,7 @@ import (
 	"new_restaurant/database/dbHelper"
 	"new_restaurant/models"
 	"new_restaurant/utils"
+	"strings"
 )
 
 func CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -115,35 +119,70 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID.String(), string(role.RoleType))
-	if err != nil {
-		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+	mfa, err := dbHelper.GetActiveMFA(database.Rest, user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "failed to fetch mfa settings", http.StatusInternalServerError)
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID.String(), string(role.RoleType))
+	mfaEnabled := mfa != nil && mfa.EnabledAt != nil
+	if mfaEnabled || mfaRequiredForRole(string(role.RoleType)) {
+		mfaToken, err := utils.GenerateMFAToken(user.ID.String(), string(role.RoleType))
+		if err != nil {
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		utils.JSON.NewEncoder(w).Encode(models.MFAChallengeResponse{
+			MFARequired:           true,
+			MFAEnrollmentRequired: !mfaEnabled,
+			MFAToken:              mfaToken,
+		})
+		return
+	}
+
+	tokens, err := issueLoginTokens(user.ID, string(role.RoleType))
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
+
+// issueLoginTokens stores a new session and generates the access and refresh
+// tokens bound to it
+func issueLoginTokens(userID uuid.UUID, role string) (*models.LoginTokens, error) {
+	sessionID := uuid.New()
+	token, err := utils.GenerateJWT(userID.String(), role, sessionID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken(userID.String(), role, sessionID.String())
+	if err != nil {
+		return nil, err
+	}
+
 	session := models.Session{
-		ID:           uuid.New(),
-		UserID:       user.ID,
+		ID:           sessionID,
+		UserID:       userID,
 		RefreshToken: refreshToken,
 	}
 
-	err = dbHelper.CreateSession(database.Rest, session)
-	if err != nil {
-		http.Error(w, "failed to create refresh token", http.StatusInternalServerError)
-		return
+	if err := dbHelper.CreateSession(database.Rest, session); err != nil {
+		return nil, err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	utils.JSON.NewEncoder(w).Encode(map[string]string{
-		"token":         token,
-		"refresh_token": refreshToken,
-	})
+	return &models.LoginTokens{
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, nil
 }
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
@@ -186,39 +225,283 @@ func ListAllSubAdmins(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func CreateAddress(w http.ResponseWriter, r *http.Request) {
-	if !utils.HasRole(r, "admin") && !utils.HasRole(r, "sub_admin") && !utils.HasRole(r, "user") {
-		http.Error(w, "user not logged in", http.StatusForbidden)
+var (
+	errLastAdmin = errors.New("cannot remove the last admin")
+	errLastRole  = errors.New("user must keep at least one role")
+)
+
+// userIDFromPath parses the {id} route variable
+func userIDFromPath(r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	return userID, err == nil
+}
+
+// activeRoles picks the roles that have not been revoked out of a role history
+func activeRoles(history []models.UserRole) []models.RoleType {
+	roles := make([]models.RoleType, 0)
+	for _, role := range history {
+		if role.ArchivedAt == nil {
+			roles = append(roles, role.RoleType)
+		}
+	}
+	return roles
+}
+
+// validateUpdateUserRequest returns an error message when the update is empty or malformed
+func validateUpdateUserRequest(req models.UpdateUserRequest) (string, bool) {
+	if req.Name == nil && req.Email == nil {
+		return "nothing to update", false
+	}
+	if (req.Name != nil && strings.TrimSpace(*req.Name) == "") ||
+		(req.Email != nil && !strings.Contains(*req.Email, "@")) {
+		return "invalid name or email", false
+	}
+	return "", true
+}
+
+// ensureNotLastAdmin fails with errLastAdmin if userID is the only active admin
+func ensureNotLastAdmin(tx *sqlx.Tx, userID uuid.UUID) error {
+	admins, err := dbHelper.LockActiveAdmins(tx)
+	if err != nil {
+		return err
+	}
+	for _, adminID := range admins {
+		if adminID != userID {
+			return nil
+		}
+	}
+	if len(admins) > 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+func GetUserByAdmin(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") {
+		http.Error(w, "only admin can view users", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := userIDFromPath(r)
+	if !ok {
+		http.Error(w, "invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	user, err := dbHelper.GetUserByID(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	history, err := dbHelper.GetUserRoles(database.Rest, userID)
+	if err != nil {
+		http.Error(w, "failed to fetch user roles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(models.UserDetailResponse{
+		User:        user,
+		Roles:       activeRoles(history),
+		RoleHistory: history,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func UpdateUserByAdmin(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") {
+		http.Error(w, "only admin can update users", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := userIDFromPath(r)
+	if !ok {
+		http.Error(w, "invalid user ID format", http.StatusBadRequest)
 		return
 	}
 
-	var req models.UserAddressRequest
+	var req models.UpdateUserRequest
 	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	if msg, ok := validateUpdateUserRequest(req); !ok {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
 
-	userID, ok := utils.GetUserID(r)
+	updated, err := dbHelper.UpdateUser(database.Rest, userID, req.Name, req.Email)
+	if dbHelper.IsUniqueViolation(err) {
+		http.Error(w, "email already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "user updated successfully"})
+}
+
+func DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") {
+		http.Error(w, "only admin can deactivate users", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := userIDFromPath(r)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		http.Error(w, "invalid user ID format", http.StatusBadRequest)
 		return
 	}
 
-	user := models.UserAddress{
-		ID:        uuid.New(),
-		UserID:    userID,
-		Address:   req.Address,
-		Latitude:  req.Latitude,
-		Longitude: req.Longitude,
+	if _, err := dbHelper.GetUserByID(database.Rest, userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
 	}
 
-	err := dbHelper.CreateUserAddress(database.Rest, user)
-	if err != nil {
-		http.Error(w, "failed to create user", http.StatusInternalServerError)
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if err := ensureNotLastAdmin(tx, userID); err != nil {
+			return err
+		}
+		if err := dbHelper.ArchiveUser(tx, userID); err != nil {
+			return err
+		}
+		return dbHelper.ArchiveUserSessions(tx, userID)
+	})
+	if errors.Is(txErr, errLastAdmin) {
+		http.Error(w, txErr.Error(), http.StatusConflict)
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to deactivate user", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	utils.JSON.NewEncoder(w).Encode(map[string]string{
-		"message": "User address created successfully",
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "user deactivated successfully"})
+}
+
+func GrantUserRole(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") {
+		http.Error(w, "only admin can grant roles", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := userIDFromPath(r)
+	if !ok {
+		http.Error(w, "invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UserRoleRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || !req.Role.IsValid() {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := dbHelper.GetUserByID(database.Rest, userID); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	granted := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		roles, err := dbHelper.GetActiveRoleTypes(tx, userID)
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if role == req.Role {
+				return nil
+			}
+		}
+		granted = true
+		return dbHelper.CreateUserRole(tx, models.UserRole{
+			ID:       uuid.New(),
+			UserID:   userID,
+			RoleType: req.Role,
+		})
 	})
+	if dbHelper.IsUniqueViolation(txErr) {
+		// a concurrent request granted the same role first
+		granted, txErr = false, nil
+	}
+	if txErr != nil {
+		http.Error(w, "failed to grant role", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if granted {
+		w.WriteHeader(http.StatusCreated)
+	}
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "role granted successfully"})
+}
+
+func RevokeUserRole(w http.ResponseWriter, r *http.Request) {
+	if !utils.HasRole(r, "admin") {
+		http.Error(w, "only admin can revoke roles", http.StatusForbidden)
+		return
+	}
+
+	userID, ok := userIDFromPath(r)
+	if !ok {
+		http.Error(w, "invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	role := models.RoleType(mux.Vars(r)["role"])
+	if !role.IsValid() {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+
+	found := false
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if role == models.RoleAdmin {
+			if err := ensureNotLastAdmin(tx, userID); err != nil {
+				return err
+			}
+		}
+
+		roles, err := dbHelper.GetActiveRoleTypes(tx, userID)
+		if err != nil {
+			return err
+		}
+		for _, active := range roles {
+			if active == role {
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+		if len(roles) == 1 {
+			return errLastRole
+		}
+		return dbHelper.ArchiveUserRole(tx, userID, role)
+	})
+	if errors.Is(txErr, errLastAdmin) || errors.Is(txErr, errLastRole) {
+		http.Error(w, txErr.Error(), http.StatusConflict)
+		return
+	}
+	if txErr != nil {
+		http.Error(w, "failed to revoke role", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "user does not have this role", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(map[string]string{"message": "role revoked successfully"})
 }
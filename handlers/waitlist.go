@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"math"
+	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"new_restaurant/utils"
+	"new_restaurant/waitlist"
+	"strings"
+	"time"
+)
+
+// turnoverHistory is how far back table turnover is averaged for wait estimates
+const turnoverHistory = 30 * 24 * time.Hour
+
+// reservationLookahead is how far ahead booked reservations are checked when
+// estimating when a table frees up for walk-ins
+const reservationLookahead = 24 * time.Hour
+
+var (
+	errWaitlistEntryNotFound = errors.New("waitlist entry not found")
+	errTableTooSmall         = errors.New("table is too small for the party")
+	errTableReservedSoon     = errors.New("table is reserved within the turnover")
+)
+
+// tableTurnover is how long a party is expected to hold a table at the
+// restaurant: the average over recent history, or the reservation length
+// without any
+func tableTurnover(restaurantID uuid.UUID, now time.Time) (time.Duration, error) {
+	schedule, err := dbHelper.GetRestaurantSchedule(database.Rest, restaurantID)
+	if err != nil {
+		return 0, err
+	}
+	if average, ok, err := dbHelper.AverageTableTurnover(database.Rest, restaurantID, now.Add(-turnoverHistory)); err != nil {
+		return 0, err
+	} else if ok {
+		return average, nil
+	}
+	return time.Duration(schedule.ReservationMinutes) * time.Minute, nil
+}
+
+// estimateWaitlist puts the restaurant's active entries in queue order with
+// their expected wait. Occupied tables are expected to free up one turnover
+// after the party sat down. A walk-in cannot sit at a table booked before
+// they would leave, so such a table only frees up once the booking ends.
+func estimateWaitlist(restaurantID uuid.UUID, entries []models.WaitlistEntry) ([]models.WaitlistEntryWithEstimate, error) {
+	now := time.Now()
+	turnover, err := tableTurnover(restaurantID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := dbHelper.ListDiningTables(database.Rest, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := dbHelper.ListOpenTableSessions(database.Rest, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	seatedAt := make(map[uuid.UUID]time.Time, len(sessions))
+	for _, session := range sessions {
+		seatedAt[session.TableID] = session.SeatedAt
+	}
+	reservations, err := dbHelper.ListRestaurantReservations(database.Rest, restaurantID, now, now.Add(reservationLookahead))
+	if err != nil {
+		return nil, err
+	}
+
+	queueTables := make([]waitlist.Table, 0, len(tables))
+	for _, table := range tables {
+		freeAt := now
+		if seated, occupied := seatedAt[table.ID]; occupied && seated.Add(turnover).After(now) {
+			freeAt = seated.Add(turnover)
+		}
+		// reservations come in the order they start, so back to back
+		// bookings push the table back one after another
+		for _, reservation := range reservations {
+			if reservation.TableID == table.ID && reservation.Status == models.ReservationBooked &&
+				reservation.StartsAt.Before(freeAt.Add(turnover)) && reservation.EndsAt.After(freeAt) {
+				freeAt = reservation.EndsAt
+			}
+		}
+		queueTables = append(queueTables, waitlist.Table{Capacity: table.Capacity, FreeAt: freeAt})
+	}
+	sizes := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		sizes = append(sizes, entry.PartySize)
+	}
+
+	waits := waitlist.EstimateQueue(now, queueTables, sizes, turnover)
+	estimated := make([]models.WaitlistEntryWithEstimate, 0, len(entries))
+	for i, entry := range entries {
+		withEstimate := models.WaitlistEntryWithEstimate{WaitlistEntry: entry, Position: i + 1}
+		if waits[i] != nil {
+			minutes := int(math.Ceil(waits[i].Minutes()))
+			withEstimate.EstimatedWaitMinutes = &minutes
+		}
+		estimated = append(estimated, withEstimate)
+	}
+	return estimated, nil
+}
+
+// ListWaitlist returns the parties waiting at the restaurant in queue order,
+// with their expected wait
+func ListWaitlist(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := dbHelper.ListActiveWaitlist(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to list waitlist", http.StatusInternalServerError)
+		return
+	}
+	estimated, err := estimateWaitlist(restaurant.ID, entries)
+	if err != nil {
+		http.Error(w, "failed to estimate waits", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(map[string]interface{}{
+		"waitlist": estimated,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// AddToWaitlist puts a walk-in party at the end of the queue. The response
+// carries the token for the guest's status link.
+func AddToWaitlist(w http.ResponseWriter, r *http.Request) {
+	restaurant, ok := staffRestaurantFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateWaitlistEntryRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.PartyName = strings.TrimSpace(req.PartyName)
+	if req.PartyName == "" || req.PartySize < 1 {
+		http.Error(w, "party_name and a positive party_size are required", http.StatusBadRequest)
+		return
+	}
+	if req.Phone != nil {
+		if phone := strings.TrimSpace(*req.Phone); phone != "" {
+			req.Phone = &phone
+		} else {
+			req.Phone = nil
+		}
+	}
+	if req.Notes != nil {
+		if notes := strings.TrimSpace(*req.Notes); notes != "" {
+			req.Notes = &notes
+		} else {
+			req.Notes = nil
+		}
+	}
+
+	token, err := utils.GenerateToken(16)
+	if err != nil {
+		http.Error(w, "failed to create waitlist entry", http.StatusInternalServerError)
+		return
+	}
+	userID, _ := utils.GetUserID(r)
+	entry := models.WaitlistEntry{
+		ID:           uuid.New(),
+		RestaurantID: restaurant.ID,
+		PartyName:    req.PartyName,
+		PartySize:    req.PartySize,
+		Phone:        req.Phone,
+		Notes:        req.Notes,
+		Status:       models.WaitlistWaiting,
+		Token:        token,
+		CreatedBy:    userID,
+	}
+	if err := dbHelper.CreateWaitlistEntry(database.Rest, entry); err != nil {
+		http.Error(w, "failed to create waitlist entry", http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := dbHelper.ListActiveWaitlist(database.Rest, restaurant.ID)
+	if err != nil {
+		http.Error(w, "failed to list waitlist", http.StatusInternalServerError)
+		return
+	}
+	estimated, err := estimateWaitlist(restaurant.ID, entries)
+	if err != nil {
+		http.Error(w, "failed to estimate waits", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	for _, candidate := range estimated {
+		if candidate.ID == entry.ID {
+			utils.JSON.NewEncoder(w).Encode(candidate)
+			return
+		}
+	}
+	utils.JSON.NewEncoder(w).Encode(entry)
+}
+
+// transitionWaitlistEntry locks the {id} entry, checks the caller is staff of
+// its restaurant, runs fn if given and moves it to next, writing the error
+// response on failure
+func transitionWaitlistEntry(w http.ResponseWriter, r *http.Request, next models.WaitlistStatus,
+	fn func(tx *sqlx.Tx, entry *models.WaitlistEntry) error) (*models.WaitlistEntry, bool) {
+	entryID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid waitlist entry ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var entry *models.WaitlistEntry
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		entry, err = dbHelper.GetWaitlistEntryForUpdate(tx, entryID)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && !isRestaurantStaff(r, entry.RestaurantID) {
+			return errWaitlistEntryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.Status.CanTransitionTo(next) {
+			return models.ErrInvalidWaitlistTransition
+		}
+		if fn != nil {
+			if err := fn(tx, entry); err != nil {
+				return err
+			}
+		}
+		entry.Status = next
+		return dbHelper.UpdateWaitlistEntry(tx, *entry)
+	})
+	switch {
+	case errors.Is(txErr, errWaitlistEntryNotFound):
+		http.Error(w, "waitlist entry not found", http.StatusNotFound)
+	case errors.Is(txErr, models.ErrInvalidWaitlistTransition):
+		http.Error(w, fmt.Sprintf("a %s party cannot be marked %s", entry.Status, next), http.StatusConflict)
+	case errors.Is(txErr, errTableNotFound):
+		http.Error(w, "table not found", http.StatusNotFound)
+	case errors.Is(txErr, errTableTooSmall):
+		http.Error(w, "the table is too small for the party", http.StatusConflict)
+	case errors.Is(txErr, errTableOccupied):
+		http.Error(w, "the table is still occupied, clear it first", http.StatusConflict)
+	case errors.Is(txErr, errTableReservedSoon):
+		http.Error(w, "the table is reserved before the party would leave, pick another", http.StatusConflict)
+	case txErr != nil:
+		http.Error(w, "failed to update waitlist entry", http.StatusInternalServerError)
+	default:
+		return entry, true
+	}
+	return nil, false
+}
+
+// NotifyWaitlistEntry tells the party their table is ready; guests see it on
+// their status link
+func NotifyWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := transitionWaitlistEntry(w, r, models.WaitlistNotified, func(_ *sqlx.Tx, entry *models.WaitlistEntry) error {
+		now := time.Now()
+		entry.NotifiedAt = &now
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(entry)
+}
+
+// SeatWaitlistEntry sits the party at a free table that seats them and is
+// not booked before they would be expected to leave
+func SeatWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	var req models.SeatWaitlistEntryRequest
+	if err := utils.JSON.NewDecoder(r.Body).Decode(&req); err != nil || req.TableID == uuid.Nil {
+		http.Error(w, "table_id is required", http.StatusBadRequest)
+		return
+	}
+
+	entry, ok := transitionWaitlistEntry(w, r, models.WaitlistSeated, func(tx *sqlx.Tx, entry *models.WaitlistEntry) error {
+		table, err := dbHelper.GetDiningTableForUpdate(tx, entry.RestaurantID, req.TableID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errTableNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if table.Capacity < entry.PartySize {
+			return errTableTooSmall
+		}
+		now := time.Now()
+		turnover, err := tableTurnover(entry.RestaurantID, now)
+		if err != nil {
+			return err
+		}
+		// the table lock keeps bookings off the table until this commits
+		reserved, err := dbHelper.HasBookedReservation(tx, table.ID, now, now.Add(turnover))
+		if err != nil {
+			return err
+		}
+		if reserved {
+			return errTableReservedSoon
+		}
+
+		session := models.TableSession{
+			ID:           uuid.New(),
+			RestaurantID: entry.RestaurantID,
+			TableID:      table.ID,
+			PartySize:    entry.PartySize,
+		}
+		if err := seatParty(tx, session); err != nil {
+			return err
+		}
+		entry.TableSessionID = &session.ID
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(entry)
+}
+
+// RemoveWaitlistEntry takes a party that left or cancelled off the queue
+func RemoveWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := transitionWaitlistEntry(w, r, models.WaitlistRemoved, nil)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	utils.JSON.NewEncoder(w).Encode(entry)
+}
+
+// GetWaitlistStatus shows a guest their place in the queue and expected
+// wait. It is public: the token from the guest's link is the credential.
+func GetWaitlistStatus(w http.ResponseWriter, r *http.Request) {
+	entry, err := dbHelper.GetWaitlistEntryByToken(database.Rest, mux.Vars(r)["token"])
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "waitlist entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch waitlist entry", http.StatusInternalServerError)
+		return
+	}
+	restaurant, err := dbHelper.GetRestaurantByID(database.Rest, entry.RestaurantID.String())
+	if err != nil {
+		http.Error(w, "failed to fetch restaurant", http.StatusInternalServerError)
+		return
+	}
+
+	status := models.WaitlistGuestStatus{
+		RestaurantName: restaurant.Name,
+		PartyName:      entry.PartyName,
+		PartySize:      entry.PartySize,
+		Status:         entry.Status,
+	}
+	if entry.Status.IsActive() {
+		entries, err := dbHelper.ListActiveWaitlist(database.Rest, entry.RestaurantID)
+		if err != nil {
+			http.Error(w, "failed to list waitlist", http.StatusInternalServerError)
+			return
+		}
+		estimated, err := estimateWaitlist(entry.RestaurantID, entries)
+		if err != nil {
+			http.Error(w, "failed to estimate waits", http.StatusInternalServerError)
+			return
+		}
+		for _, candidate := range estimated {
+			if candidate.ID == entry.ID {
+				status.Position, status.EstimatedWaitMinutes = candidate.Position, candidate.EstimatedWaitMinutes
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := utils.JSON.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,140 @@
+package invoice
+
+import (
+	"bufio"
+	"io"
+	"new_restaurant/models"
+	"strconv"
+	"strings"
+)
+
+// ESC/POS control sequences understood by practically every thermal printer
+const (
+	escInit        = "\x1b@"
+	escAlignLeft   = "\x1ba\x00"
+	escAlignCenter = "\x1ba\x01"
+	escBoldOn      = "\x1bE\x01"
+	escBoldOff     = "\x1bE\x00"
+	escDoubleOn    = "\x1d!\x11"
+	escDoubleOff   = "\x1d!\x00"
+	// feed three lines, then cut the paper
+	escFeedCut = "\x1dVA\x03"
+)
+
+const (
+	// DefaultWidth is the characters per line of an 80mm printer in its default font
+	DefaultWidth = 48
+	MinWidth     = 32
+	MaxWidth     = 64
+)
+
+// ESCPOS writes the invoice as plain text laid out for a receipt printer
+// width characters wide, framed by ESC/POS commands for alignment, emphasis
+// and the paper cut. Printers only get ASCII; anything else becomes '?'.
+func ESCPOS(w io.Writer, inv models.InvoiceWithItems, width int) error {
+	width = max(MinWidth, min(width, MaxWidth))
+	b := bufio.NewWriter(w)
+	line := func(text string) {
+		b.WriteString(ascii(text))
+		b.WriteString("\n")
+	}
+	rule := strings.Repeat("-", width)
+
+	b.WriteString(escInit + escAlignCenter + escDoubleOn)
+	// double size characters take twice the width
+	for _, text := range wrap(inv.RestaurantName, width/2) {
+		line(text)
+	}
+	b.WriteString(escDoubleOff)
+	for _, text := range wrap(inv.RestaurantAddress, width) {
+		line(text)
+	}
+	line("")
+	b.WriteString(escBoldOn)
+	line("INVOICE " + inv.InvoiceNumber)
+	b.WriteString(escBoldOff)
+	line(inv.IssuedAt.Format(dateLayout))
+
+	b.WriteString(escAlignLeft)
+	for _, text := range append(wrap("Order: "+inv.OrderID.String(), width), wrap("Billed to: "+inv.CustomerName, width)...) {
+		line(text)
+	}
+	line(rule)
+
+	for _, item := range inv.Items {
+		for _, text := range wrap(itemLabel(item), width) {
+			line(text)
+		}
+		detail := "  " + strconv.Itoa(item.Quantity) + " x " + item.UnitPrice.String()
+		line(columns(detail, item.UnitPrice.MulInt(item.Quantity).String(), width))
+	}
+	line(rule)
+
+	for _, r := range summary(inv) {
+		if r.total {
+			b.WriteString(escBoldOn)
+		}
+		line(columns(r.label, r.amount.String(), width))
+		if r.total {
+			b.WriteString(escBoldOff)
+		}
+	}
+
+	b.WriteString(escAlignCenter)
+	line("")
+	line("Thank you!")
+	b.WriteString(escFeedCut)
+	return b.Flush()
+}
+
+// columns puts left and right on one line, width characters wide, moving
+// right onto its own line when they do not fit together
+func columns(left, right string, width int) string {
+	left = ascii(left)
+	gap := width - len(left) - len(right)
+	if gap < 1 {
+		return left + "\n" + strings.Repeat(" ", max(width-len(right), 0)) + right
+	}
+	return left + strings.Repeat(" ", gap) + right
+}
+
+// wrap breaks text into lines of at most width characters at spaces
+func wrap(text string, width int) []string {
+	text = ascii(text)
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(text) {
+		for len(word) > width {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			lines = append(lines, word[:width])
+			word = word[width:]
+		}
+		switch {
+		case current == "":
+			current = word
+		case len(current)+1+len(word) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// ascii replaces everything a printer's default code page may not have with
+// '?', which also makes byte lengths character counts
+func ascii(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r >= ' ' && r <= '~' {
+			return r
+		}
+		return '?'
+	}, text)
+}
@@ -0,0 +1,63 @@
+// Package invoice renders an invoice as a PDF or as ESC/POS text for thermal
+// receipt printers. Both layouts print the same header, lines and summary.
+package invoice
+
+import (
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"strconv"
+)
+
+// row is one label and amount of the summary under the item lines
+type row struct {
+	label  string
+	amount money.Money
+	// total rows are printed in bold
+	total bool
+}
+
+// itemLabel names a line, noting any units refunded after the invoice was issued
+func itemLabel(item models.OrderItem) string {
+	if item.RefundedQuantity > 0 {
+		return item.Name + " (" + strconv.Itoa(item.RefundedQuantity) + " refunded)"
+	}
+	return item.Name
+}
+
+// summary lists the amounts that make up the total. Lines are printed at
+// their undiscounted price, so discounts and taxes are itemised here.
+func summary(inv models.InvoiceWithItems) []row {
+	rows := []row{{label: "Subtotal", amount: inv.Subtotal}}
+	for _, discount := range inv.Discounts {
+		rows = append(rows, row{label: discount.Name, amount: discount.Amount.MulInt(-1)})
+	}
+	if inv.PointsDiscount.IsPositive() {
+		rows = append(rows, row{label: "Loyalty points", amount: inv.PointsDiscount.MulInt(-1)})
+	}
+	if !inv.DeliveryFee.IsZero() {
+		rows = append(rows, row{label: "Delivery fee", amount: inv.DeliveryFee})
+	}
+	if !inv.PackagingFee.IsZero() {
+		rows = append(rows, row{label: "Packaging fee", amount: inv.PackagingFee})
+	}
+	if !inv.ServiceCharge.IsZero() {
+		rows = append(rows, row{label: "Service charge", amount: inv.ServiceCharge})
+	}
+	for _, tax := range inv.Taxes {
+		label := tax.Name + " " + tax.Rate.String() + "%"
+		if inv.PricesIncludeTax {
+			label += " (included)"
+		}
+		rows = append(rows, row{label: label, amount: tax.Amount})
+	}
+	rows = append(rows, row{label: "Total", amount: inv.Total, total: true})
+	if inv.RefundedTotal.IsPositive() {
+		rows = append(rows,
+			row{label: "Refunded", amount: inv.RefundedTotal.MulInt(-1)},
+			row{label: "Net paid", amount: inv.Total.Sub(inv.RefundedTotal), total: true},
+		)
+	}
+	return rows
+}
+
+const dateLayout = "02 Jan 2006 15:04 MST"
@@ -0,0 +1,71 @@
+package invoice
+
+import (
+	"github.com/go-pdf/fpdf"
+	"io"
+	"new_restaurant/models"
+	"strconv"
+)
+
+// PDF writes the invoice as a single A4 document
+func PDF(w io.Writer, inv models.InvoiceWithItems) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(inv.InvoiceNumber, true)
+	pdf.SetMargins(15, 15, 15)
+	pdf.AddPage()
+	// the core fonts only cover cp1252
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 8, tr(inv.RestaurantName), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.MultiCell(0, 5, tr(inv.RestaurantAddress), "", "L", false)
+	pdf.Ln(6)
+
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(0, 6, "Invoice "+inv.InvoiceNumber, "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range []string{
+		"Issued: " + inv.IssuedAt.Format(dateLayout),
+		"Order: " + inv.OrderID.String(),
+		"Billed to: " + inv.CustomerName,
+	} {
+		pdf.CellFormat(0, 5, tr(line), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	// item table: name, quantity, unit price, amount
+	widths := []float64{95, 15, 35, 35}
+	pdf.SetFont("Helvetica", "B", 10)
+	for i, heading := range []string{"Item", "Qty", "Unit price", "Amount"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, heading, "B", 0, align, false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 10)
+	for _, item := range inv.Items {
+		pdf.CellFormat(widths[0], 6, tr(itemLabel(item)), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 6, strconv.Itoa(item.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 6, item.UnitPrice.String(), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, item.UnitPrice.MulInt(item.Quantity).String(), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(2)
+
+	labelWidth := widths[0] + widths[1] + widths[2]
+	for _, r := range summary(inv) {
+		border := ""
+		if r.total {
+			pdf.SetFont("Helvetica", "B", 10)
+			border = "T"
+		} else {
+			pdf.SetFont("Helvetica", "", 10)
+		}
+		pdf.CellFormat(labelWidth, 6, tr(r.label), border, 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, r.amount.String(), border, 1, "R", false, 0, "")
+	}
+
+	return pdf.Output(w)
+}
@@ -2,37 +2,98 @@ package middleware
 
 import (
 	"context"
-	"github.com/golang-jwt/jwt/v5"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
 	"net/http"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
 	"new_restaurant/utils"
 	"strings"
 )
 
+// isStream reports whether the request opens a long-lived stream, a
+// WebSocket or an EventSource, which browsers cannot send the Authorization
+// header with
+func isStream(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// AuthMiddleware admits requests bearing an access token. Streams may instead
+// pass a stream token from /api/me/stream-token as the stream_token query
+// parameter.
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer ") {
+		purpose := ""
+		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+		if streamToken := r.URL.Query().Get("stream_token"); authHeader == "" && streamToken != "" && isStream(r) {
+			purpose, tokenStr = utils.PurposeStream, streamToken
+		} else if !strings.HasPrefix(authHeader, "Bearer ") {
 			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
 			return
 		}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-
-		token, err := jwt.ParseWithClaims(tokenStr, &utils.CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return utils.JwtKey(), nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := utils.ParseToken(tokenStr)
+		if err != nil {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		claims, ok := token.Claims.(*utils.CustomClaims)
-		if !ok {
+		if claims.Purpose != purpose {
 			http.Error(w, "invalid claims", http.StatusUnauthorized)
 			return
 		}
 
+		// roles are looked up on every request so that revoked roles,
+		// revoked sessions and deactivated users lose access before their
+		// tokens expire
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			http.Error(w, "invalid claims", http.StatusUnauthorized)
+			return
+		}
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			http.Error(w, "invalid claims", http.StatusUnauthorized)
+			return
+		}
+		claims.Roles, err = dbHelper.ListActiveRoles(database.Rest, userID, sessionID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to fetch user roles", http.StatusInternalServerError)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), "user", claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// DineInMiddleware admits guests holding a dine-in session token opened by
+// scanning a table's QR code
+func DineInMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := utils.ParseTableClaims(strings.TrimPrefix(authHeader, "Bearer "), utils.PurposeDineIn)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "guest", claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Courier is a courier's shift status and last reported position
+type Courier struct {
+	UserID            uuid.UUID  `json:"user_id" db:"user_id"`
+	Available         bool       `json:"available" db:"available"`
+	Latitude          *float64   `json:"latitude,omitempty" db:"latitude"`
+	Longitude         *float64   `json:"longitude,omitempty" db:"longitude"`
+	LocationUpdatedAt *time.Time `json:"location_updated_at,omitempty" db:"location_updated_at"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+type AssignmentStatus string
+
+const (
+	AssignmentOffered   AssignmentStatus = "offered"
+	AssignmentAccepted  AssignmentStatus = "accepted"
+	AssignmentDeclined  AssignmentStatus = "declined"
+	AssignmentExpired   AssignmentStatus = "expired"
+	AssignmentCancelled AssignmentStatus = "cancelled"
+	AssignmentCompleted AssignmentStatus = "completed"
+)
+
+// DeliveryAssignment is an order offered to a courier. An offer the courier
+// does not answer before ExpiresAt goes to the next nearest courier.
+type DeliveryAssignment struct {
+	ID          uuid.UUID        `json:"id" db:"id"`
+	OrderID     uuid.UUID        `json:"order_id" db:"order_id"`
+	CourierID   uuid.UUID        `json:"courier_id" db:"courier_id"`
+	Status      AssignmentStatus `json:"status" db:"status"`
+	DistanceKm  float64          `json:"distance_km" db:"distance_km"`
+	OfferedAt   time.Time        `json:"offered_at" db:"offered_at"`
+	ExpiresAt   time.Time        `json:"expires_at" db:"expires_at"`
+	RespondedAt *time.Time       `json:"responded_at,omitempty" db:"responded_at"`
+}
+
+// CourierAssignment is an assignment with what the courier needs to do it
+type CourierAssignment struct {
+	DeliveryAssignment
+	RestaurantName    string   `json:"restaurant_name" db:"restaurant_name"`
+	RestaurantAddress string   `json:"restaurant_address" db:"restaurant_address"`
+	DeliveryAddress   *string  `json:"delivery_address,omitempty" db:"delivery_address"`
+	DeliveryLatitude  *float64 `json:"delivery_latitude,omitempty" db:"delivery_latitude"`
+	DeliveryLongitude *float64 `json:"delivery_longitude,omitempty" db:"delivery_longitude"`
+}
+
+type CourierAvailabilityRequest struct {
+	Available bool `json:"available"`
+}
+
+type CourierLocationRequest struct {
+	Latitude  *float64 `json:"latitude" validate:"required"`
+	Longitude *float64 `json:"longitude" validate:"required"`
+}
@@ -0,0 +1,8 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+func init() {
+	// tax and discount rates are sent as JSON numbers, not strings
+	decimal.MarshalJSONWithoutQuotes = true
+}
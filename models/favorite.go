@@ -0,0 +1,8 @@
+package models
+
+// Favorites are the restaurants and dishes a customer saved, most recently
+// saved first
+type Favorites struct {
+	Restaurants []Restaurant `json:"restaurants"`
+	Dishes      []Dish       `json:"dishes"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"new_restaurant/money"
+	"time"
+)
+
+// Invoice is the bill for a paid order. Numbers are sequential per restaurant
+// and the amounts are those charged when the order was paid.
+type Invoice struct {
+	ID                uuid.UUID   `json:"id" db:"id"`
+	OrderID           uuid.UUID   `json:"order_id" db:"order_id"`
+	RestaurantID      uuid.UUID   `json:"restaurant_id" db:"restaurant_id"`
+	Number            int64       `json:"-" db:"number"`
+	RestaurantName    string      `json:"restaurant_name" db:"restaurant_name"`
+	RestaurantAddress string      `json:"restaurant_address" db:"restaurant_address"`
+	CustomerName      string      `json:"customer_name" db:"customer_name"`
+	Subtotal          money.Money `json:"subtotal" db:"subtotal"`
+	DeliveryFee       money.Money `json:"delivery_fee" db:"delivery_fee"`
+	PackagingFee      money.Money `json:"packaging_fee" db:"packaging_fee"`
+	ServiceCharge     money.Money `json:"service_charge" db:"service_charge"`
+	DiscountTotal     money.Money `json:"discount_total" db:"discount_total"`
+	PointsDiscount    money.Money `json:"points_discount" db:"points_discount"`
+	// TaxTotal is already part of Subtotal when PricesIncludeTax is set
+	TaxTotal         money.Money `json:"tax_total" db:"tax_total"`
+	PricesIncludeTax bool        `json:"prices_include_tax" db:"prices_include_tax"`
+	Total            money.Money `json:"total" db:"total"`
+	IssuedAt         time.Time   `json:"issued_at" db:"issued_at"`
+}
+
+// InvoiceNumber is the number printed on the invoice, e.g. INV-000042
+func (i Invoice) InvoiceNumber() string {
+	return fmt.Sprintf("INV-%06d", i.Number)
+}
+
+// InvoiceWithItems is everything printed on an invoice
+type InvoiceWithItems struct {
+	Invoice
+	InvoiceNumber string                `json:"invoice_number"`
+	Items         []OrderItem           `json:"items"`
+	Discounts     []PromotionRedemption `json:"discounts"`
+	Taxes         []TaxAmount           `json:"taxes"`
+	// RefundedTotal is what has been refunded since the invoice was issued
+	RefundedTotal money.Money `json:"refunded_total"`
+}
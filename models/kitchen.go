@@ -0,0 +1,47 @@
+package models
+
+import (
+	"new_restaurant/events"
+)
+
+// kitchen feed message types sent to the kitchen screen
+const (
+	// KitchenSnapshot lists the orders the kitchen is working on when it connects
+	KitchenSnapshot = "snapshot"
+	// KitchenEvent is an event of one of the restaurant's orders
+	KitchenEvent = "event"
+	// KitchenResult answers a KitchenCommand
+	KitchenResult = "result"
+)
+
+// KitchenActions maps the commands a kitchen can send to the status they move an order to
+var KitchenActions = map[string]OrderStatus{
+	"accept": OrderAccepted,
+	"reject": OrderRejected,
+	"ready":  OrderReady,
+	// serve hands a ready dine-in order to its table
+	"serve": OrderDelivered,
+}
+
+// KitchenCommand is sent by the kitchen screen to act on an order. Ref is
+// echoed back in the result so the screen can match them up.
+type KitchenCommand struct {
+	Ref     string `json:"ref,omitempty"`
+	OrderID string `json:"order_id"`
+	Action  string `json:"action"`
+}
+
+// KitchenMessage is anything sent to the kitchen screen; which fields are
+// set depends on Type
+type KitchenMessage struct {
+	Type string `json:"type"`
+	// LastEventID is where to resume from after a snapshot
+	LastEventID int64            `json:"last_event_id,omitempty"`
+	Orders      []OrderWithItems `json:"orders,omitempty"`
+	Event       *events.Event    `json:"event,omitempty"`
+	// Order is the order as it is after a status event
+	Order *OrderWithItems `json:"order,omitempty"`
+	Ref   string          `json:"ref,omitempty"`
+	OK    bool            `json:"ok,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"new_restaurant/money"
+	"time"
+)
+
+// LoyaltySettings is how customers earn and redeem points at a restaurant
+type LoyaltySettings struct {
+	RestaurantID uuid.UUID `json:"restaurant_id" db:"restaurant_id"`
+	// EarnRate is the points earned per currency unit spent on delivered orders
+	EarnRate decimal.Decimal `json:"earn_rate" db:"earn_rate"`
+	// PointValue is what a point takes off an order; nil disables redemption
+	PointValue *money.Money `json:"point_value,omitempty" db:"point_value"`
+	// ExpiryDays is how long points last after they are earned; nil is forever
+	ExpiryDays *int       `json:"expiry_days,omitempty" db:"expiry_days"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// PointsFor is what spending amount earns, rounded down to whole points
+func (s LoyaltySettings) PointsFor(spent money.Money) int {
+	if !spent.IsPositive() {
+		return 0
+	}
+	return int(spent.Decimal().Mul(s.EarnRate).Floor().IntPart())
+}
+
+// ClawbackFor is how many of the earned points an order loses when refunded
+// is refunded after it earned them. An order never loses more than it
+// earned, counting what earlier refunds already took back.
+func (s LoyaltySettings) ClawbackFor(refunded money.Money, earned, clawedBack int) int {
+	return max(min(s.PointsFor(refunded), earned-clawedBack), 0)
+}
+
+// ExpiresAt is when points earned at now expire, or nil if they never do
+func (s LoyaltySettings) ExpiresAt(now time.Time) *time.Time {
+	if s.ExpiryDays == nil {
+		return nil
+	}
+	expiresAt := now.AddDate(0, 0, *s.ExpiryDays)
+	return &expiresAt
+}
+
+type UpdateLoyaltySettingsRequest struct {
+	EarnRate   decimal.Decimal `json:"earn_rate"`
+	PointValue *money.Money    `json:"point_value,omitempty"`
+	ExpiryDays *int            `json:"expiry_days,omitempty"`
+}
+
+type LoyaltyEntryKind string
+
+const (
+	LoyaltyEarn    LoyaltyEntryKind = "earn"
+	LoyaltyRedeem  LoyaltyEntryKind = "redeem"
+	LoyaltyExpire  LoyaltyEntryKind = "expire"
+	LoyaltyRestore LoyaltyEntryKind = "restore"
+	// LoyaltyClawback takes back points earned by an order refunded after
+	// delivery; it can leave the balance negative if they were already spent
+	LoyaltyClawback LoyaltyEntryKind = "clawback"
+)
+
+// LoyaltyEntry is one change to a customer's points at a restaurant.
+// Redemptions, expiry and clawbacks are negative.
+type LoyaltyEntry struct {
+	ID           uuid.UUID        `json:"id" db:"id"`
+	RestaurantID uuid.UUID        `json:"restaurant_id" db:"restaurant_id"`
+	OrderID      *uuid.UUID       `json:"order_id,omitempty" db:"order_id"`
+	Kind         LoyaltyEntryKind `json:"kind" db:"kind"`
+	Points       int              `json:"points" db:"points"`
+	ExpiresAt    *time.Time       `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt    time.Time        `json:"created_at" db:"created_at"`
+}
+
+// LoyaltyBalance is a customer's points at one restaurant
+type LoyaltyBalance struct {
+	RestaurantID   uuid.UUID `json:"restaurant_id" db:"restaurant_id"`
+	RestaurantName string    `json:"restaurant_name" db:"restaurant_name"`
+	Points         int       `json:"points" db:"points"`
+	// NextExpiry is when the next of the points expire
+	NextExpiry *time.Time `json:"next_expiry,omitempty" db:"next_expiry"`
+}
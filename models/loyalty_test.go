@@ -0,0 +1,37 @@
+package models
+
+import (
+	"github.com/shopspring/decimal"
+	"new_restaurant/money"
+	"testing"
+)
+
+func TestClawbackFor(t *testing.T) {
+	// one point per currency unit, so an order of 100.00 INR earns 100 points
+	settings := LoyaltySettings{EarnRate: decimal.NewFromInt(1)}
+
+	tests := []struct {
+		name       string
+		refunded   int64
+		earned     int
+		clawedBack int
+		want       int
+	}{
+		{"full refund after delivery takes every point", 10000, 100, 0, 100},
+		{"partial refund after delivery takes its share", 2550, 100, 0, 25},
+		{"second refund takes what is left", 7450, 100, 25, 74},
+		{"never more than the order earned", 10000, 100, 90, 10},
+		{"nothing left to take", 5000, 100, 100, 0},
+		{"less than a point", 99, 100, 0, 0},
+		{"order earned nothing", 10000, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := settings.ClawbackFor(money.New(tt.refunded, "INR"), tt.earned, tt.clawedBack)
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"new_restaurant/money"
+	"time"
+)
+
+// ErrInvalidTransition is returned when an order cannot move to the requested status
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+type OrderStatus string
+
+const (
+	OrderPendingPayment OrderStatus = "pending_payment"
+	OrderScheduled      OrderStatus = "scheduled"
+	OrderPlaced         OrderStatus = "placed"
+	OrderAccepted       OrderStatus = "accepted"
+	OrderRejected       OrderStatus = "rejected"
+	OrderPreparing      OrderStatus = "preparing"
+	OrderReady          OrderStatus = "ready"
+	OrderOutForDelivery OrderStatus = "out_for_delivery"
+	OrderDelivered      OrderStatus = "delivered"
+	OrderCancelled      OrderStatus = "cancelled"
+)
+
+// orderTransitions is the order state machine: the statuses reachable from each status
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPendingPayment: {OrderPlaced, OrderScheduled, OrderCancelled},
+	OrderScheduled:      {OrderPlaced, OrderCancelled},
+	OrderPlaced:         {OrderAccepted, OrderRejected, OrderCancelled},
+	OrderAccepted:       {OrderPreparing, OrderReady, OrderCancelled},
+	OrderPreparing:      {OrderReady, OrderCancelled},
+	OrderReady:          {OrderOutForDelivery, OrderDelivered},
+	OrderOutForDelivery: {OrderDelivered},
+}
+
+// CanTransitionTo reports whether the state machine allows moving from s to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type Order struct {
+	ID            uuid.UUID   `json:"id" db:"id"`
+	UserID        *uuid.UUID  `json:"user_id,omitempty" db:"user_id"`
+	RestaurantID  uuid.UUID   `json:"restaurant_id" db:"restaurant_id"`
+	UserAddressID *uuid.UUID  `json:"user_address_id,omitempty" db:"user_address_id"`
+	Status        OrderStatus `json:"status" db:"status"`
+	CourierID     *uuid.UUID  `json:"courier_id,omitempty" db:"courier_id"`
+	// TabID and TableName are set on dine-in orders, which guests place from
+	// their table without a UserID
+	TabID     *uuid.UUID `json:"tab_id,omitempty" db:"tab_id"`
+	TableName *string    `json:"table_name,omitempty" db:"table_name"`
+	// ScheduledFor is the start of the delivery slot of a pre-order
+	ScheduledFor  *time.Time  `json:"scheduled_for,omitempty" db:"scheduled_for"`
+	Subtotal      money.Money `json:"subtotal" db:"subtotal"`
+	DeliveryFee   money.Money `json:"delivery_fee" db:"delivery_fee"`
+	PackagingFee  money.Money `json:"packaging_fee" db:"packaging_fee"`
+	ServiceCharge money.Money `json:"service_charge" db:"service_charge"`
+	DiscountTotal money.Money `json:"discount_total" db:"discount_total"`
+	// PointsDiscount is the part of DiscountTotal paid with PointsRedeemed
+	// loyalty points
+	PointsRedeemed int         `json:"points_redeemed" db:"points_redeemed"`
+	PointsDiscount money.Money `json:"points_discount" db:"points_discount"`
+	// TaxTotal is already part of Subtotal when PricesIncludeTax is set
+	TaxTotal         money.Money `json:"tax_total" db:"tax_total"`
+	PricesIncludeTax bool        `json:"prices_include_tax" db:"prices_include_tax"`
+	Total            money.Money `json:"total" db:"total"`
+	RefundedTotal    money.Money `json:"refunded_total" db:"refunded_total"`
+	CreatedAt        *time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        *time.Time  `json:"updated_at" db:"updated_at"`
+	ArchivedAt       *time.Time  `json:"archived_at,omitempty" db:"archived_at"`
+}
+
+// PlacedBy reports whether the user is the customer who placed the order
+func (o Order) PlacedBy(userID uuid.UUID) bool {
+	return o.UserID != nil && *o.UserID == userID
+}
+
+type OrderItem struct {
+	ID        uuid.UUID   `json:"id" db:"id"`
+	OrderID   uuid.UUID   `json:"order_id" db:"order_id"`
+	DishID    uuid.UUID   `json:"dish_id" db:"dish_id"`
+	Name      string      `json:"name" db:"name"`
+	Category  *string     `json:"category,omitempty" db:"category"`
+	UnitPrice money.Money `json:"unit_price" db:"unit_price"`
+	Quantity  int         `json:"quantity" db:"quantity"`
+	// DiscountAmount is this line's share of the order's item discounts
+	DiscountAmount money.Money `json:"discount_amount" db:"discount_amount"`
+	TaxAmount      money.Money `json:"tax_amount" db:"tax_amount"`
+	// LineTotal is what the customer paid for the line, taxes included
+	LineTotal money.Money `json:"line_total" db:"line_total"`
+	// RefundedQuantity units of this line have been refunded and no longer count towards the total
+	RefundedQuantity int            `json:"refunded_quantity" db:"refunded_quantity"`
+	CreatedAt        *time.Time     `json:"created_at" db:"created_at"`
+	Taxes            []OrderItemTax `json:"taxes" db:"-"`
+}
+
+// OrderWithItems combines Order with its items, the promotions applied to it
+// and its taxes summed per tax rate
+type OrderWithItems struct {
+	Order     Order                 `json:"order"`
+	Items     []OrderItem           `json:"items"`
+	Discounts []PromotionRedemption `json:"discounts"`
+	Taxes     []TaxAmount           `json:"taxes"`
+}
+
+// OrderItemRequest is one line of a new order
+type OrderItemRequest struct {
+	DishID   string `json:"dish_id" validate:"required,uuid"`
+	Quantity int    `json:"quantity" validate:"required,min=1"`
+}
+
+// CreateOrderRequest for API requests
+type CreateOrderRequest struct {
+	RestaurantID  string             `json:"restaurant_id" validate:"required,uuid"`
+	UserAddressID string             `json:"user_address_id" validate:"required,uuid"`
+	Items         []OrderItemRequest `json:"items" validate:"required,min=1,dive"`
+	PromoCode     string             `json:"promo_code,omitempty"`
+	// RedeemPoints loyalty points are taken off the order, as many as fit
+	RedeemPoints int `json:"redeem_points,omitempty"`
+	// ScheduledFor orders for a future slot instead of as soon as possible
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+}
+
+// ReorderRequest places a past order again. The address defaults to the past
+// order's and the order is for as soon as possible unless ScheduledFor is set.
+type ReorderRequest struct {
+	UserAddressID string     `json:"user_address_id,omitempty" validate:"omitempty,uuid"`
+	PromoCode     string     `json:"promo_code,omitempty"`
+	RedeemPoints  int        `json:"redeem_points,omitempty"`
+	ScheduledFor  *time.Time `json:"scheduled_for,omitempty"`
+}
+
+type ReorderChangeKind string
+
+const (
+	// ReorderUnavailable dishes are off the menu and were left out
+	ReorderUnavailable ReorderChangeKind = "unavailable"
+	// ReorderPriceChanged dishes were ordered again at their current price
+	ReorderPriceChanged ReorderChangeKind = "price_changed"
+)
+
+// ReorderChange is how a dish of the past order differs from the menu now
+type ReorderChange struct {
+	DishID   uuid.UUID         `json:"dish_id"`
+	Name     string            `json:"name"`
+	Kind     ReorderChangeKind `json:"kind"`
+	Quantity int               `json:"quantity"`
+	OldPrice money.Money       `json:"old_price"`
+	NewPrice *money.Money      `json:"new_price,omitempty"`
+}
+
+// ReorderResult is the new order and what changed since the past one
+type ReorderResult struct {
+	OrderWithItems
+	Changes []ReorderChange `json:"changes"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentFailed     PaymentStatus = "failed"
+	PaymentCancelled  PaymentStatus = "cancelled"
+)
+
+// Payment pays either an order or, for dine-in tabs, one share of the bill
+type Payment struct {
+	ID             uuid.UUID     `json:"id" db:"id"`
+	OrderID        *uuid.UUID    `json:"order_id,omitempty" db:"order_id"`
+	BillShareID    *uuid.UUID    `json:"bill_share_id,omitempty" db:"bill_share_id"`
+	Provider       string        `json:"provider" db:"provider"`
+	ProviderRef    *string       `json:"provider_ref,omitempty" db:"provider_ref"`
+	Amount         int64         `json:"amount" db:"amount"` // minor units
+	Currency       string        `json:"currency" db:"currency"`
+	Status         PaymentStatus `json:"status" db:"status"`
+	IdempotencyKey string        `json:"-" db:"idempotency_key"`
+	FailureReason  *string       `json:"failure_reason,omitempty" db:"failure_reason"`
+	CreatedAt      *time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt      *time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// paymentStatusRank orders payment statuses so webhooks arriving out of order
+// never move a payment backwards
+var paymentStatusRank = map[PaymentStatus]int{
+	PaymentPending:    0,
+	PaymentAuthorized: 1,
+	PaymentCaptured:   2,
+	PaymentFailed:     2,
+	PaymentCancelled:  2,
+}
+
+// CanAdvanceTo reports whether a payment in status s may move to next
+func (s PaymentStatus) CanAdvanceTo(next PaymentStatus) bool {
+	return paymentStatusRank[next] > paymentStatusRank[s]
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"new_restaurant/money"
+	"time"
+)
+
+type PromotionType string
+
+const (
+	PromotionPercentage   PromotionType = "percentage"
+	PromotionFlat         PromotionType = "flat"
+	PromotionFreeDelivery PromotionType = "free_delivery"
+	PromotionBOGO         PromotionType = "bogo"
+)
+
+// IsValid reports whether t is one of the values of the promotion_type enum
+func (t PromotionType) IsValid() bool {
+	switch t {
+	case PromotionPercentage, PromotionFlat, PromotionFreeDelivery, PromotionBOGO:
+		return true
+	}
+	return false
+}
+
+// Promotion is a discount rule. Promotions without a Code are applied
+// automatically; the others only when the customer enters the code.
+type Promotion struct {
+	ID            uuid.UUID        `json:"id" db:"id"`
+	Code          *string          `json:"code,omitempty" db:"code"`
+	Name          string           `json:"name" db:"name"`
+	Type          PromotionType    `json:"type" db:"type"`
+	PercentOff    *decimal.Decimal `json:"percent_off,omitempty" db:"percent_off"`
+	AmountOff     *money.Money     `json:"amount_off,omitempty" db:"amount_off"`
+	MaxDiscount   *money.Money     `json:"max_discount,omitempty" db:"max_discount"`
+	RestaurantID  *uuid.UUID       `json:"restaurant_id,omitempty" db:"restaurant_id"`
+	MinOrderValue *money.Money     `json:"min_order_value,omitempty" db:"min_order_value"`
+	StartsAt      time.Time        `json:"starts_at" db:"starts_at"`
+	EndsAt        *time.Time       `json:"ends_at,omitempty" db:"ends_at"`
+	UsageLimit    *int             `json:"usage_limit,omitempty" db:"usage_limit"`
+	PerUserLimit  *int             `json:"per_user_limit,omitempty" db:"per_user_limit"`
+	// TimesUsed and UserTimesUsed count redemptions on orders that were not cancelled
+	TimesUsed     int         `json:"times_used" db:"times_used"`
+	UserTimesUsed int         `json:"-" db:"user_times_used"`
+	DishIDs       []uuid.UUID `json:"dish_ids,omitempty" db:"-"`
+	CreatedBy     uuid.UUID   `json:"created_by" db:"created_by"`
+	CreatedAt     *time.Time  `json:"created_at" db:"created_at"`
+	ArchivedAt    *time.Time  `json:"archived_at,omitempty" db:"archived_at"`
+}
+
+// PromotionRedemption records one promotion applied to an order
+type PromotionRedemption struct {
+	ID          uuid.UUID   `json:"id" db:"id"`
+	PromotionID uuid.UUID   `json:"promotion_id" db:"promotion_id"`
+	UserID      uuid.UUID   `json:"user_id" db:"user_id"`
+	OrderID     uuid.UUID   `json:"order_id" db:"order_id"`
+	Name        string      `json:"name" db:"name"`
+	Amount      money.Money `json:"amount" db:"amount"`
+	CreatedAt   *time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreatePromotionRequest for API requests
+type CreatePromotionRequest struct {
+	Code          *string          `json:"code,omitempty"`
+	Name          string           `json:"name" validate:"required"`
+	Type          PromotionType    `json:"type" validate:"required"`
+	PercentOff    *decimal.Decimal `json:"percent_off,omitempty"`
+	AmountOff     *money.Money     `json:"amount_off,omitempty"`
+	MaxDiscount   *money.Money     `json:"max_discount,omitempty"`
+	RestaurantID  *string          `json:"restaurant_id,omitempty" validate:"omitempty,uuid"`
+	MinOrderValue *money.Money     `json:"min_order_value,omitempty"`
+	StartsAt      *time.Time       `json:"starts_at,omitempty"`
+	EndsAt        *time.Time       `json:"ends_at,omitempty"`
+	UsageLimit    *int             `json:"usage_limit,omitempty" validate:"omitempty,min=1"`
+	PerUserLimit  *int             `json:"per_user_limit,omitempty" validate:"omitempty,min=1"`
+	DishIDs       []string         `json:"dish_ids,omitempty" validate:"omitempty,dive,uuid"`
+}
+
+// PriceCartRequest asks for a priced cart without placing the order
+type PriceCartRequest struct {
+	RestaurantID string             `json:"restaurant_id" validate:"required,uuid"`
+	Items        []OrderItemRequest `json:"items" validate:"required,min=1,dive"`
+	PromoCode    string             `json:"promo_code,omitempty"`
+	RedeemPoints int                `json:"redeem_points,omitempty"`
+}
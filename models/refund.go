@@ -0,0 +1,60 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+)
+
+// Refund is an entry of the refund ledger
+type Refund struct {
+	ID             uuid.UUID    `json:"id" db:"id"`
+	OrderID        uuid.UUID    `json:"order_id" db:"order_id"`
+	PaymentID      uuid.UUID    `json:"payment_id" db:"payment_id"`
+	Amount         int64        `json:"amount" db:"amount"` // minor units
+	Currency       string       `json:"currency" db:"currency"`
+	Reason         *string      `json:"reason,omitempty" db:"reason"`
+	Status         RefundStatus `json:"status" db:"status"`
+	ProviderRef    *string      `json:"provider_ref,omitempty" db:"provider_ref"`
+	IdempotencyKey string       `json:"-" db:"idempotency_key"`
+	CreatedBy      uuid.UUID    `json:"created_by" db:"created_by"`
+	CreatedAt      *time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt      *time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+type RefundItem struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	RefundID    uuid.UUID `json:"refund_id" db:"refund_id"`
+	OrderItemID uuid.UUID `json:"order_item_id" db:"order_item_id"`
+	Quantity    int       `json:"quantity" db:"quantity"`
+	// FirstUnit is the first of the line's units this item refunds; it
+	// covers units [FirstUnit, FirstUnit+Quantity)
+	FirstUnit int   `json:"first_unit" db:"first_unit"`
+	Amount    int64 `json:"amount" db:"amount"` // minor units
+}
+
+// RefundWithItems combines Refund with the order lines it cancelled
+type RefundWithItems struct {
+	Refund Refund       `json:"refund"`
+	Items  []RefundItem `json:"items"`
+}
+
+// RefundItemRequest cancels quantity units of one order line
+type RefundItemRequest struct {
+	OrderItemID string `json:"order_item_id" validate:"required,uuid"`
+	Quantity    int    `json:"quantity" validate:"required,min=1"`
+}
+
+// CreateRefundRequest refunds either the listed items or, with full set, everything not yet refunded
+type CreateRefundRequest struct {
+	Full   bool                `json:"full,omitempty"`
+	Items  []RefundItemRequest `json:"items,omitempty" validate:"omitempty,dive"`
+	Reason *string             `json:"reason,omitempty"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ErrInvalidReservationTransition is returned when a reservation cannot move to the requested status
+var ErrInvalidReservationTransition = errors.New("invalid reservation status transition")
+
+// DiningTable is a table guests can reserve, wait for or order from
+type DiningTable struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	RestaurantID uuid.UUID `json:"restaurant_id" db:"restaurant_id"`
+	Name         string    `json:"name" db:"name"`
+	Capacity     int       `json:"capacity" db:"capacity"`
+	// QRVersion is bumped to revoke the table's printed QR codes, which
+	// encode QRToken
+	QRVersion  int        `json:"qr_version" db:"qr_version"`
+	QRToken    string     `json:"-" db:"qr_token"`
+	CreatedAt  *time.Time `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+}
+
+type ReservationStatus string
+
+const (
+	ReservationBooked    ReservationStatus = "booked"
+	ReservationSeated    ReservationStatus = "seated"
+	ReservationCompleted ReservationStatus = "completed"
+	ReservationCancelled ReservationStatus = "cancelled"
+	ReservationNoShow    ReservationStatus = "no_show"
+)
+
+// reservationTransitions is the reservation state machine: the statuses reachable from each status
+var reservationTransitions = map[ReservationStatus][]ReservationStatus{
+	ReservationBooked: {ReservationSeated, ReservationCancelled, ReservationNoShow},
+	ReservationSeated: {ReservationCompleted},
+}
+
+// CanTransitionTo reports whether the state machine allows moving from s to next
+func (s ReservationStatus) CanTransitionTo(next ReservationStatus) bool {
+	for _, allowed := range reservationTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Reservation holds a table for a party from StartsAt to EndsAt. Only booked
+// and seated reservations hold their table.
+type Reservation struct {
+	ID           uuid.UUID         `json:"id" db:"id"`
+	RestaurantID uuid.UUID         `json:"restaurant_id" db:"restaurant_id"`
+	TableID      uuid.UUID         `json:"table_id" db:"table_id"`
+	TableName    string            `json:"table_name" db:"table_name"`
+	UserID       uuid.UUID         `json:"user_id" db:"user_id"`
+	PartySize    int               `json:"party_size" db:"party_size"`
+	StartsAt     time.Time         `json:"starts_at" db:"starts_at"`
+	EndsAt       time.Time         `json:"ends_at" db:"ends_at"`
+	Status       ReservationStatus `json:"status" db:"status"`
+	Notes        *string           `json:"notes,omitempty" db:"notes"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt    *time.Time        `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+type CreateTableRequest struct {
+	Name     string `json:"name" validate:"required"`
+	Capacity int    `json:"capacity" validate:"required,min=1"`
+}
+
+type UpdateTableRequest struct {
+	Name     *string `json:"name,omitempty"`
+	Capacity *int    `json:"capacity,omitempty"`
+}
+
+type CreateReservationRequest struct {
+	PartySize int       `json:"party_size" validate:"required,min=1"`
+	StartsAt  time.Time `json:"starts_at" validate:"required"`
+	Notes     *string   `json:"notes,omitempty"`
+}
+
+// TableAvailability is a slot with tables free for the searched party size
+type TableAvailability struct {
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	FreeTables int       `json:"free_tables"`
+}
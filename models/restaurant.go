@@ -3,30 +3,38 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"new_restaurant/money"
 	"time"
 )
 
 type Restaurant struct {
-	ID         uuid.UUID  `json:"id" db:"id"`
-	Name       string     `json:"name" db:"name"`
-	Address    string     `json:"address" db:"address"`
-	Latitude   *float64   `json:"latitude,omitempty" db:"latitude"`
-	Longitude  *float64   `json:"longitude,omitempty" db:"longitude"`
-	CreatedBy  uuid.UUID  `json:"created_by" db:"created_by"`
-	Rating     float64    `json:"rating" db:"rating"`
-	CreatedAt  *time.Time `json:"created_at" db:"created_at"`
-	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	ID        uuid.UUID `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Address   string    `json:"address" db:"address"`
+	Latitude  *float64  `json:"latitude,omitempty" db:"latitude"`
+	Longitude *float64  `json:"longitude,omitempty" db:"longitude"`
+	Geohash   *string   `json:"geohash,omitempty" db:"geohash"`
+	CreatedBy uuid.UUID `json:"created_by" db:"created_by"`
+	Rating    float64   `json:"rating" db:"rating"`
+	// Currency is the ISO 4217 code every price at the restaurant is in
+	Currency string `json:"currency" db:"currency"`
+	// DeliveryFee is charged on every delivery order unless a promotion waives it
+	DeliveryFee money.Money `json:"delivery_fee" db:"delivery_fee"`
+	CreatedAt   *time.Time  `json:"created_at" db:"created_at"`
+	ArchivedAt  *time.Time  `json:"archived_at,omitempty" db:"archived_at"`
 }
 
 type Dish struct {
-	ID           uuid.UUID  `json:"id" db:"id"`
-	RestaurantID uuid.UUID  `json:"restaurant_id" db:"restaurant_id"`
-	Name         string     `json:"name" db:"name"`
-	Description  *string    `json:"description,omitempty" db:"description"`
-	Price        *float64   `json:"price,omitempty" db:"price"`
-	CreatedBy    uuid.UUID  `json:"created_by" db:"created_by"`
-	CreatedAt    *time.Time `json:"created_at" db:"created_at"`
-	ArchivedAt   *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	ID           uuid.UUID    `json:"id" db:"id"`
+	RestaurantID uuid.UUID    `json:"restaurant_id" db:"restaurant_id"`
+	Name         string       `json:"name" db:"name"`
+	Description  *string      `json:"description,omitempty" db:"description"`
+	Price        *money.Money `json:"price,omitempty" db:"price"`
+	// Category selects the tax rates that apply to the dish
+	Category   *string    `json:"category,omitempty" db:"category"`
+	CreatedBy  uuid.UUID  `json:"created_by" db:"created_by"`
+	CreatedAt  *time.Time `json:"created_at" db:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
 }
 
 // RestaurantWithDishes combines Restaurant with its dishes
@@ -35,37 +43,49 @@ type RestaurantWithDishes struct {
 	Dishes     []Dish     `json:"dishes"`
 }
 
-// CreateRestaurantRequest for API requests
+// CreateRestaurantRequest for API requests; coordinates are geocoded from the address when omitted
 type CreateRestaurantRequest struct {
 	Name      string   `json:"name" validate:"required"`
 	Address   string   `json:"address" validate:"required"`
 	Latitude  *float64 `json:"latitude,omitempty"`
 	Longitude *float64 `json:"longitude,omitempty"`
 	Rating    float64  `json:"rating" validate:"required,min=0,max=5"`
+	// Currency defaults to DEFAULT_CURRENCY and cannot be changed later
+	Currency    string       `json:"currency,omitempty"`
+	DeliveryFee *money.Money `json:"delivery_fee,omitempty"`
 }
 
 // UpdateRestaurantRequest for API requests
-type RestaurantResponse struct {
-	Name      *string  `json:"name,omitempty"`
-	Address   *string  `json:"address,omitempty"`
-	Latitude  *float64 `json:"latitude,omitempty"`
-	Longitude *float64 `json:"longitude,omitempty"`
-	Rating    *float64 `json:"rating,omitempty" validate:"omitempty,min=0,max=5"`
+type UpdateRestaurantRequest struct {
+	Name        *string      `json:"name,omitempty"`
+	Address     *string      `json:"address,omitempty"`
+	Latitude    *float64     `json:"latitude,omitempty"`
+	Longitude   *float64     `json:"longitude,omitempty"`
+	Rating      *float64     `json:"rating,omitempty" validate:"omitempty,min=0,max=5"`
+	DeliveryFee *money.Money `json:"delivery_fee,omitempty"`
 }
 
 // CreateDishRequest for API requests
 type CreateDishRequest struct {
-	RestaurantID string   `json:"restaurant_id" validate:"required,uuid"`
-	Name         string   `json:"name" validate:"required"`
-	Description  *string  `json:"description,omitempty"`
-	Price        *float64 `json:"price,omitempty" validate:"omitempty,min=0"`
+	RestaurantID string       `json:"restaurant_id" validate:"required,uuid"`
+	Name         string       `json:"name" validate:"required"`
+	Description  *string      `json:"description,omitempty"`
+	Price        *money.Money `json:"price,omitempty"`
+	Category     *string      `json:"category,omitempty"`
 }
 
 // UpdateDishRequest for API requests
 type UpdateDishRequest struct {
-	Name        *string  `json:"name,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	Price       *float64 `json:"price,omitempty" validate:"omitempty,min=0"`
+	Name        *string      `json:"name,omitempty"`
+	Description *string      `json:"description,omitempty"`
+	Price       *money.Money `json:"price,omitempty"`
+	Category    *string      `json:"category,omitempty"`
+}
+
+// NearbyRestaurant is a search result with its straight-line distance from the search point
+type NearbyRestaurant struct {
+	Restaurant
+	DistanceKm float64 `json:"distance_km"`
 }
 
 // RestaurantSearchRequest for search functionality
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// ScheduleSettings is how a restaurant takes orders for later
+type ScheduleSettings struct {
+	RestaurantID uuid.UUID `json:"restaurant_id" db:"restaurant_id"`
+	// Timezone is the IANA zone the opening hours are in
+	Timezone    string `json:"timezone" db:"timezone"`
+	SlotMinutes int    `json:"slot_minutes" db:"slot_minutes"`
+	// SlotCapacity is the most orders per slot; nil is unlimited
+	SlotCapacity *int `json:"slot_capacity,omitempty" db:"slot_capacity"`
+	// PrepLeadMinutes is how long before its slot an order goes to the kitchen
+	PrepLeadMinutes int `json:"prep_lead_minutes" db:"prep_lead_minutes"`
+	MaxDaysAhead    int `json:"max_days_ahead" db:"max_days_ahead"`
+	// ReservationMinutes is how long a table reservation holds the table
+	ReservationMinutes int        `json:"reservation_minutes" db:"reservation_minutes"`
+	UpdatedAt          *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// OpeningHours is one span a restaurant is open on a weekday, as HH:MM
+// times in its timezone. Weekday 0 is Sunday.
+type OpeningHours struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	RestaurantID uuid.UUID `json:"-" db:"restaurant_id"`
+	Weekday      int       `json:"weekday" db:"weekday"`
+	OpensAt      string    `json:"opens_at" db:"opens_at"`
+	ClosesAt     string    `json:"closes_at" db:"closes_at"`
+}
+
+// RestaurantSchedule is a restaurant's complete pre-order configuration. A
+// restaurant without opening hours does not take scheduled orders.
+type RestaurantSchedule struct {
+	ScheduleSettings
+	Hours []OpeningHours `json:"hours"`
+}
+
+// OpeningHoursRequest is one span of an UpdateScheduleRequest
+type OpeningHoursRequest struct {
+	Weekday  int    `json:"weekday" validate:"min=0,max=6"`
+	OpensAt  string `json:"opens_at" validate:"required"`
+	ClosesAt string `json:"closes_at" validate:"required"`
+}
+
+// UpdateScheduleRequest replaces a restaurant's schedule
+type UpdateScheduleRequest struct {
+	Timezone        string `json:"timezone" validate:"required"`
+	SlotMinutes     int    `json:"slot_minutes" validate:"required"`
+	SlotCapacity    *int   `json:"slot_capacity,omitempty"`
+	PrepLeadMinutes int    `json:"prep_lead_minutes"`
+	MaxDaysAhead    int    `json:"max_days_ahead" validate:"required"`
+	// ReservationMinutes defaults to 90 when left out
+	ReservationMinutes int                   `json:"reservation_minutes,omitempty"`
+	Hours              []OpeningHoursRequest `json:"hours" validate:"dive"`
+}
+
+// Slot is a delivery window that can be ordered for
+type Slot struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// Remaining is how many more orders the slot takes; nil is unlimited
+	Remaining *int `json:"remaining,omitempty"`
+}
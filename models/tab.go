@@ -0,0 +1,106 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"new_restaurant/money"
+	"time"
+)
+
+type TabStatus string
+
+const (
+	TabOpen   TabStatus = "open"
+	TabClosed TabStatus = "closed"
+)
+
+// TableTab is the running bill of a table. Guests who scan the table's code
+// while it is open all order onto it; staff close it once it is settled.
+type TableTab struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	RestaurantID uuid.UUID  `json:"restaurant_id" db:"restaurant_id"`
+	TableID      uuid.UUID  `json:"table_id" db:"table_id"`
+	TableName    string     `json:"table_name" db:"table_name"`
+	Status       TabStatus  `json:"status" db:"status"`
+	OpenedAt     time.Time  `json:"opened_at" db:"opened_at"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty" db:"closed_at"`
+	ClosedBy     *uuid.UUID `json:"closed_by,omitempty" db:"closed_by"`
+}
+
+// TabWithOrders is a tab with its orders and how its bill is split. Total
+// leaves out rejected and cancelled orders and anything refunded; Outstanding
+// is what remains after the paid shares.
+type TabWithOrders struct {
+	TableTab
+	Orders      []OrderWithItems `json:"orders"`
+	Shares      []BillShare      `json:"shares"`
+	Total       money.Money      `json:"total"`
+	Paid        money.Money      `json:"paid"`
+	Outstanding money.Money      `json:"outstanding"`
+}
+
+type SplitMethod string
+
+const (
+	SplitByItem  SplitMethod = "items"
+	SplitEqually SplitMethod = "equal"
+	SplitCustom  SplitMethod = "custom"
+)
+
+// BillShare is one part of a tab's bill, paid by a single payment
+type BillShare struct {
+	ID     uuid.UUID   `json:"id" db:"id"`
+	TabID  uuid.UUID   `json:"tab_id" db:"tab_id"`
+	Method SplitMethod `json:"method" db:"method"`
+	Amount money.Money `json:"amount" db:"amount"`
+	// PaidAt is set once a payment for the share is captured
+	PaidAt    *time.Time      `json:"paid_at,omitempty" db:"paid_at"`
+	VoidedAt  *time.Time      `json:"-" db:"voided_at"`
+	CreatedAt *time.Time      `json:"created_at" db:"created_at"`
+	Items     []BillShareItem `json:"items,omitempty" db:"-"`
+}
+
+// BillShareItem is the units of an order item a share split by item pays for
+type BillShareItem struct {
+	ShareID     uuid.UUID   `json:"-" db:"share_id"`
+	OrderItemID uuid.UUID   `json:"order_item_id" db:"order_item_id"`
+	Quantity    int         `json:"quantity" db:"quantity"`
+	Amount      money.Money `json:"amount" db:"amount"`
+}
+
+type StartDineInRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// DineInSession is returned to a guest who scanned a table's code; Token
+// authorizes their dine-in requests
+type DineInSession struct {
+	Token          string    `json:"token"`
+	RestaurantID   uuid.UUID `json:"restaurant_id"`
+	RestaurantName string    `json:"restaurant_name"`
+	TableName      string    `json:"table_name"`
+	TabID          uuid.UUID `json:"tab_id"`
+}
+
+// CreateDineInOrderRequest orders dishes to the guest's table
+type CreateDineInOrderRequest struct {
+	Items []OrderItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+// SplitTabRequest splits what is left of a tab's bill into shares: Parts
+// equal shares, one share per entry of Amounts, or one share per entry of
+// Shares paying for the listed items
+type SplitTabRequest struct {
+	Method  SplitMethod        `json:"method" validate:"required,oneof=items equal custom"`
+	Parts   int                `json:"parts,omitempty"`
+	Amounts []money.Money      `json:"amounts,omitempty"`
+	Shares  []ItemShareRequest `json:"shares,omitempty"`
+}
+
+type ItemShareRequest struct {
+	Items []ShareItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+type ShareItemRequest struct {
+	OrderItemID string `json:"order_item_id" validate:"required,uuid"`
+	Quantity    int    `json:"quantity" validate:"required,min=1"`
+}
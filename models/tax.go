@@ -0,0 +1,68 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"new_restaurant/money"
+	"time"
+)
+
+// TaxSettings are the restaurant-wide parts of its tax rules
+type TaxSettings struct {
+	RestaurantID uuid.UUID `json:"restaurant_id" db:"restaurant_id"`
+	// PricesIncludeTax means menu prices already contain tax, which is then
+	// carved out of each line instead of added on top
+	PricesIncludeTax bool `json:"prices_include_tax" db:"prices_include_tax"`
+	// ServiceChargeRate is a percentage of the discounted, pre-tax item total
+	ServiceChargeRate decimal.Decimal `json:"service_charge_rate" db:"service_charge_rate"`
+	PackagingFee      money.Money     `json:"packaging_fee" db:"packaging_fee"`
+	UpdatedAt         *time.Time      `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// TaxRate is one tax charged on dishes of a category. Rates without a
+// category apply to every dish whose category has no rates of its own.
+type TaxRate struct {
+	ID           uuid.UUID       `json:"id" db:"id"`
+	RestaurantID uuid.UUID       `json:"restaurant_id" db:"restaurant_id"`
+	Category     *string         `json:"category,omitempty" db:"category"`
+	Name         string          `json:"name" db:"name"`
+	Rate         decimal.Decimal `json:"rate" db:"rate"`
+	CreatedAt    *time.Time      `json:"created_at,omitempty" db:"created_at"`
+}
+
+// TaxRules is a restaurant's complete tax configuration
+type TaxRules struct {
+	TaxSettings
+	Rates []TaxRate `json:"rates"`
+}
+
+// TaxRateRequest is one rate of an UpdateTaxRulesRequest
+type TaxRateRequest struct {
+	Category *string         `json:"category,omitempty"`
+	Name     string          `json:"name" validate:"required"`
+	Rate     decimal.Decimal `json:"rate" validate:"required"`
+}
+
+// UpdateTaxRulesRequest replaces a restaurant's tax rules
+type UpdateTaxRulesRequest struct {
+	PricesIncludeTax  bool             `json:"prices_include_tax"`
+	ServiceChargeRate decimal.Decimal  `json:"service_charge_rate"`
+	PackagingFee      money.Money      `json:"packaging_fee"`
+	Rates             []TaxRateRequest `json:"rates" validate:"dive"`
+}
+
+// TaxAmount is the tax charged at one rate
+type TaxAmount struct {
+	Name   string          `json:"name" db:"name"`
+	Rate   decimal.Decimal `json:"rate" db:"rate"`
+	Amount money.Money     `json:"amount" db:"amount"`
+}
+
+// OrderItemTax is a TaxAmount stored against an order line. Refunded is the
+// part of it given back with refunded units of the line.
+type OrderItemTax struct {
+	ID          uuid.UUID   `json:"-" db:"id"`
+	OrderItemID uuid.UUID   `json:"-" db:"order_item_id"`
+	Refunded    money.Money `json:"refunded" db:"refunded"`
+	TaxAmount
+}
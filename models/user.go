@@ -12,8 +12,18 @@ const (
 	RoleAdmin    RoleType = "admin"
 	RoleSubAdmin RoleType = "sub_admin"
 	RoleUser     RoleType = "user"
+	RoleCourier  RoleType = "courier"
 )
 
+// IsValid reports whether r is one of the values of the role_type enum
+func (r RoleType) IsValid() bool {
+	switch r {
+	case RoleAdmin, RoleSubAdmin, RoleUser, RoleCourier:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID         uuid.UUID  `json:"id" db:"id"`
 	Name       string     `json:"name" db:"name"`
@@ -31,14 +41,33 @@ type UserRole struct {
 	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
 }
 
+type AddressLabel string
+
+const (
+	AddressLabelHome  AddressLabel = "home"
+	AddressLabelWork  AddressLabel = "work"
+	AddressLabelOther AddressLabel = "other"
+)
+
+// IsValid reports whether l is one of the values of the address_label enum
+func (l AddressLabel) IsValid() bool {
+	switch l {
+	case AddressLabelHome, AddressLabelWork, AddressLabelOther:
+		return true
+	}
+	return false
+}
+
 type UserAddress struct {
-	ID         uuid.UUID  `json:"id" db:"id"`
-	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
-	Address    string     `json:"address" db:"address"`
-	Latitude   *float64   `json:"latitude,omitempty" db:"latitude"`
-	Longitude  *float64   `json:"longitude,omitempty" db:"longitude"`
-	CreatedAt  *time.Time `json:"created_at" db:"created_at"`
-	ArchivedAt *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	ID         uuid.UUID    `json:"id" db:"id"`
+	UserID     uuid.UUID    `json:"user_id" db:"user_id"`
+	Address    string       `json:"address" db:"address"`
+	Latitude   *float64     `json:"latitude,omitempty" db:"latitude"`
+	Longitude  *float64     `json:"longitude,omitempty" db:"longitude"`
+	Label      AddressLabel `json:"label" db:"label"`
+	IsDefault  bool         `json:"is_default" db:"is_default"`
+	CreatedAt  *time.Time   `json:"created_at" db:"created_at"`
+	ArchivedAt *time.Time   `json:"archived_at,omitempty" db:"archived_at"`
 }
 
 // CreateUserRequest for API requests
@@ -49,18 +78,49 @@ type UserRequest struct {
 	Roles    []RoleType `json:"roles" validate:"required,min=1,dive,required"`
 }
 
+// UpdateUserRequest for admins editing an account; omitted fields are unchanged
+type UpdateUserRequest struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty" validate:"omitempty,email"`
+}
+
+// UserRoleRequest grants a role to a user
+type UserRoleRequest struct {
+	Role RoleType `json:"role" validate:"required"`
+}
+
+// UserDetailResponse is an account together with its active roles and full role history
+type UserDetailResponse struct {
+	User        User       `json:"user"`
+	Roles       []RoleType `json:"roles"`
+	RoleHistory []UserRole `json:"role_history"`
+}
+
 // LoginRequest for authentication
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
+// LoginTokens is the pair of tokens handed out after a successful login
+type LoginTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
 type Session struct {
-	ID           uuid.UUID  `db:"id"`
-	UserID       uuid.UUID  `db:"user_id"`
-	RefreshToken string     `db:"refresh_token"`
-	CreatedAt    *time.Time `db:"created_at"`
-	ArchivedAt   *time.Time `db:"archived_at"`
+	ID           uuid.UUID  `json:"id" db:"id"`
+	UserID       uuid.UUID  `json:"-" db:"user_id"`
+	RefreshToken string     `json:"-" db:"refresh_token"`
+	CreatedAt    *time.Time `json:"created_at" db:"created_at"`
+	ArchivedAt   *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+}
+
+// MeResponse is the logged-in user's own profile
+type MeResponse struct {
+	User      User          `json:"user"`
+	Roles     []RoleType    `json:"roles"`
+	Addresses []UserAddress `json:"addresses"`
 }
 
 type UserResponse struct {
@@ -70,11 +130,23 @@ type UserResponse struct {
 	RoleTypes string    `db:"role_type" json:"role_type"` // array
 }
 
+// UserAddressRequest creates an address; coordinates are geocoded from the address when omitted
 type UserAddressRequest struct {
-	Name      string   `json:"name" validate:"required"`
-	Address   string   `json:"address" validate:"required,email"`
-	Latitude  *float64 `json:"latitude" validate:"required,min=0"`
-	Longitude *float64 `json:"longitude" validate:"required,min=0"`
+	Name      string       `json:"name"`
+	Address   string       `json:"address" validate:"required"`
+	Latitude  *float64     `json:"latitude" validate:"omitempty,min=-90,max=90"`
+	Longitude *float64     `json:"longitude" validate:"omitempty,min=-180,max=180"`
+	Label     AddressLabel `json:"label,omitempty"`
+	IsDefault bool         `json:"is_default"`
+}
+
+// UpdateUserAddressRequest edits an address; omitted fields are unchanged
+type UpdateUserAddressRequest struct {
+	Address   *string       `json:"address,omitempty"`
+	Latitude  *float64      `json:"latitude,omitempty" validate:"omitempty,min=-90,max=90"`
+	Longitude *float64      `json:"longitude,omitempty" validate:"omitempty,min=-180,max=180"`
+	Label     *AddressLabel `json:"label,omitempty"`
+	IsDefault *bool         `json:"is_default,omitempty"`
 }
 
 type DistanceRequest struct {
@@ -82,8 +154,38 @@ type DistanceRequest struct {
 	RestaurantID  string `json:"restaurant_id"`
 }
 
+// DistanceMatrixRequest asks for distances from one address to many restaurants,
+// either the listed ones or every restaurant within radius_km when nearby is set
+type DistanceMatrixRequest struct {
+	UserAddressID string   `json:"user_address_id" validate:"required,uuid"`
+	RestaurantIDs []string `json:"restaurant_ids,omitempty" validate:"omitempty,max=100,dive,uuid"`
+	Nearby        bool     `json:"nearby,omitempty"`
+	RadiusKm      *float64 `json:"radius_km,omitempty"`
+}
+
+// RestaurantDistance is one entry of the distance matrix. Unlike
+// DistanceResponse it is the straight-line distance, not the road distance,
+// so the matrix stays a single query.
+type RestaurantDistance struct {
+	RestaurantID   uuid.UUID `json:"restaurant_id" db:"restaurant_id"`
+	Name           string    `json:"name" db:"name"`
+	StraightLineKm float64   `json:"straight_line_km" db:"straight_line_km"`
+}
+
+// DistanceMatrixResponse lists distances nearest first; requested restaurants
+// that are unknown or lack coordinates are reported as unresolved
+type DistanceMatrixResponse struct {
+	UserAddressID string               `json:"user_address_id"`
+	Distances     []RestaurantDistance `json:"distances"`
+	Unresolved    []string             `json:"unresolved,omitempty"`
+}
+
 // represents the distance calculation response
 type DistanceResponse struct {
-	Distance float64 `json:"distance_km"`
-	Message  string  `json:"message"`
+	Distance             float64   `json:"distance_km"` // road distance
+	StraightLineDistance float64   `json:"straight_line_km"`
+	DurationMinutes      float64   `json:"duration_minutes"`
+	ETA                  time.Time `json:"eta"`
+	Estimated            bool      `json:"estimated"`
+	Message              string    `json:"message"`
 }
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ErrInvalidWaitlistTransition is returned when a waitlist entry cannot move to the requested status
+var ErrInvalidWaitlistTransition = errors.New("invalid waitlist status transition")
+
+// TableSession is a party sitting at a table, from a reservation or the
+// waitlist. The table is occupied until ClearedAt is set.
+type TableSession struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	RestaurantID  uuid.UUID  `json:"restaurant_id" db:"restaurant_id"`
+	TableID       uuid.UUID  `json:"table_id" db:"table_id"`
+	PartySize     int        `json:"party_size" db:"party_size"`
+	ReservationID *uuid.UUID `json:"reservation_id,omitempty" db:"reservation_id"`
+	SeatedAt      time.Time  `json:"seated_at" db:"seated_at"`
+	ClearedAt     *time.Time `json:"cleared_at,omitempty" db:"cleared_at"`
+}
+
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting  WaitlistStatus = "waiting"
+	WaitlistNotified WaitlistStatus = "notified"
+	WaitlistSeated   WaitlistStatus = "seated"
+	WaitlistRemoved  WaitlistStatus = "removed"
+)
+
+// waitlistTransitions is the waitlist state machine: the statuses reachable from each status
+var waitlistTransitions = map[WaitlistStatus][]WaitlistStatus{
+	WaitlistWaiting:  {WaitlistNotified, WaitlistSeated, WaitlistRemoved},
+	WaitlistNotified: {WaitlistSeated, WaitlistRemoved},
+}
+
+// CanTransitionTo reports whether the state machine allows moving from s to next
+func (s WaitlistStatus) CanTransitionTo(next WaitlistStatus) bool {
+	for _, allowed := range waitlistTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the party is still waiting for a table
+func (s WaitlistStatus) IsActive() bool {
+	return s == WaitlistWaiting || s == WaitlistNotified
+}
+
+// WaitlistEntry is a walk-in party waiting for a table. Token is handed to
+// the guest to check their place without logging in.
+type WaitlistEntry struct {
+	ID             uuid.UUID      `json:"id" db:"id"`
+	RestaurantID   uuid.UUID      `json:"restaurant_id" db:"restaurant_id"`
+	PartyName      string         `json:"party_name" db:"party_name"`
+	PartySize      int            `json:"party_size" db:"party_size"`
+	Phone          *string        `json:"phone,omitempty" db:"phone"`
+	Notes          *string        `json:"notes,omitempty" db:"notes"`
+	Status         WaitlistStatus `json:"status" db:"status"`
+	Token          string         `json:"token" db:"token"`
+	TableSessionID *uuid.UUID     `json:"table_session_id,omitempty" db:"table_session_id"`
+	CreatedBy      uuid.UUID      `json:"created_by" db:"created_by"`
+	CreatedAt      *time.Time     `json:"created_at,omitempty" db:"created_at"`
+	NotifiedAt     *time.Time     `json:"notified_at,omitempty" db:"notified_at"`
+	UpdatedAt      *time.Time     `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// WaitlistEntryWithEstimate is an active entry with its place in the queue.
+// EstimatedWaitMinutes is nil when no table seats the party.
+type WaitlistEntryWithEstimate struct {
+	WaitlistEntry
+	Position             int  `json:"position"`
+	EstimatedWaitMinutes *int `json:"estimated_wait_minutes"`
+}
+
+// WaitlistGuestStatus is what a guest sees about their own entry
+type WaitlistGuestStatus struct {
+	RestaurantName       string         `json:"restaurant_name"`
+	PartyName            string         `json:"party_name"`
+	PartySize            int            `json:"party_size"`
+	Status               WaitlistStatus `json:"status"`
+	Position             int            `json:"position,omitempty"`
+	EstimatedWaitMinutes *int           `json:"estimated_wait_minutes,omitempty"`
+}
+
+type CreateWaitlistEntryRequest struct {
+	PartyName string  `json:"party_name" validate:"required"`
+	PartySize int     `json:"party_size" validate:"required,min=1"`
+	Phone     *string `json:"phone,omitempty"`
+	Notes     *string `json:"notes,omitempty"`
+}
+
+type SeatWaitlistEntryRequest struct {
+	TableID uuid.UUID `json:"table_id" validate:"required"`
+}
@@ -0,0 +1,305 @@
+// Package money represents amounts as integer minor units of an ISO 4217
+// currency, so arithmetic on prices is exact.
+//
+// Rounding rules: anything that produces a fraction of a minor unit (a
+// percentage, a ratio, a decimal conversion) rounds half away from zero to
+// the currency's minor unit. Splitting an amount with Allocate never creates
+// or loses a minor unit.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// exponents is the number of minor unit digits of each supported currency
+var exponents = map[string]int32{
+	"AED": 2, "AUD": 2, "BDT": 2, "BHD": 3, "CAD": 2, "CHF": 2, "CNY": 2, "EUR": 2,
+	"GBP": 2, "HKD": 2, "IDR": 2, "INR": 2, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3,
+	"LKR": 2, "MYR": 2, "NPR": 2, "NZD": 2, "OMR": 3, "PKR": 2, "QAR": 2, "SAR": 2,
+	"SGD": 2, "THB": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+// DefaultCurrency is given to restaurants created without a currency
+var DefaultCurrency = "INR"
+
+// CurrencyFromEnv reads DEFAULT_CURRENCY, falling back to INR
+func CurrencyFromEnv() (string, error) {
+	currency := strings.ToUpper(os.Getenv("DEFAULT_CURRENCY"))
+	if currency == "" {
+		return "INR", nil
+	}
+	if !ValidCurrency(currency) {
+		return "", fmt.Errorf("%w %q in DEFAULT_CURRENCY", ErrUnknownCurrency, currency)
+	}
+	return currency, nil
+}
+
+// ValidCurrency reports whether code is a supported ISO 4217 currency code
+func ValidCurrency(code string) bool {
+	_, ok := exponents[code]
+	return ok
+}
+
+// Exponent returns the number of minor unit digits of the currency
+func Exponent(code string) int32 {
+	if exp, ok := exponents[code]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Money is an amount in minor units of Currency, e.g. 1250 INR is ₹12.50
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns minor units of the currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Zero returns no money in the currency
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// FromDecimal converts an amount in major units, e.g. 12.5, rounding to the currency's minor unit
+func FromDecimal(amount decimal.Decimal, currency string) Money {
+	return Money{Amount: amount.Shift(Exponent(currency)).Round(0).IntPart(), Currency: currency}
+}
+
+// Decimal returns the amount in major units
+func (m Money) Decimal() decimal.Decimal {
+	return decimal.New(m.Amount, -Exponent(m.Currency))
+}
+
+func (m Money) String() string {
+	return m.Decimal().StringFixed(Exponent(m.Currency)) + " " + m.Currency
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// SameCurrency reports whether the two amounts can be combined. An amount
+// without a currency is only ever zero and combines with anything.
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency || m.Currency == "" || other.Currency == ""
+}
+
+// combine checks two amounts can be added and returns the currency of the result
+func (m Money) combine(other Money) string {
+	if !m.SameCurrency(other) {
+		panic(fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency))
+	}
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+// Add returns m + other. Amounts in different currencies are never added;
+// doing so is a programming error and panics.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.combine(other)}
+}
+
+// Sub returns m - other, panicking like Add on mismatched currencies
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.combine(other)}
+}
+
+// MulInt returns m * n
+func (m Money) MulInt(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+// MulRatio returns m * num / den, rounded half away from zero
+func (m Money) MulRatio(num, den decimal.Decimal) Money {
+	if den.IsZero() {
+		return Zero(m.Currency)
+	}
+	amount := decimal.NewFromInt(m.Amount).Mul(num).Div(den).Round(0)
+	return Money{Amount: amount.IntPart(), Currency: m.Currency}
+}
+
+var hundred = decimal.NewFromInt(100)
+
+// Percent returns rate percent of m, rounded half away from zero
+func (m Money) Percent(rate decimal.Decimal) Money {
+	return m.MulRatio(rate, hundred)
+}
+
+func (m Money) Cmp(other Money) int {
+	m.combine(other)
+	switch {
+	case m.Amount < other.Amount:
+		return -1
+	case m.Amount > other.Amount:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) LessThan(other Money) bool    { return m.Cmp(other) < 0 }
+func (m Money) GreaterThan(other Money) bool { return m.Cmp(other) > 0 }
+
+// Min returns the smaller amount
+func Min(a, b Money) Money {
+	if b.LessThan(a) {
+		return b
+	}
+	return a
+}
+
+// Max returns the larger amount
+func Max(a, b Money) Money {
+	if b.GreaterThan(a) {
+		return b
+	}
+	return a
+}
+
+// Allocate splits m in proportion to weights using the largest remainder
+// method, so the shares always add up to m exactly
+func Allocate(m Money, weights []Money) []Money {
+	if m.IsNegative() {
+		// split the magnitude so remainders are never negative
+		shares := Allocate(Money{Amount: -m.Amount, Currency: m.Currency}, weights)
+		for i := range shares {
+			shares[i].Amount = -shares[i].Amount
+		}
+		return shares
+	}
+
+	shares := make([]Money, len(weights))
+	var total int64
+	for i, weight := range weights {
+		shares[i] = Zero(m.Currency)
+		total += weight.Amount
+	}
+	if total <= 0 {
+		return shares
+	}
+
+	type remainder struct {
+		index int
+		value int64
+	}
+	remainders := make([]remainder, len(weights))
+	var allocated int64
+	for i, weight := range weights {
+		// the product fits in an int64 for any realistic order value
+		product := m.Amount * weight.Amount
+		shares[i].Amount = product / total
+		remainders[i] = remainder{index: i, value: product % total}
+		allocated += shares[i].Amount
+	}
+
+	sort.SliceStable(remainders, func(a, b int) bool { return remainders[a].value > remainders[b].value })
+	for i := 0; allocated < m.Amount; i++ {
+		shares[remainders[i%len(remainders)].index].Amount++
+		allocated++
+	}
+	return shares
+}
+
+// Equal splits m into parts that differ by at most one minor unit
+func Equal(m Money, parts int) []Money {
+	weights := make([]Money, parts)
+	for i := range weights {
+		weights[i] = New(1, m.Currency)
+	}
+	return Allocate(m, weights)
+}
+
+// UnitsCost is what units [from, from+quantity) of a line come to when its
+// units together cost cost. Every unit costs the same give or take a minor
+// unit, and paying for them one by one adds up to cost exactly.
+func UnitsCost(cost Money, units, from, quantity int) Money {
+	total := Zero(cost.Currency)
+	for _, share := range Equal(cost, units)[from : from+quantity] {
+		total = total.Add(share)
+	}
+	return total
+}
+
+// InCurrency gives an amount read without a currency the expected one and
+// rejects amounts in any other currency
+func (m *Money) InCurrency(currency string) error {
+	if m.Currency == "" {
+		m.Currency = currency
+	}
+	if m.Currency != currency {
+		return fmt.Errorf("%w: expected %s, got %s", ErrCurrencyMismatch, currency, m.Currency)
+	}
+	return nil
+}
+
+type moneyJSON struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// MarshalJSON writes {"amount": <minor units>, "currency": "<ISO code>"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`{"amount":` + strconv.FormatInt(m.Amount, 10) + `,"currency":"` + m.Currency + `"}`), nil
+}
+
+// UnmarshalJSON reads the MarshalJSON format. The currency may be omitted
+// when the surrounding request implies it; see InCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw moneyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	raw.Currency = strings.ToUpper(raw.Currency)
+	if raw.Currency != "" && !ValidCurrency(raw.Currency) {
+		return fmt.Errorf("%w %q", ErrUnknownCurrency, raw.Currency)
+	}
+	m.Amount, m.Currency = raw.Amount, raw.Currency
+	return nil
+}
+
+// Value stores the amount as the money_amount composite type, (amount,currency)
+func (m Money) Value() (driver.Value, error) {
+	return "(" + strconv.FormatInt(m.Amount, 10) + "," + m.Currency + ")", nil
+}
+
+// Scan reads a money_amount composite, which postgres sends as (1250,INR)
+func (m *Money) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("cannot scan %T into money.Money", src)
+	}
+
+	fields := strings.Split(strings.Trim(text, "()"), ",")
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid money_amount %q", text)
+	}
+	amount, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid money_amount %q: %w", text, err)
+	}
+	m.Amount, m.Currency = amount, strings.TrimSpace(strings.Trim(fields[1], `"`))
+	return nil
+}
@@ -0,0 +1,176 @@
+package money
+
+import (
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func amounts(currency string, values ...int64) []Money {
+	out := make([]Money, len(values))
+	for i, value := range values {
+		out[i] = New(value, currency)
+	}
+	return out
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even split", 900, []int64{1, 1, 1}, []int64{300, 300, 300}},
+		{"remainder goes to the first equal shares", 1000, []int64{1, 1, 1}, []int64{334, 333, 333}},
+		{"two minor units left over", 1001, []int64{1, 1, 1}, []int64{334, 334, 333}},
+		{"largest remainder wins", 100, []int64{1, 2}, []int64{33, 67}},
+		{"proportional", 1000, []int64{250, 750}, []int64{250, 750}},
+		{"zero weight gets nothing", 100, []int64{0, 3}, []int64{0, 100}},
+		{"less than one unit per share", 2, []int64{1, 1, 1}, []int64{1, 1, 0}},
+		{"negative amount", -1000, []int64{1, 1, 1}, []int64{-334, -333, -333}},
+		{"zero amount", 0, []int64{1, 2}, []int64{0, 0}},
+		{"no weight", 500, []int64{0, 0}, []int64{0, 0}},
+		{"no shares", 500, []int64{}, []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := Allocate(New(tt.amount, "INR"), amounts("INR", tt.weights...))
+			if len(shares) != len(tt.want) {
+				t.Fatalf("got %d shares, want %d", len(shares), len(tt.want))
+			}
+			for i, share := range shares {
+				if share.Amount != tt.want[i] || share.Currency != "INR" {
+					t.Errorf("share %d = %s, want %d INR", i, share, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAllocateAddsUp(t *testing.T) {
+	weights := amounts("INR", 333, 1, 47, 1000, 19)
+	for amount := int64(-500); amount <= 500; amount++ {
+		var sum int64
+		for _, share := range Allocate(New(amount, "INR"), weights) {
+			sum += share.Amount
+		}
+		if sum != amount {
+			t.Fatalf("shares of %d add up to %d", amount, sum)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		parts  int
+		want   []int64
+	}{
+		{"divides evenly", 900, 3, []int64{300, 300, 300}},
+		{"first parts take the remainder", 1000, 3, []int64{334, 333, 333}},
+		{"one part", 1000, 1, []int64{1000}},
+		{"fewer minor units than parts", 2, 4, []int64{1, 1, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := Equal(New(tt.amount, "INR"), tt.parts)
+			if len(parts) != len(tt.want) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(tt.want))
+			}
+			for i, part := range parts {
+				if part.Amount != tt.want[i] {
+					t.Errorf("part %d = %d, want %d", i, part.Amount, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUnitsCost(t *testing.T) {
+	tests := []struct {
+		name                  string
+		cost                  int64
+		units, from, quantity int
+		want                  int64
+	}{
+		{"all units", 1000, 3, 0, 3, 1000},
+		{"first unit takes a remainder", 1000, 3, 0, 1, 334},
+		{"last unit", 1000, 3, 2, 1, 333},
+		{"last two units", 1000, 3, 1, 2, 666},
+		{"no units", 1000, 3, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnitsCost(New(tt.cost, "INR"), tt.units, tt.from, tt.quantity)
+			if got.Amount != tt.want {
+				t.Errorf("got %d, want %d", got.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitsCostOneByOneAddsUp(t *testing.T) {
+	for _, cost := range []int64{0, 1, 99, 1000, 1001, 12345} {
+		for units := 1; units <= 7; units++ {
+			var sum int64
+			for from := 0; from < units; from++ {
+				sum += UnitsCost(New(cost, "INR"), units, from, 1).Amount
+			}
+			if sum != cost {
+				t.Errorf("%d units of %d add up to %d", units, cost, sum)
+			}
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{"exact", 1000, 1, 4, 250},
+		{"half rounds up", 5, 1, 2, 3},
+		{"half rounds away from zero", -5, 1, 2, -3},
+		{"below half rounds down", 10, 1, 3, 3},
+		{"above half rounds up", 20, 1, 3, 7},
+		{"zero denominator", 1000, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.amount, "INR").MulRatio(decimal.NewFromInt(tt.num), decimal.NewFromInt(tt.den))
+			if got.Amount != tt.want {
+				t.Errorf("got %d, want %d", got.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromDecimal(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     int64
+	}{
+		{"12.5", "INR", 1250},
+		{"12.345", "INR", 1235},
+		{"12.344", "INR", 1234},
+		{"1.2345", "KWD", 1235},
+		{"1500.5", "JPY", 1501},
+		{"-0.005", "USD", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.currency, func(t *testing.T) {
+			if got := FromDecimal(decimal.RequireFromString(tt.value), tt.currency); got.Amount != tt.want {
+				t.Errorf("got %d, want %d", got.Amount, tt.want)
+			}
+		})
+	}
+}
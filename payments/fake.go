@@ -0,0 +1,165 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"new_restaurant/utils"
+)
+
+// FakeSignatureHeader carries "t=<unix seconds>,v1=<hex hmac>" on fake webhooks
+const FakeSignatureHeader = "Fake-Signature"
+
+// webhookTolerance bounds how old a signed webhook may be, limiting replays
+const webhookTolerance = 5 * time.Minute
+
+type fakeIntent struct {
+	amount   int64
+	captured int64
+	refunded int64
+	status   Status
+}
+
+// FakeProvider is an in-process PaymentProvider for development and tests.
+// Every call succeeds synchronously unless the amount exceeds DeclineOver.
+type FakeProvider struct {
+	DeclineOver int64
+
+	secret  []byte
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+	results map[string]*Result // by idempotency key
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		secret:  []byte(webhookSecret),
+		intents: map[string]*fakeIntent{},
+		results: map[string]*Result{},
+	}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) Authorize(_ context.Context, req AuthorizeRequest) (*Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if result, ok := f.results[req.IdempotencyKey]; ok {
+		return result, nil
+	}
+
+	ref := "fake_pi_" + uuid.NewString()
+	result := &Result{ProviderRef: ref, Status: StatusAuthorized}
+	if f.DeclineOver > 0 && req.Amount > f.DeclineOver {
+		result.Status, result.FailureReason = StatusFailed, "card_declined"
+	}
+
+	f.intents[ref] = &fakeIntent{amount: req.Amount, status: result.Status}
+	f.results[req.IdempotencyKey] = result
+	return result, nil
+}
+
+func (f *FakeProvider) Capture(_ context.Context, providerRef string, amount int64, idempotencyKey string) (*Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if result, ok := f.results[idempotencyKey]; ok {
+		return result, nil
+	}
+
+	intent, ok := f.intents[providerRef]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment %q", providerRef)
+	}
+	if intent.status != StatusAuthorized || amount > intent.amount {
+		return nil, errors.New("payment cannot be captured")
+	}
+
+	intent.captured, intent.status = amount, StatusCaptured
+	result := &Result{ProviderRef: providerRef, Status: StatusCaptured}
+	f.results[idempotencyKey] = result
+	return result, nil
+}
+
+func (f *FakeProvider) Refund(_ context.Context, providerRef string, amount int64, idempotencyKey string) (*Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if result, ok := f.results[idempotencyKey]; ok {
+		return result, nil
+	}
+
+	intent, ok := f.intents[providerRef]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment %q", providerRef)
+	}
+	if intent.status != StatusCaptured || intent.refunded+amount > intent.captured {
+		return nil, errors.New("refund exceeds captured amount")
+	}
+
+	intent.refunded += amount
+	result := &Result{ProviderRef: "fake_re_" + uuid.NewString(), Status: StatusRefunded}
+	f.results[idempotencyKey] = result
+	return result, nil
+}
+
+// SignWebhook returns the signature header value for payload, so development
+// tooling can deliver fake webhooks to the server
+func (f *FakeProvider) SignWebhook(payload []byte, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + f.sign(timestamp, payload)
+}
+
+func (f *FakeProvider) sign(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *FakeProvider) VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error) {
+	var timestamp, signature string
+	for _, part := range strings.Split(header.Get(FakeSignatureHeader), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return nil, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(f.sign(timestamp, payload))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := utils.JSON.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if event.ID == "" || event.Type == "" || event.ProviderRef == "" {
+		return nil, errors.New("invalid webhook payload: id, type and provider_ref are required")
+	}
+	return &event, nil
+}
@@ -0,0 +1,95 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// ErrInvalidSignature is returned when a webhook cannot be authenticated
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Status is the state of a payment or refund at the provider
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusAuthorized Status = "authorized"
+	StatusCaptured   Status = "captured"
+	StatusFailed     Status = "failed"
+	StatusRefunded   Status = "refunded"
+)
+
+// Webhook event types understood by the webhook handler
+const (
+	EventPaymentAuthorized = "payment.authorized"
+	EventPaymentCaptured   = "payment.captured"
+	EventPaymentFailed     = "payment.failed"
+	EventRefundSucceeded   = "refund.succeeded"
+	EventRefundFailed      = "refund.failed"
+)
+
+// AuthorizeRequest reserves Amount (in minor units) for an order
+type AuthorizeRequest struct {
+	Amount         int64
+	Currency       string
+	Reference      string
+	IdempotencyKey string
+}
+
+// Result is the provider's answer to authorize, capture or refund. Providers
+// that settle asynchronously return StatusPending and confirm via webhook.
+type Result struct {
+	ProviderRef   string
+	Status        Status
+	FailureReason string
+}
+
+// WebhookEvent is a verified notification from the provider
+type WebhookEvent struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	ProviderRef   string `json:"provider_ref"`
+	Amount        int64  `json:"amount"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// PaymentProvider is implemented by every payment gateway
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	Capture(ctx context.Context, providerRef string, amount int64, idempotencyKey string) (*Result, error)
+	Refund(ctx context.Context, providerRef string, amount int64, idempotencyKey string) (*Result, error)
+	VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error)
+}
+
+// Default is the provider used by handlers
+var Default PaymentProvider
+
+// FromEnv builds the provider selected by PAYMENT_PROVIDER. Only the in-process
+// "fake" provider is built in; it signs webhooks with PAYMENT_WEBHOOK_SECRET and
+// declines authorizations above FAKE_PAYMENT_DECLINE_OVER minor units if set.
+func FromEnv() (PaymentProvider, error) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET is required")
+	}
+
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "", "fake":
+		fake := NewFakeProvider(secret)
+		if value := os.Getenv("FAKE_PAYMENT_DECLINE_OVER"); value != "" {
+			limit, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid FAKE_PAYMENT_DECLINE_OVER %q", value)
+			}
+			fake.DeclineOver = limit
+		}
+		return fake, nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", provider)
+	}
+}
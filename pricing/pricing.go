@@ -0,0 +1,146 @@
+// Package pricing turns a cart into the amounts a customer pays. Every amount
+// is money in the restaurant's currency and is rounded to its minor unit as
+// soon as it is produced, so the parts of a quote always add up to its total.
+package pricing
+
+import (
+	"github.com/google/uuid"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"time"
+)
+
+// Line is one dish in a cart
+type Line struct {
+	DishID    uuid.UUID   `json:"dish_id"`
+	Name      string      `json:"name"`
+	Category  *string     `json:"category,omitempty"`
+	UnitPrice money.Money `json:"unit_price"`
+	Quantity  int         `json:"quantity"`
+}
+
+// Gross is the undiscounted price of the line
+func (l Line) Gross() money.Money {
+	return l.UnitPrice.MulInt(l.Quantity)
+}
+
+// Cart is everything needed to price an order
+type Cart struct {
+	RestaurantID uuid.UUID
+	Currency     string
+	Lines        []Line
+	DeliveryFee  money.Money
+	Tax          models.TaxRules
+	// RedeemPoints loyalty points are taken off the items at PointValue
+	// each, as many as the items leave room for
+	RedeemPoints int
+	PointValue   money.Money
+}
+
+// Subtotal is the undiscounted price of every line
+func (c Cart) Subtotal() money.Money {
+	subtotal := money.Zero(c.Currency)
+	for _, line := range c.Lines {
+		subtotal = subtotal.Add(line.Gross())
+	}
+	return subtotal
+}
+
+// AppliedDiscount is one promotion's contribution to a quote
+type AppliedDiscount struct {
+	PromotionID uuid.UUID            `json:"promotion_id"`
+	Code        *string              `json:"code,omitempty"`
+	Name        string               `json:"name"`
+	Type        models.PromotionType `json:"type"`
+	Amount      money.Money          `json:"amount"`
+}
+
+// QuoteLine is a priced cart line
+type QuoteLine struct {
+	Line
+	// Discount is the line's share of the item discounts
+	Discount money.Money        `json:"discount"`
+	Taxes    []models.TaxAmount `json:"taxes"`
+	TaxTotal money.Money        `json:"tax_total"`
+	// Total is what the customer pays for the line, taxes included
+	Total money.Money `json:"total"`
+}
+
+// Quote is a priced cart. When PricesIncludeTax is set TaxTotal is already
+// part of Subtotal; otherwise it is added on top. PointsDiscount, taken off
+// for PointsRedeemed loyalty points, is part of DiscountTotal but not of
+// Discounts.
+type Quote struct {
+	Currency         string             `json:"currency"`
+	Lines            []QuoteLine        `json:"lines"`
+	Subtotal         money.Money        `json:"subtotal"`
+	DeliveryFee      money.Money        `json:"delivery_fee"`
+	PackagingFee     money.Money        `json:"packaging_fee"`
+	ServiceCharge    money.Money        `json:"service_charge"`
+	Discounts        []AppliedDiscount  `json:"discounts"`
+	PointsRedeemed   int                `json:"points_redeemed"`
+	PointsDiscount   money.Money        `json:"points_discount"`
+	DiscountTotal    money.Money        `json:"discount_total"`
+	PricesIncludeTax bool               `json:"prices_include_tax"`
+	Taxes            []models.TaxAmount `json:"taxes"`
+	TaxTotal         money.Money        `json:"tax_total"`
+	Total            money.Money        `json:"total"`
+	// PromoCodeError explains why an entered promo code was not applied
+	PromoCodeError string `json:"promo_code_error,omitempty"`
+}
+
+// Price applies every eligible promotion and the restaurant's taxes to the
+// cart. code is the promotion the customer entered, if any, and is reported in
+// PromoCodeError when it does not apply; automatic promotions that do not
+// apply are silently skipped.
+func Price(cart Cart, automatic []models.Promotion, code *models.Promotion, now time.Time) Quote {
+	zero := money.Zero(cart.Currency)
+	quote := Quote{
+		Currency:         cart.Currency,
+		Lines:            make([]QuoteLine, 0, len(cart.Lines)),
+		Subtotal:         cart.Subtotal(),
+		DeliveryFee:      zero.Add(cart.DeliveryFee),
+		PackagingFee:     zero.Add(cart.Tax.PackagingFee),
+		ServiceCharge:    zero,
+		Discounts:        make([]AppliedDiscount, 0),
+		PointsDiscount:   zero,
+		DiscountTotal:    zero,
+		PricesIncludeTax: cart.Tax.PricesIncludeTax,
+		TaxTotal:         zero,
+	}
+	for _, line := range cart.Lines {
+		quote.Lines = append(quote.Lines, QuoteLine{Line: line, Discount: zero, TaxTotal: zero})
+	}
+
+	promotions := automatic
+	if code != nil {
+		if err := CheckEligibility(*code, cart, now); err != nil {
+			quote.PromoCodeError = err.Error()
+		} else {
+			promotions = append(promotions[:len(promotions):len(promotions)], *code)
+		}
+	}
+
+	applyDiscounts(&quote, cart, promotions, now)
+	if code != nil && quote.PromoCodeError == "" && !quote.applied(code.ID) {
+		quote.PromoCodeError = ErrNothingToDiscount.Error()
+	}
+
+	applyTaxes(&quote, cart.Tax)
+
+	quote.Total = quote.Subtotal.Sub(quote.DiscountTotal).
+		Add(quote.DeliveryFee).Add(quote.PackagingFee).Add(quote.ServiceCharge)
+	if !quote.PricesIncludeTax {
+		quote.Total = quote.Total.Add(quote.TaxTotal)
+	}
+	return quote
+}
+
+func (q Quote) applied(promotionID uuid.UUID) bool {
+	for _, discount := range q.Discounts {
+		if discount.PromotionID == promotionID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package pricing
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"testing"
+	"time"
+)
+
+func inr(amount int64) money.Money {
+	return money.New(amount, "INR")
+}
+
+func rate(name, value string) models.TaxRate {
+	return models.TaxRate{Name: name, Rate: decimal.RequireFromString(value)}
+}
+
+func percentOff(value string) models.Promotion {
+	percent := decimal.RequireFromString(value)
+	return models.Promotion{ID: uuid.New(), Name: value + "% off", Type: models.PromotionPercentage, PercentOff: &percent}
+}
+
+func TestPriceRounding(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		prices       []int64
+		rules        models.TaxRules
+		promotions   []models.Promotion
+		wantDiscount int64
+		wantLineDisc []int64
+		wantTax      int64
+		wantService  int64
+		wantTotal    int64
+	}{
+		{
+			name:      "exclusive tax rounds half up",
+			prices:    []int64{333},
+			rules:     models.TaxRules{Rates: []models.TaxRate{rate("GST", "5")}},
+			wantTax:   17,
+			wantTotal: 350,
+		},
+		{
+			name:      "exclusive tax below half rounds down",
+			prices:    []int64{329},
+			rules:     models.TaxRules{Rates: []models.TaxRate{rate("GST", "5")}},
+			wantTax:   16,
+			wantTotal: 345,
+		},
+		{
+			name:   "inclusive tax is carved out of the price",
+			prices: []int64{100},
+			rules: models.TaxRules{
+				TaxSettings: models.TaxSettings{PricesIncludeTax: true},
+				Rates:       []models.TaxRate{rate("GST", "18")},
+			},
+			wantTax:   15,
+			wantTotal: 100,
+		},
+		{
+			name:   "each rate rounds on its own",
+			prices: []int64{1001},
+			rules: models.TaxRules{Rates: []models.TaxRate{
+				rate("CGST", "2.5"),
+				rate("SGST", "2.5"),
+			}},
+			wantTax:   50,
+			wantTotal: 1051,
+		},
+		{
+			name:   "service charge on the pre-tax total rounds half up",
+			prices: []int64{1005},
+			rules: models.TaxRules{
+				TaxSettings: models.TaxSettings{ServiceChargeRate: decimal.NewFromInt(10)},
+			},
+			wantService: 101,
+			wantTotal:   1106,
+		},
+		{
+			name:         "percentage discount is spread by largest remainder",
+			prices:       []int64{333, 667},
+			rules:        models.TaxRules{Rates: []models.TaxRate{rate("GST", "5")}},
+			promotions:   []models.Promotion{percentOff("10")},
+			wantDiscount: 100,
+			wantLineDisc: []int64{33, 67},
+			wantTax:      45,
+			wantTotal:    945,
+		},
+		{
+			name:         "fractional percentage rounds to the minor unit",
+			prices:       []int64{1001},
+			promotions:   []models.Promotion{percentOff("12.5")},
+			wantDiscount: 125,
+			wantLineDisc: []int64{125},
+			wantTotal:    876,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart := Cart{RestaurantID: uuid.New(), Currency: "INR", Tax: tt.rules}
+			cart.Tax.PackagingFee = inr(0)
+			for _, price := range tt.prices {
+				cart.Lines = append(cart.Lines, Line{DishID: uuid.New(), UnitPrice: inr(price), Quantity: 1})
+			}
+
+			quote := Price(cart, tt.promotions, nil, now)
+			if quote.DiscountTotal.Amount != tt.wantDiscount {
+				t.Errorf("discount = %d, want %d", quote.DiscountTotal.Amount, tt.wantDiscount)
+			}
+			if quote.TaxTotal.Amount != tt.wantTax {
+				t.Errorf("tax = %d, want %d", quote.TaxTotal.Amount, tt.wantTax)
+			}
+			if quote.ServiceCharge.Amount != tt.wantService {
+				t.Errorf("service charge = %d, want %d", quote.ServiceCharge.Amount, tt.wantService)
+			}
+			if quote.Total.Amount != tt.wantTotal {
+				t.Errorf("total = %d, want %d", quote.Total.Amount, tt.wantTotal)
+			}
+			for i, want := range tt.wantLineDisc {
+				if got := quote.Lines[i].Discount.Amount; got != want {
+					t.Errorf("line %d discount = %d, want %d", i, got, want)
+				}
+			}
+			checkAddsUp(t, quote)
+		})
+	}
+}
+
+// checkAddsUp verifies the parts of a quote add up to its totals
+func checkAddsUp(t *testing.T, quote Quote) {
+	t.Helper()
+
+	lineDiscounts, lineTaxes, lineTotals := inr(0), inr(0), inr(0)
+	for _, line := range quote.Lines {
+		lineDiscounts = lineDiscounts.Add(line.Discount)
+		lineTaxes = lineTaxes.Add(line.TaxTotal)
+		lineTotals = lineTotals.Add(line.Total)
+	}
+	breakdown := inr(0)
+	for _, tax := range quote.Taxes {
+		breakdown = breakdown.Add(tax.Amount)
+	}
+
+	if lineDiscounts != quote.DiscountTotal {
+		t.Errorf("line discounts add up to %s, want %s", lineDiscounts, quote.DiscountTotal)
+	}
+	if lineTaxes != quote.TaxTotal || breakdown != quote.TaxTotal {
+		t.Errorf("line taxes %s and breakdown %s, want %s", lineTaxes, breakdown, quote.TaxTotal)
+	}
+	fees := quote.DeliveryFee.Add(quote.PackagingFee).Add(quote.ServiceCharge)
+	if lineTotals.Add(fees) != quote.Total {
+		t.Errorf("line totals and fees add up to %s, want %s", lineTotals.Add(fees), quote.Total)
+	}
+}
@@ -0,0 +1,166 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"new_restaurant/models"
+	"new_restaurant/money"
+	"sort"
+	"time"
+)
+
+var (
+	ErrPromotionNotStarted      = errors.New("promotion has not started yet")
+	ErrPromotionExpired         = errors.New("promotion has expired")
+	ErrPromotionWrongRestaurant = errors.New("promotion is not valid at this restaurant")
+	ErrPromotionWrongCurrency   = errors.New("promotion is not valid in this currency")
+	ErrPromotionExhausted       = errors.New("promotion has reached its usage limit")
+	ErrPromotionUserLimit       = errors.New("you have already used this promotion the maximum number of times")
+	ErrBelowMinimumOrder        = errors.New("order is below the promotion's minimum value")
+	ErrNothingToDiscount        = errors.New("promotion does not apply to any item in the cart")
+)
+
+// applyOrder is the order discounts are taken in: item discounts first, so
+// percentage and flat discounts apply to what is left, then delivery
+var applyOrder = map[models.PromotionType]int{
+	models.PromotionBOGO:         0,
+	models.PromotionPercentage:   1,
+	models.PromotionFlat:         2,
+	models.PromotionFreeDelivery: 3,
+}
+
+// CheckEligibility reports why a promotion cannot be used on the cart, or nil
+// if it can. Usage counts must already be loaded into the promotion.
+func CheckEligibility(p models.Promotion, cart Cart, now time.Time) error {
+	switch {
+	case now.Before(p.StartsAt):
+		return ErrPromotionNotStarted
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return ErrPromotionExpired
+	case p.RestaurantID != nil && *p.RestaurantID != cart.RestaurantID:
+		return ErrPromotionWrongRestaurant
+	case !inCurrency(cart.Currency, p.AmountOff, p.MaxDiscount, p.MinOrderValue):
+		return ErrPromotionWrongCurrency
+	case p.UsageLimit != nil && p.TimesUsed >= *p.UsageLimit:
+		return ErrPromotionExhausted
+	case p.PerUserLimit != nil && p.UserTimesUsed >= *p.PerUserLimit:
+		return ErrPromotionUserLimit
+	case p.MinOrderValue != nil && cart.Subtotal().LessThan(*p.MinOrderValue):
+		return fmt.Errorf("%w of %s", ErrBelowMinimumOrder, p.MinOrderValue)
+	}
+	return nil
+}
+
+// inCurrency reports whether every amount that is set is in the currency
+func inCurrency(currency string, amounts ...*money.Money) bool {
+	for _, amount := range amounts {
+		if amount != nil && amount.Currency != currency {
+			return false
+		}
+	}
+	return true
+}
+
+// applyDiscounts adds every eligible promotion to the quote, then the loyalty
+// points redeemed, and spreads item discounts over the lines they came from.
+// Item discounts never exceed the subtotal and delivery discounts never
+// exceed the fee.
+func applyDiscounts(quote *Quote, cart Cart, promotions []models.Promotion, now time.Time) {
+	sorted := append([]models.Promotion(nil), promotions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return applyOrder[sorted[i].Type] < applyOrder[sorted[j].Type]
+	})
+
+	lineLeft := make([]money.Money, len(cart.Lines))
+	for i, line := range cart.Lines {
+		lineLeft[i] = line.Gross()
+	}
+	itemsLeft, deliveryLeft := quote.Subtotal, quote.DeliveryFee
+
+	for _, p := range sorted {
+		if CheckEligibility(p, cart, now) != nil {
+			continue
+		}
+
+		// weights decides which lines an item discount comes off
+		amount, weights := money.Zero(cart.Currency), lineLeft
+		switch p.Type {
+		case models.PromotionBOGO:
+			weights = bogoDiscounts(cart.Lines, lineLeft, p.DishIDs)
+			for _, weight := range weights {
+				amount = amount.Add(weight)
+			}
+		case models.PromotionPercentage:
+			if p.PercentOff != nil {
+				amount = itemsLeft.Percent(*p.PercentOff)
+			}
+		case models.PromotionFlat:
+			if p.AmountOff != nil {
+				amount = money.Min(*p.AmountOff, itemsLeft)
+			}
+		case models.PromotionFreeDelivery:
+			amount = deliveryLeft
+		}
+		if p.MaxDiscount != nil {
+			amount = money.Min(amount, *p.MaxDiscount)
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+
+		if p.Type == models.PromotionFreeDelivery {
+			deliveryLeft = deliveryLeft.Sub(amount)
+		} else {
+			itemsLeft = itemsLeft.Sub(amount)
+			for i, share := range money.Allocate(amount, weights) {
+				lineLeft[i] = lineLeft[i].Sub(share)
+				quote.Lines[i].Discount = quote.Lines[i].Discount.Add(share)
+			}
+		}
+		quote.DiscountTotal = quote.DiscountTotal.Add(amount)
+		quote.Discounts = append(quote.Discounts, AppliedDiscount{
+			PromotionID: p.ID,
+			Code:        p.Code,
+			Name:        p.Name,
+			Type:        p.Type,
+			Amount:      amount,
+		})
+	}
+
+	// points are worth whole point values, so only as many as fit are used
+	if cart.RedeemPoints > 0 && cart.PointValue.IsPositive() && cart.PointValue.SameCurrency(itemsLeft) {
+		points := int64(cart.RedeemPoints)
+		if fit := itemsLeft.Amount / cart.PointValue.Amount; fit < points {
+			points = fit
+		}
+		if points > 0 {
+			amount := money.New(points*cart.PointValue.Amount, cart.Currency)
+			for i, share := range money.Allocate(amount, lineLeft) {
+				quote.Lines[i].Discount = quote.Lines[i].Discount.Add(share)
+			}
+			quote.PointsRedeemed = int(points)
+			quote.PointsDiscount = amount
+			quote.DiscountTotal = quote.DiscountTotal.Add(amount)
+		}
+	}
+}
+
+// bogoDiscounts makes every second unit of the promoted dishes free and
+// returns the discount per line, never more than what is left of the line
+func bogoDiscounts(lines []Line, lineLeft []money.Money, dishIDs []uuid.UUID) []money.Money {
+	promoted := make(map[uuid.UUID]bool, len(dishIDs))
+	for _, id := range dishIDs {
+		promoted[id] = true
+	}
+
+	discounts := make([]money.Money, len(lines))
+	for i, line := range lines {
+		discounts[i] = money.Zero(lineLeft[i].Currency)
+		if promoted[line.DishID] {
+			free := line.UnitPrice.MulInt(line.Quantity / 2)
+			discounts[i] = money.Min(free, lineLeft[i])
+		}
+	}
+	return discounts
+}
@@ -0,0 +1,78 @@
+package pricing
+
+import (
+	"github.com/shopspring/decimal"
+	"new_restaurant/models"
+	"new_restaurant/money"
+)
+
+// ratesFor returns the rates charged on a dish category: the category's own
+// rates, or the uncategorised rates when it has none
+func ratesFor(rates []models.TaxRate, category *string) []models.TaxRate {
+	var own, fallback []models.TaxRate
+	for _, rate := range rates {
+		switch {
+		case rate.Category == nil:
+			fallback = append(fallback, rate)
+		case category != nil && *rate.Category == *category:
+			own = append(own, rate)
+		}
+	}
+	if len(own) > 0 {
+		return own
+	}
+	return fallback
+}
+
+// applyTaxes taxes each line on its discounted price, then adds the service
+// charge on the pre-tax item total. With inclusive pricing the tax is carved
+// out of the line price instead of being added to it.
+func applyTaxes(quote *Quote, rules models.TaxRules) {
+	quote.Taxes = make([]models.TaxAmount, 0)
+	totals := map[string]int{}
+
+	hundred := decimal.NewFromInt(100)
+	preTax := money.Zero(quote.Currency)
+	for i := range quote.Lines {
+		line := &quote.Lines[i]
+		net := line.Gross().Sub(line.Discount)
+		rates := ratesFor(rules.Rates, line.Category)
+
+		combined := decimal.Zero
+		for _, rate := range rates {
+			combined = combined.Add(rate.Rate)
+		}
+		divisor := hundred
+		if rules.PricesIncludeTax {
+			divisor = hundred.Add(combined)
+		}
+
+		line.Taxes = make([]models.TaxAmount, 0, len(rates))
+		line.TaxTotal = money.Zero(quote.Currency)
+		for _, rate := range rates {
+			amount := net.MulRatio(rate.Rate, divisor)
+			line.Taxes = append(line.Taxes, models.TaxAmount{Name: rate.Name, Rate: rate.Rate, Amount: amount})
+			line.TaxTotal = line.TaxTotal.Add(amount)
+
+			// the order level breakdown sums each distinct name and rate
+			key := rate.Name + "@" + rate.Rate.String()
+			if idx, seen := totals[key]; seen {
+				quote.Taxes[idx].Amount = quote.Taxes[idx].Amount.Add(amount)
+			} else {
+				totals[key] = len(quote.Taxes)
+				quote.Taxes = append(quote.Taxes, models.TaxAmount{Name: rate.Name, Rate: rate.Rate, Amount: amount})
+			}
+		}
+		quote.TaxTotal = quote.TaxTotal.Add(line.TaxTotal)
+
+		if rules.PricesIncludeTax {
+			line.Total = net
+			preTax = preTax.Add(net.Sub(line.TaxTotal))
+		} else {
+			line.Total = net.Add(line.TaxTotal)
+			preTax = preTax.Add(net)
+		}
+	}
+
+	quote.ServiceCharge = preTax.Percent(rules.ServiceChargeRate)
+}
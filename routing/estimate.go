@@ -0,0 +1,52 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"new_restaurant/utils"
+)
+
+// Profile describes how a vehicle type travels through a city
+type Profile struct {
+	Name string
+	// DetourFactor scales straight-line distance to approximate road distance
+	DetourFactor float64
+	// SpeedKmh is the average speed including stops
+	SpeedKmh float64
+	// OSRMProfile is the matching profile name on an OSRM server
+	OSRMProfile string
+}
+
+const DefaultProfile = "scooter"
+
+// Profiles are the built-in speed profiles
+var Profiles = map[string]Profile{
+	"car":     {Name: "car", DetourFactor: 1.4, SpeedKmh: 25, OSRMProfile: "driving"},
+	"scooter": {Name: "scooter", DetourFactor: 1.3, SpeedKmh: 22, OSRMProfile: "driving"},
+	"bicycle": {Name: "bicycle", DetourFactor: 1.25, SpeedKmh: 14, OSRMProfile: "cycling"},
+	"walking": {Name: "walking", DetourFactor: 1.2, SpeedKmh: 4.5, OSRMProfile: "walking"},
+}
+
+// EstimateRouter approximates road distance from the haversine distance and a
+// detour factor, and travel time from an average speed. It needs no network.
+type EstimateRouter struct {
+	profile Profile
+}
+
+func NewEstimateRouter(profile Profile) *EstimateRouter {
+	return &EstimateRouter{profile: profile}
+}
+
+func (e *EstimateRouter) Route(_ context.Context, from, to Point) (*Route, error) {
+	straight := utils.CalculateDistance(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+	distance := math.Round(straight*e.profile.DetourFactor*100) / 100
+	hours := distance / e.profile.SpeedKmh
+
+	return &Route{
+		DistanceKm: distance,
+		Duration:   time.Duration(hours * float64(time.Hour)).Round(time.Second),
+		Estimated:  true,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"new_restaurant/utils"
+)
+
+// OSRMRouter queries the route service of an OSRM-compatible server
+type OSRMRouter struct {
+	baseURL string
+	profile string
+	client  *http.Client
+}
+
+type osrmResponse struct {
+	Code   string `json:"code"`
+	Routes []struct {
+		Distance float64 `json:"distance"` // metres
+		Duration float64 `json:"duration"` // seconds
+	} `json:"routes"`
+}
+
+func NewOSRMRouter(baseURL, profile string) *OSRMRouter {
+	if profile == "" {
+		profile = "driving"
+	}
+	return &OSRMRouter{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		profile: profile,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (o *OSRMRouter) Route(ctx context.Context, from, to Point) (*Route, error) {
+	// OSRM takes coordinates as longitude,latitude
+	url := fmt.Sprintf("%s/route/v1/%s/%f,%f;%f,%f?overview=false",
+		o.baseURL, o.profile, from.Longitude, from.Latitude, to.Longitude, to.Latitude)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body osrmResponse
+	if err := utils.JSON.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode osrm response (%s): %w", resp.Status, err)
+	}
+
+	switch {
+	case body.Code == "NoRoute":
+		return nil, ErrNoRoute
+	case body.Code != "Ok" || len(body.Routes) == 0:
+		return nil, fmt.Errorf("osrm returned %q (%s)", body.Code, resp.Status)
+	}
+
+	return &Route{
+		DistanceKm: math.Round(body.Routes[0].Distance/10) / 100,
+		Duration:   time.Duration(body.Routes[0].Duration * float64(time.Second)).Round(time.Second),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrNoRoute is returned when two points are not connected by road
+var ErrNoRoute = errors.New("no route found")
+
+// Point is a WGS84 coordinate
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Route is the road distance and travel time between two points
+type Route struct {
+	DistanceKm float64
+	Duration   time.Duration
+	// Estimated is true when the route was approximated rather than computed on a road graph
+	Estimated bool
+}
+
+// Router computes road distance and travel time
+type Router interface {
+	Route(ctx context.Context, from, to Point) (*Route, error)
+}
+
+// Default is the router used by handlers
+var Default Router = NewEstimateRouter(Profiles[DefaultProfile])
+
+// FromEnv builds the router selected by ROUTER. "osrm" uses the OSRM server at
+// ROUTER_URL and falls back to the estimate when it is unavailable; anything
+// else uses the estimate only. ROUTING_PROFILE picks the speed profile, and
+// ROUTING_DETOUR_FACTOR / ROUTING_SPEED_KMH override its values.
+func FromEnv() (Router, error) {
+	profileName := os.Getenv("ROUTING_PROFILE")
+	if profileName == "" {
+		profileName = DefaultProfile
+	}
+	profile, ok := Profiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("unknown routing profile %q", profileName)
+	}
+
+	if value := os.Getenv("ROUTING_DETOUR_FACTOR"); value != "" {
+		factor, err := strconv.ParseFloat(value, 64)
+		if err != nil || factor < 1 {
+			return nil, fmt.Errorf("invalid ROUTING_DETOUR_FACTOR %q", value)
+		}
+		profile.DetourFactor = factor
+	}
+	if value := os.Getenv("ROUTING_SPEED_KMH"); value != "" {
+		speed, err := strconv.ParseFloat(value, 64)
+		if err != nil || speed <= 0 {
+			return nil, fmt.Errorf("invalid ROUTING_SPEED_KMH %q", value)
+		}
+		profile.SpeedKmh = speed
+	}
+	estimate := NewEstimateRouter(profile)
+
+	switch router := os.Getenv("ROUTER"); router {
+	case "", "estimate":
+		return estimate, nil
+	case "osrm":
+		baseURL := os.Getenv("ROUTER_URL")
+		if baseURL == "" {
+			return nil, errors.New("ROUTER_URL is required for the osrm router")
+		}
+		return WithFallback(NewOSRMRouter(baseURL, profile.OSRMProfile), estimate), nil
+	default:
+		return nil, fmt.Errorf("unknown router %q", router)
+	}
+}
+
+type fallbackRouter struct {
+	primary  Router
+	fallback Router
+}
+
+// WithFallback uses primary and switches to fallback when primary fails for
+// any reason other than the points being unreachable
+func WithFallback(primary, fallback Router) Router {
+	return &fallbackRouter{primary: primary, fallback: fallback}
+}
+
+func (f *fallbackRouter) Route(ctx context.Context, from, to Point) (*Route, error) {
+	route, err := f.primary.Route(ctx, from, to)
+	if err == nil || errors.Is(err, ErrNoRoute) {
+		return route, err
+	}
+	return f.fallback.Route(ctx, from, to)
+}
@@ -0,0 +1,58 @@
+package scheduling
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"time"
+)
+
+// UnpaidOrderTTL is how long an order may await payment before it is
+// cancelled, giving back the promotions and loyalty points it holds
+var UnpaidOrderTTL = 30 * time.Minute
+
+// errPaymentStarted means the customer started paying after the order was
+// picked for expiry
+var errPaymentStarted = errors.New("payment started")
+
+// ExpireUnpaid cancels every order that has awaited payment for longer than
+// UnpaidOrderTTL without a payment in flight
+func ExpireUnpaid(now time.Time) error {
+	orderIDs, err := dbHelper.ListUnpaidOrdersBefore(database.Rest, now.Add(-UnpaidOrderTTL))
+	if err != nil {
+		return err
+	}
+	for _, orderID := range orderIDs {
+		err := database.Tx(func(tx *sqlx.Tx) error {
+			return expireOrder(tx, orderID)
+		})
+		if err != nil && !errors.Is(err, errPaymentStarted) && !errors.Is(err, models.ErrInvalidTransition) {
+			logrus.Errorf("failed to expire unpaid order %s: %s", orderID, err)
+		}
+	}
+	return nil
+}
+
+// expireOrder cancels an unpaid order under its lock, so that a payment
+// created meanwhile keeps it
+func expireOrder(tx *sqlx.Tx, orderID uuid.UUID) error {
+	order, err := dbHelper.GetOrderForUpdate(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status != models.OrderPendingPayment {
+		return nil
+	}
+	live, err := dbHelper.HasLivePayment(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if live {
+		return errPaymentStarted
+	}
+	return dbHelper.TransitionOrderStatus(tx, orderID, models.OrderCancelled)
+}
@@ -0,0 +1,55 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"new_restaurant/database"
+	"new_restaurant/database/dbHelper"
+	"new_restaurant/models"
+	"time"
+)
+
+// ReleaseInterval is how often due pre-orders are released
+var ReleaseInterval = 15 * time.Second
+
+// ReleaseDue places every scheduled order whose prep lead time has come, so
+// it shows up in the kitchen like an order placed just now
+func ReleaseDue(now time.Time) error {
+	orderIDs, err := dbHelper.ListOrdersDueForRelease(database.Rest, now)
+	if err != nil {
+		return err
+	}
+	for _, orderID := range orderIDs {
+		// the transition locks the order and is a no-op if another instance
+		// released it first; a cancelled order is simply skipped
+		err := database.Tx(func(tx *sqlx.Tx) error {
+			return dbHelper.TransitionOrderStatus(tx, orderID, models.OrderPlaced)
+		})
+		if err != nil && !errors.Is(err, models.ErrInvalidTransition) {
+			logrus.Errorf("failed to release scheduled order %s: %s", orderID, err)
+		}
+	}
+	return nil
+}
+
+// Run releases due orders and expires unpaid ones every ReleaseInterval
+// until the context is done
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(ReleaseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := ReleaseDue(now); err != nil {
+				logrus.Errorf("scheduled order release failed: %s", err)
+			}
+			if err := ExpireUnpaid(now); err != nil {
+				logrus.Errorf("unpaid order expiry failed: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package scheduling decides when pre-orders can be delivered and tables
+// reserved, releases pre-orders to the kitchen in time to be prepared and
+// cancels orders left unpaid. Slots are cut from each opening span of the restaurant's week, in its own
+// timezone.
+package scheduling
+
+import (
+	"errors"
+	"fmt"
+	"new_restaurant/models"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNotScheduling = errors.New("restaurant does not take scheduled orders")
+	ErrTooSoon       = errors.New("slot is too soon to prepare the order")
+	ErrTooFarAhead   = errors.New("slot is too far ahead")
+	ErrNotASlot      = errors.New("scheduled_for must be the start of a slot while the restaurant is open")
+)
+
+// clock parses an HH:MM time of day into hours and minutes
+func clock(value string) (int, int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// ValidateSchedule checks the timezone and that every span is a valid HH:MM
+// range closing after it opens
+func ValidateSchedule(schedule models.RestaurantSchedule) error {
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil || schedule.Timezone == "" {
+		return fmt.Errorf("unknown timezone %q", schedule.Timezone)
+	}
+	for _, hours := range schedule.Hours {
+		if hours.Weekday < 0 || hours.Weekday > 6 {
+			return fmt.Errorf("invalid weekday %d", hours.Weekday)
+		}
+		openH, openM, err := clock(hours.OpensAt)
+		if err != nil {
+			return err
+		}
+		closeH, closeM, err := clock(hours.ClosesAt)
+		if err != nil {
+			return err
+		}
+		if closeH*60+closeM <= openH*60+openM {
+			return fmt.Errorf("%s-%s closes before it opens; split spans past midnight in two", hours.OpensAt, hours.ClosesAt)
+		}
+	}
+	return nil
+}
+
+// window is the earliest and latest slot start a customer may order for now
+func window(schedule models.RestaurantSchedule, now time.Time) (time.Time, time.Time) {
+	earliest := now.Add(time.Duration(schedule.PrepLeadMinutes) * time.Minute)
+	return earliest, now.AddDate(0, 0, schedule.MaxDaysAhead)
+}
+
+// DaySlots returns the start of every slot on the restaurant's local date
+// that can still be ordered for, in order
+func DaySlots(schedule models.RestaurantSchedule, year int, month time.Month, day int, now time.Time) ([]time.Time, error) {
+	earliest, latest := window(schedule, now)
+	return slotStarts(schedule, year, month, day, earliest, latest)
+}
+
+// slotStarts cuts the opening spans of a local date into slots and returns
+// the starts between earliest and latest, in order
+func slotStarts(schedule models.RestaurantSchedule, year int, month time.Month, day int, earliest, latest time.Time) ([]time.Time, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	length := time.Duration(schedule.SlotMinutes) * time.Minute
+	weekday := int(time.Date(year, month, day, 12, 0, 0, 0, loc).Weekday())
+
+	starts := make([]time.Time, 0)
+	for _, hours := range schedule.Hours {
+		if hours.Weekday != weekday {
+			continue
+		}
+		openH, openM, err := clock(hours.OpensAt)
+		if err != nil {
+			return nil, err
+		}
+		closeH, closeM, err := clock(hours.ClosesAt)
+		if err != nil {
+			return nil, err
+		}
+		closes := time.Date(year, month, day, closeH, closeM, 0, 0, loc)
+		for start := time.Date(year, month, day, openH, openM, 0, 0, loc); !start.Add(length).After(closes); start = start.Add(length) {
+			if !start.Before(earliest) && !start.After(latest) {
+				starts = append(starts, start)
+			}
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts, nil
+}
+
+// isSlotStart reports whether at is one of the slots between earliest and latest
+func isSlotStart(schedule models.RestaurantSchedule, at, earliest, latest time.Time) (bool, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return false, err
+	}
+	local := at.In(loc)
+	starts, err := slotStarts(schedule, local.Year(), local.Month(), local.Day(), earliest, latest)
+	if err != nil {
+		return false, err
+	}
+	for _, start := range starts {
+		if start.Equal(at) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckSlot reports why an order cannot be scheduled for the time, or nil
+// if it starts a slot that can still be ordered for
+func CheckSlot(schedule models.RestaurantSchedule, at time.Time, now time.Time) error {
+	if len(schedule.Hours) == 0 {
+		return ErrNotScheduling
+	}
+	earliest, latest := window(schedule, now)
+	if at.Before(earliest) {
+		return ErrTooSoon
+	}
+	if at.After(latest) {
+		return ErrTooFarAhead
+	}
+
+	ok, err := isSlotStart(schedule, at, earliest, latest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotASlot
+	}
+	return nil
+}
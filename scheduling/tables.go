@@ -0,0 +1,44 @@
+package scheduling
+
+import (
+	"errors"
+	"new_restaurant/models"
+	"time"
+)
+
+var (
+	ErrNoReservations  = errors.New("restaurant does not take reservations")
+	ErrReservationPast = errors.New("reservation time has already passed")
+	ErrNotATableSlot   = errors.New("starts_at must be the start of a slot while the restaurant is open")
+)
+
+// TableSlots returns the start of every slot on the restaurant's local date
+// that a table can still be reserved for, in order. Unlike deliveries,
+// tables need no prep lead time.
+func TableSlots(schedule models.RestaurantSchedule, year int, month time.Month, day int, now time.Time) ([]time.Time, error) {
+	return slotStarts(schedule, year, month, day, now, now.AddDate(0, 0, schedule.MaxDaysAhead))
+}
+
+// CheckTableSlot reports why a table cannot be reserved from the time, or
+// nil if it starts a slot that can still be reserved
+func CheckTableSlot(schedule models.RestaurantSchedule, at time.Time, now time.Time) error {
+	if len(schedule.Hours) == 0 {
+		return ErrNoReservations
+	}
+	latest := now.AddDate(0, 0, schedule.MaxDaysAhead)
+	if at.Before(now) {
+		return ErrReservationPast
+	}
+	if at.After(latest) {
+		return ErrTooFarAhead
+	}
+
+	ok, err := isSlotStart(schedule, at, now, latest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotATableSlot
+	}
+	return nil
+}
@@ -22,27 +22,136 @@ func SetupRoutes() http.Handler {
 		}
 	}).Methods("GET")
 
+	// Public signing keys for other services verifying our tokens
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKSHandler).Methods("GET")
+
+	// Payment provider callbacks, authenticated by signature rather than JWT
+	r.HandleFunc("/webhooks/payments/{provider}", handlers.PaymentWebhook).Methods("POST")
+
 	// Auth routes
 	r.HandleFunc("/login", handlers.LoginHandler).Methods("POST")
+	r.HandleFunc("/login/mfa", handlers.LoginMFAHandler).Methods("POST")
+	r.HandleFunc("/login/mfa/enroll", handlers.LoginMFAEnrollHandler).Methods("POST")
 	r.HandleFunc("/logout", handlers.LogoutHandler).Methods("POST")
 	r.HandleFunc("/GetDishesByID", handlers.ListAllDishByRestaurant).Methods("GET")
 	r.HandleFunc("/GetRestaurants", handlers.ListAllRestaurant).Methods("GET")
+	r.HandleFunc("/GetNearbyRestaurants", handlers.ListNearbyRestaurants).Methods("GET")
+
+	// Walk-in guests check their place in the queue with the token from their link
+	r.HandleFunc("/waitlist/{token}", handlers.GetWaitlistStatus).Methods("GET")
+
+	// Guests scan a table's code to open a dine-in session, then order to
+	// the table with the session token instead of an account
+	r.HandleFunc("/dine-in/sessions", handlers.StartDineIn).Methods("POST")
+	dineIn := r.PathPrefix("/dine-in").Subrouter()
+	dineIn.Use(middleware.DineInMiddleware)
+	dineIn.HandleFunc("/menu", handlers.GetDineInMenu).Methods("GET")
+	dineIn.HandleFunc("/orders", handlers.CreateDineInOrder).Methods("POST")
+	dineIn.HandleFunc("/tab", handlers.GetDineInTab).Methods("GET")
+	dineIn.HandleFunc("/tab/split", handlers.SplitDineInTab).Methods("POST")
+	dineIn.HandleFunc("/tab/shares/{id}/pay", handlers.PayBillShare).Methods("POST")
 
 	// Protected routes (with auth middleware)
 	protected := r.PathPrefix("/api").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
 	protected.HandleFunc("/CreateAddress", handlers.CreateAddress).Methods("POST")
+	protected.HandleFunc("/addresses", handlers.ListAddresses).Methods("GET")
+	protected.HandleFunc("/addresses", handlers.CreateAddress).Methods("POST")
+	protected.HandleFunc("/addresses/{id}", handlers.GetAddress).Methods("GET")
+	protected.HandleFunc("/addresses/{id}", handlers.UpdateAddress).Methods("PATCH")
+	protected.HandleFunc("/addresses/{id}", handlers.DeleteAddress).Methods("DELETE")
+	protected.HandleFunc("/addresses/{id}/default", handlers.SetDefaultAddress).Methods("PUT")
 	protected.HandleFunc("/CalculateDistance", handlers.CalculateDistance).Methods("POST")
+	protected.HandleFunc("/distances", handlers.CalculateDistanceMatrix).Methods("POST")
+	protected.HandleFunc("/cart/price", handlers.PriceCart).Methods("POST")
+	protected.HandleFunc("/orders", handlers.CreateOrder).Methods("POST")
+	protected.HandleFunc("/orders", handlers.ListMyOrders).Methods("GET")
+	protected.HandleFunc("/orders/{id}", handlers.GetOrder).Methods("GET")
+	protected.HandleFunc("/orders/{id}/reorder", handlers.Reorder).Methods("POST")
+	protected.HandleFunc("/orders/{id}/pay", handlers.PayOrder).Methods("POST")
+	protected.HandleFunc("/orders/{id}/payments", handlers.ListOrderPayments).Methods("GET")
+	protected.HandleFunc("/orders/{id}/invoice", handlers.GetInvoice).Methods("GET")
+	protected.HandleFunc("/orders/{id}/events", handlers.OrderEvents).Methods("GET")
+	protected.HandleFunc("/orders/{id}/refunds", handlers.CreateRefund).Methods("POST")
+	protected.HandleFunc("/orders/{id}/refunds", handlers.ListOrderRefunds).Methods("GET")
+	protected.HandleFunc("/restaurants/{id}/slots", handlers.ListRestaurantSlots).Methods("GET")
+	protected.HandleFunc("/restaurants/{id}/availability", handlers.SearchTableAvailability).Methods("GET")
+	protected.HandleFunc("/restaurants/{id}/reservations", handlers.CreateReservation).Methods("POST")
+	protected.HandleFunc("/reservations", handlers.ListMyReservations).Methods("GET")
+	protected.HandleFunc("/reservations/{id}/cancel", handlers.CancelReservation).Methods("POST")
+	protected.HandleFunc("/loyalty", handlers.GetMyLoyalty).Methods("GET")
+	protected.HandleFunc("/favorites", handlers.ListFavorites).Methods("GET")
+	protected.HandleFunc("/favorites/restaurants/{id}", handlers.AddFavoriteRestaurant).Methods("PUT")
+	protected.HandleFunc("/favorites/restaurants/{id}", handlers.RemoveFavoriteRestaurant).Methods("DELETE")
+	protected.HandleFunc("/favorites/dishes/{id}", handlers.AddFavoriteDish).Methods("PUT")
+	protected.HandleFunc("/favorites/dishes/{id}", handlers.RemoveFavoriteDish).Methods("DELETE")
+	protected.HandleFunc("/geocode", handlers.GeocodeAddress).Methods("GET")
+	protected.HandleFunc("/geocode/reverse", handlers.ReverseGeocode).Methods("GET")
+	protected.HandleFunc("/me", handlers.GetMe).Methods("GET")
+	protected.HandleFunc("/me", handlers.UpdateMe).Methods("PATCH")
+	protected.HandleFunc("/me/stream-token", handlers.CreateStreamToken).Methods("POST")
+	protected.HandleFunc("/me/sessions", handlers.ListMySessions).Methods("GET")
+	protected.HandleFunc("/me/sessions", handlers.RevokeAllMySessions).Methods("DELETE")
+	protected.HandleFunc("/me/sessions/{id}", handlers.RevokeMySession).Methods("DELETE")
+	protected.HandleFunc("/mfa/enroll", handlers.EnrollMFA).Methods("POST")
+	protected.HandleFunc("/mfa/confirm", handlers.ConfirmMFA).Methods("POST")
+	protected.HandleFunc("/mfa/disable", handlers.DisableMFA).Methods("POST")
+	protected.HandleFunc("/mfa/recovery-codes", handlers.RegenerateRecoveryCodes).Methods("POST")
 
 	// Admin routes
 	admin := protected.PathPrefix("/admin").Subrouter()
 	admin.HandleFunc("/CreateUser", handlers.CreateUser).Methods("POST")
 	admin.HandleFunc("/GetUsers", handlers.ListAllUsers).Methods("GET")
 	admin.HandleFunc("/GetSubadmins", handlers.ListAllSubAdmins).Methods("GET")
+	admin.HandleFunc("/users/{id}", handlers.GetUserByAdmin).Methods("GET")
+	admin.HandleFunc("/users/{id}", handlers.UpdateUserByAdmin).Methods("PATCH")
+	admin.HandleFunc("/users/{id}", handlers.DeactivateUser).Methods("DELETE")
+	admin.HandleFunc("/users/{id}/roles", handlers.GrantUserRole).Methods("POST")
+	admin.HandleFunc("/users/{id}/roles/{role}", handlers.RevokeUserRole).Methods("DELETE")
 	admin.HandleFunc("/CreateRestaurants", handlers.CreateRestaurant).Methods("POST")
 	admin.HandleFunc("/GetRestaurants", handlers.ListAllRestaurantByAdmin).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}", handlers.UpdateRestaurant).Methods("PATCH")
+	admin.HandleFunc("/restaurants/{id}/tax-rules", handlers.GetTaxRules).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}/tax-rules", handlers.UpdateTaxRules).Methods("PUT")
+	admin.HandleFunc("/restaurants/{id}/schedule", handlers.GetRestaurantSchedule).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}/schedule", handlers.UpdateRestaurantSchedule).Methods("PUT")
+	admin.HandleFunc("/restaurants/{id}/loyalty", handlers.GetLoyaltySettings).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}/loyalty", handlers.UpdateLoyaltySettings).Methods("PUT")
+	admin.HandleFunc("/restaurants/{id}/kitchen", handlers.KitchenFeed).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}/tables", handlers.ListDiningTables).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}/tables", handlers.CreateDiningTable).Methods("POST")
+	admin.HandleFunc("/restaurants/{id}/tables/{tableId}", handlers.UpdateDiningTable).Methods("PATCH")
+	admin.HandleFunc("/restaurants/{id}/tables/{tableId}", handlers.DeleteDiningTable).Methods("DELETE")
+	admin.HandleFunc("/restaurants/{id}/tables/{tableId}/clear", handlers.ClearDiningTable).Methods("POST")
+	admin.HandleFunc("/restaurants/{id}/tables/{tableId}/qr", handlers.GetTableQRCode).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}/tables/{tableId}/qr/rotate", handlers.RotateTableQRCode).Methods("POST")
+	admin.HandleFunc("/restaurants/{id}/reservations", handlers.ListRestaurantReservations).Methods("GET")
+	admin.HandleFunc("/reservations/{id}/seat", handlers.SeatReservation).Methods("POST")
+	admin.HandleFunc("/reservations/{id}/complete", handlers.CompleteReservation).Methods("POST")
+	admin.HandleFunc("/reservations/{id}/no-show", handlers.MarkReservationNoShow).Methods("POST")
+	admin.HandleFunc("/restaurants/{id}/waitlist", handlers.ListWaitlist).Methods("GET")
+	admin.HandleFunc("/restaurants/{id}/waitlist", handlers.AddToWaitlist).Methods("POST")
+	admin.HandleFunc("/waitlist/{id}/notify", handlers.NotifyWaitlistEntry).Methods("POST")
+	admin.HandleFunc("/waitlist/{id}/seat", handlers.SeatWaitlistEntry).Methods("POST")
+	admin.HandleFunc("/waitlist/{id}/remove", handlers.RemoveWaitlistEntry).Methods("POST")
+	admin.HandleFunc("/restaurants/{id}/tabs", handlers.ListOpenTabs).Methods("GET")
+	admin.HandleFunc("/tabs/{id}/split", handlers.SplitTab).Methods("POST")
+	admin.HandleFunc("/tabs/{id}/close", handlers.CloseTab).Methods("POST")
+	admin.HandleFunc("/bill-shares/{id}/cash", handlers.RecordCashPayment).Methods("POST")
 
 	admin.HandleFunc("/CreateDish", handlers.CreateDish).Methods("POST")
+	admin.HandleFunc("/promotions", handlers.CreatePromotion).Methods("POST")
+	admin.HandleFunc("/promotions", handlers.ListPromotions).Methods("GET")
+	admin.HandleFunc("/promotions/{id}", handlers.DeletePromotion).Methods("DELETE")
+
+	courier := protected.PathPrefix("/courier").Subrouter()
+	courier.HandleFunc("/availability", handlers.SetCourierAvailability).Methods("PUT")
+	courier.HandleFunc("/location", handlers.UpdateCourierLocation).Methods("PUT")
+	courier.HandleFunc("/assignments", handlers.ListCourierAssignments).Methods("GET")
+	courier.HandleFunc("/assignments/{id}/accept", handlers.AcceptAssignment).Methods("POST")
+	courier.HandleFunc("/assignments/{id}/decline", handlers.DeclineAssignment).Methods("POST")
+	courier.HandleFunc("/assignments/{id}/pickup", handlers.PickUpAssignment).Methods("POST")
+	courier.HandleFunc("/assignments/{id}/deliver", handlers.CompleteAssignment).Methods("POST")
 
 	subAdmin := protected.PathPrefix("/subAdmin").Subrouter()
 	subAdmin.HandleFunc("/GetRestaurants", handlers.ListAllRestaurantBySubAdmin).Methods("GET")
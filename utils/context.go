@@ -5,12 +5,18 @@ import (
 	"net/http"
 )
 
+// HasRole reports whether the caller currently holds requiredRole
 func HasRole(r *http.Request, requiredRole string) bool {
 	claims, ok := r.Context().Value("user").(*CustomClaims)
 	if !ok {
 		return false
 	}
-	return claims.Role == requiredRole
+	for _, role := range claims.Roles {
+		if role == requiredRole {
+			return true
+		}
+	}
+	return false
 }
 
 //
@@ -40,3 +46,9 @@ func GetUserID(r *http.Request) (uuid.UUID, bool) {
 
 	return userUUID, true
 }
+
+// GetTableClaims returns the dine-in session of a guest request
+func GetTableClaims(r *http.Request) (*TableClaims, bool) {
+	claims, ok := r.Context().Value("guest").(*TableClaims)
+	return claims, ok
+}
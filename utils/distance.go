@@ -29,3 +29,15 @@ func CalculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	// Round to 2 decimal places
 	return math.Round(distance*100) / 100
 }
+
+// ValidCoordinates reports whether lat/lon are both set and within range,
+// or both omitted
+func ValidCoordinates(lat, lon *float64) bool {
+	if lat == nil && lon == nil {
+		return true
+	}
+	if lat == nil || lon == nil {
+		return false
+	}
+	return *lat >= -90 && *lat <= 90 && *lon >= -180 && *lon <= 180
+}
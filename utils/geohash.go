@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"math"
+	"strings"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeohashPrecision is the number of characters stored for each restaurant
+const GeohashPrecision = 9
+
+// EncodeGeohash returns the geohash of the point with the given number of characters
+func EncodeGeohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	bit, ch, even := 0, 0, true
+	for hash.Len() < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+
+		if bit < 4 {
+			bit++
+		} else {
+			hash.WriteByte(geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// geohashCellSize returns the height and width in degrees of a cell of the given precision
+func geohashCellSize(precision int) (latDeg, lonDeg float64) {
+	bits := precision * 5
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lonBits))
+}
+
+// GeohashPrecisionForRadius picks the finest precision whose cells are at least
+// radiusKm on every side at the given latitude, so a point's cell and its eight
+// neighbours always cover the whole search circle
+func GeohashPrecisionForRadius(lat, radiusKm float64) int {
+	const kmPerDegree = 111.32
+	for precision := GeohashPrecision; precision > 1; precision-- {
+		latDeg, lonDeg := geohashCellSize(precision)
+		heightKm := latDeg * kmPerDegree
+		widthKm := lonDeg * kmPerDegree * math.Cos(lat*math.Pi/180)
+		if heightKm >= radiusKm && widthKm >= radiusKm {
+			return precision
+		}
+	}
+	return 1
+}
+
+// GeohashNeighborhood returns the cell containing the point plus its eight
+// neighbours at the given precision, without duplicates
+func GeohashNeighborhood(lat, lon float64, precision int) []string {
+	latDeg, lonDeg := geohashCellSize(precision)
+
+	seen := map[string]bool{}
+	cells := make([]string, 0, 9)
+	for _, dLat := range []float64{0, latDeg, -latDeg} {
+		for _, dLon := range []float64{0, lonDeg, -lonDeg} {
+			cellLat := lat + dLat
+			if cellLat > 90 || cellLat < -90 {
+				continue
+			}
+			cellLon := math.Mod(lon+dLon+540, 360) - 180
+			cell := EncodeGeohash(cellLat, cellLon, precision)
+			if !seen[cell] {
+				seen[cell] = true
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestEncodeGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lon  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.6, -5.6, 5, "ezs42"},
+		{0, 0, 1, "s"},
+		{-90, -180, 3, "000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := EncodeGeohash(tt.lat, tt.lon, tt.precision); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeohashNeighborhood(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, lon  float64
+		precision int
+		want      []string
+	}{
+		{
+			name: "cell and its eight neighbours",
+			lat:  42.6, lon: -5.6, precision: 5,
+			want: []string{"ezs42", "ezs48", "ezs49", "ezs43", "ezs41", "ezs40", "ezefp", "ezefr", "ezefx"},
+		},
+		{
+			name: "wraps around the antimeridian",
+			lat:  10, lon: 179.99, precision: 1,
+			want: []string{"x", "z", "r", "w", "y", "q", "8", "b", "2"},
+		},
+		{
+			name: "stops at the pole",
+			lat:  89.99, lon: 10, precision: 1,
+			want: []string{"u", "g", "v", "s", "e", "t"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GeohashNeighborhood(tt.lat, tt.lon, tt.precision)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(got)
+			sort.Strings(want)
+			if len(got) != len(want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("got %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGeohashPrecisionForRadius(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat      float64
+		radiusKm float64
+		want     int
+	}{
+		{"small radius at the equator", 0, 0.1, 7},
+		{"one km at the equator", 0, 1, 5},
+		{"five km at the equator", 0, 5, 4},
+		{"narrower cells further north", 60, 3, 4},
+		{"larger than any cell", 0, 10000, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GeohashPrecisionForRadius(tt.lat, tt.radiusKm); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,45 +2,153 @@ package utils
 
 import (
 	"github.com/golang-jwt/jwt/v5"
-	"os"
+	"github.com/google/uuid"
 	"time"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET")) // fetch from env
-
-// JwtKey returns the JWT secret key
-func JwtKey() []byte {
-	return jwtKey
-}
+// PurposeMFA marks a short-lived token that only proves the password step of
+// a login; it must be exchanged at /login/mfa and is rejected by AuthMiddleware
+const PurposeMFA = "mfa"
 
+// CustomClaims identify a user. Role is the role the token was issued for;
+// AuthMiddleware fills Roles with the roles the user holds now, which is what
+// HasRole checks, so grants and revocations apply to tokens already issued.
+// SessionID is the login session the token belongs to; revoking the session
+// revokes the token.
 type CustomClaims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    string   `json:"user_id"`
+	Role      string   `json:"role"`
+	SessionID string   `json:"sid,omitempty"`
+	Purpose   string   `json:"purpose,omitempty"`
+	Roles     []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID, role string) (string, error) {
+func GenerateJWT(userID, role, sessionID string) (string, error) {
 	claims := CustomClaims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return signClaims(claims)
 }
 
-func GenerateRefreshToken(userID, role string) (string, error) {
+func GenerateRefreshToken(userID, role, sessionID string) (string, error) {
 	claims := CustomClaims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return signClaims(claims)
+}
+
+// GenerateMFAToken issues the challenge token returned by LoginHandler when a
+// second factor is required. Its ID is what attempts at /login/mfa are counted
+// against.
+func GenerateMFAToken(userID, role string) (string, error) {
+	claims := CustomClaims{
+		UserID:  userID,
+		Role:    role,
+		Purpose: PurposeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// ParseMFAToken validates a challenge token issued by GenerateMFAToken
+func ParseMFAToken(tokenStr string) (*CustomClaims, error) {
+	claims, err := ParseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(claims.ID); err != nil || claims.Purpose != PurposeMFA {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// PurposeStream marks a short-lived token a browser passes in the query
+// string to open a WebSocket, since it cannot set the Authorization header
+const PurposeStream = "stream"
+
+// StreamTokenTTL is how long a stream token can be used to open a connection;
+// the connection itself may outlive it
+const StreamTokenTTL = time.Minute
+
+// GenerateStreamToken issues a stream token for an authenticated user's session
+func GenerateStreamToken(userID, role, sessionID string) (string, error) {
+	claims := CustomClaims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		Purpose:   PurposeStream,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(StreamTokenTTL)),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+const (
+	// PurposeTable marks the signed tokens printed in table QR codes before
+	// tables had their own random codes. They are accepted for as long as
+	// their signing key is, and bumping the table's QR version revokes them.
+	PurposeTable = "table"
+	// PurposeDineIn marks a guest's session at a table, opened by scanning
+	// the table's code
+	PurposeDineIn = "dine_in"
+)
+
+// dineInSessionTTL is how long a guest can keep ordering after scanning
+const dineInSessionTTL = 4 * time.Hour
+
+// TableClaims identify a table, and for dine-in sessions the tab the guest
+// orders onto
+type TableClaims struct {
+	RestaurantID string `json:"restaurant_id"`
+	TableID      string `json:"table_id"`
+	TabID        string `json:"tab_id,omitempty"`
+	Version      int    `json:"ver,omitempty"`
+	Purpose      string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GenerateDineInToken issues a guest's session token for a table's open tab
+func GenerateDineInToken(restaurantID, tableID, tabID string) (string, error) {
+	return signClaims(TableClaims{
+		RestaurantID: restaurantID,
+		TableID:      tableID,
+		TabID:        tabID,
+		Purpose:      PurposeDineIn,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(dineInSessionTTL)),
+		},
+	})
+}
+
+// ParseTableClaims validates a table or dine-in token issued for the purpose
+func ParseTableClaims(tokenStr, purpose string) (*TableClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &TableClaims{}, verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*TableClaims)
+	if !ok || !token.Valid || claims.Purpose != purpose {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
 }
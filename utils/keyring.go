@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyKID is the key id given to JWT_SECRET so tokens issued before key
+// rotation was introduced (which carry no kid header) still verify
+const legacyKID = "default"
+
+// SigningKey is one entry of the key ring. Keys without a private half are
+// only used to verify tokens signed before a rotation.
+type SigningKey struct {
+	KID     string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// KeyRing holds every key accepted for verification and the one used to sign
+type KeyRing struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+}
+
+var keyRing *KeyRing
+
+// JWK is the public representation of a key published at /.well-known/jwks.json
+type JWK struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	CRV string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// LoadKeyRing builds the key ring from the environment and must be called once at startup.
+//
+// JWT_KEYS is a comma separated list of kid:alg:path entries, where alg is
+// RS256, EdDSA or HS256 and path points to a PEM private key, a PEM public key
+// (verify only) or, for HS256, a file holding the raw secret. JWT_ACTIVE_KID
+// selects the signing key. JWT_SECRET, if set, is added as an HS256 key with
+// kid "default" and used for signing when no other key is active.
+func LoadKeyRing() error {
+	ring := &KeyRing{keys: map[string]*SigningKey{}}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		ring.keys[legacyKID] = &SigningKey{
+			KID:     legacyKID,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(secret),
+			Public:  []byte(secret),
+		}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, err := loadSigningKey(entry)
+		if err != nil {
+			return err
+		}
+		if _, exists := ring.keys[key.KID]; exists {
+			return fmt.Errorf("duplicate jwt key id %q", key.KID)
+		}
+		ring.keys[key.KID] = key
+	}
+
+	activeKID := os.Getenv("JWT_ACTIVE_KID")
+	if activeKID == "" {
+		activeKID = legacyKID
+	}
+	active, ok := ring.keys[activeKID]
+	if !ok {
+		return fmt.Errorf("no jwt signing key configured: set JWT_SECRET or JWT_KEYS and JWT_ACTIVE_KID")
+	}
+	if active.Private == nil {
+		return fmt.Errorf("jwt key %q has no private key and cannot be used for signing", activeKID)
+	}
+	ring.active = active
+
+	keyRing = ring
+	return nil
+}
+
+func loadSigningKey(entry string) (*SigningKey, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid:alg:path", entry)
+	}
+	kid, alg, path := parts[0], parts[1], parts[2]
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwt key %q: %w", kid, err)
+	}
+
+	key := &SigningKey{KID: kid}
+	switch alg {
+	case "HS256":
+		secret := []byte(strings.TrimSpace(string(data)))
+		key.Method, key.Private, key.Public = jwt.SigningMethodHS256, secret, secret
+	case "RS256":
+		key.Method = jwt.SigningMethodRS256
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.Private, key.Public = private, &private.PublicKey
+		} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			key.Public = public
+		} else {
+			return nil, fmt.Errorf("failed to parse RSA key %q: %w", kid, err)
+		}
+	case "EdDSA":
+		key.Method = jwt.SigningMethodEdDSA
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			key.Private, key.Public = private, private.(crypto.Signer).Public()
+		} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+			key.Public = public
+		} else {
+			return nil, fmt.Errorf("failed to parse Ed25519 key %q: %w", kid, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q for key %q", alg, kid)
+	}
+	return key, nil
+}
+
+// signClaims signs claims with the active key and stamps its kid in the header
+func signClaims(claims jwt.Claims) (string, error) {
+	if keyRing == nil {
+		return "", errors.New("jwt key ring is not loaded")
+	}
+	token := jwt.NewWithClaims(keyRing.active.Method, claims)
+	token.Header["kid"] = keyRing.active.KID
+	return token.SignedString(keyRing.active.Private)
+}
+
+// verificationKey resolves the key for a token from its kid header, refusing
+// tokens whose alg does not match the key to prevent algorithm confusion
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keyRing == nil {
+		return nil, errors.New("jwt key ring is not loaded")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKID
+	}
+
+	key, ok := keyRing.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+// ParseToken validates tokenStr against the key ring and returns its claims
+func ParseToken(tokenStr string) (*CustomClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &CustomClaims{}, verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*CustomClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys other services need to verify our tokens.
+// Symmetric keys are never published.
+func JWKS() []JWK {
+	kids := make([]string, 0, len(keyRing.keys))
+	for kid := range keyRing.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := make([]JWK, 0, len(kids))
+	for _, kid := range kids {
+		key := keyRing.keys[kid]
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				KTY: "RSA",
+				KID: key.KID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				KTY: "OKP",
+				KID: key.KID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				CRV: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,48 @@
+// Package waitlist estimates how long walk-in parties will wait for a table.
+package waitlist
+
+import (
+	"sort"
+	"time"
+)
+
+// Table is a table a waiting party could sit at and when it is expected to
+// be free; a free table has a zero FreeAt
+type Table struct {
+	Capacity int
+	FreeAt   time.Time
+}
+
+// EstimateQueue returns the expected wait of each party in queue order. Each
+// party takes whichever table seating it frees up first, and holds it for
+// turnover, so parties ahead push back the ones behind them. A party no
+// table can seat gets a nil estimate and takes no table.
+func EstimateQueue(now time.Time, tables []Table, partySizes []int, turnover time.Duration) []*time.Duration {
+	free := make([]Table, len(tables))
+	copy(free, tables)
+	for i := range free {
+		if free[i].FreeAt.Before(now) {
+			// free already, or overstaying and expected to leave any moment
+			free[i].FreeAt = now
+		}
+	}
+	// among tables free at the same time, the smallest that fits is used
+	sort.SliceStable(free, func(i, j int) bool { return free[i].Capacity < free[j].Capacity })
+
+	waits := make([]*time.Duration, len(partySizes))
+	for p, size := range partySizes {
+		best := -1
+		for i, table := range free {
+			if table.Capacity >= size && (best < 0 || table.FreeAt.Before(free[best].FreeAt)) {
+				best = i
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		wait := free[best].FreeAt.Sub(now)
+		waits[p] = &wait
+		free[best].FreeAt = free[best].FreeAt.Add(turnover)
+	}
+	return waits
+}